@@ -0,0 +1,54 @@
+// commands.admin.go
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/siro20/boardstatus/pkg/model"
+)
+
+const createAdminUsage = "usage: boardstatus [flags] create-admin <username>"
+
+// Admin passwords need at least this many characters
+const minAdminPasswordLength = 8
+
+// Handle 'boardstatus create-admin <username>', which adds the first admin of
+// a new deployment. The password is taken from $BOARDSTATUS_ADMIN_PASSWORD or
+// read from the first line of stdin.
+func runCreateAdmin(store *model.Store, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf(createAdminUsage)
+	}
+	if err := store.CheckSchema(); err != nil {
+		return err
+	}
+
+	password := os.Getenv("BOARDSTATUS_ADMIN_PASSWORD")
+	if password == "" {
+		fmt.Fprintf(os.Stderr, "Password of %s: ", args[0])
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return fmt.Errorf("Failed to read the password: %v", err)
+		}
+		password = strings.TrimRight(line, "\r\n")
+	}
+	if len(password) < minAdminPasswordLength {
+		return fmt.Errorf("The password needs at least %d characters", minAdminPasswordLength)
+	}
+
+	u := model.User{
+		Username: args[0],
+		Name:     args[0],
+		Password: password,
+		IsAdmin:  true,
+	}
+	if err := u.InsertIntoDB(store); err != nil {
+		return err
+	}
+	fmt.Printf("Created admin %s\n", u.Username)
+	return nil
+}
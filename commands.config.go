@@ -0,0 +1,23 @@
+// commands.config.go
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/siro20/boardstatus/pkg/model"
+)
+
+// Handle 'boardstatus parse-configs', e.g. for tests stored before the
+// .config was parsed
+func runParseConfigs(store *model.Store) error {
+	if err := store.CheckSchema(); err != nil {
+		return err
+	}
+	n, err := store.ParseStoredConfigs()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Parsed the config of %d tests\n", n)
+	return nil
+}
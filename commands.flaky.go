@@ -0,0 +1,34 @@
+// commands.flaky.go
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/siro20/boardstatus/pkg/model"
+)
+
+// Handle 'boardstatus [-flaky-...] detect-flaky'
+func runDetectFlaky(store *model.Store) error {
+	if err := store.CheckSchema(); err != nil {
+		return err
+	}
+	n, err := store.DetectFlakyCases()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Found %d flaky test cases\n", n)
+	return nil
+}
+
+// Detect flaky test cases in the background while serving
+func detectFlakyPeriodically(store *model.Store, interval time.Duration) {
+	for {
+		if _, err := store.DetectFlakyCases(); err != nil {
+			glog.Errorf("Failed to detect flaky test cases: %v", err)
+		}
+		time.Sleep(interval)
+	}
+}
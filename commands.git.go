@@ -0,0 +1,27 @@
+// commands.git.go
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/siro20/boardstatus/pkg/model"
+)
+
+// Handle 'boardstatus -git-repo <dir> git-sync'
+func runGitSync(store *model.Store, repo string) error {
+	if repo == "" {
+		return fmt.Errorf("usage: boardstatus -git-repo <dir> [-git-branch <branch>] git-sync")
+	}
+	// Leave databases with an outdated schema alone
+	if err := store.CheckSchema(); err != nil {
+		return err
+	}
+
+	n, err := store.SyncCommits()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Resolved %d commits\n", n)
+	return nil
+}
@@ -0,0 +1,57 @@
+// commands.migrate.go
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/siro20/boardstatus/pkg/model"
+)
+
+const migrateUsage = "usage: boardstatus [flags] migrate up|down|status"
+
+// Handle 'boardstatus migrate up|down|status'
+func runMigrate(store *model.Store, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf(migrateUsage)
+	}
+
+	switch args[0] {
+	case "up":
+		done, err := store.MigrateUp()
+		for _, m := range done {
+			fmt.Printf("Applied migration %d: %s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(done) == 0 {
+			fmt.Printf("Database is up to date\n")
+		}
+	case "down":
+		m, err := store.MigrateDown()
+		if err != nil {
+			return err
+		}
+		if m == nil {
+			fmt.Printf("No migration to revert\n")
+		} else {
+			fmt.Printf("Reverted migration %d: %s\n", m.Version, m.Name)
+		}
+	case "status":
+		states, err := store.MigrationStatus()
+		if err != nil {
+			return err
+		}
+		for _, st := range states {
+			if st.Applied {
+				fmt.Printf("%4d  applied %s  %s\n", st.Version, st.AppliedAt.Format("2006-01-02 15:04:05"), st.Name)
+			} else {
+				fmt.Printf("%4d  pending %19s  %s\n", st.Version, "", st.Name)
+			}
+		}
+	default:
+		return fmt.Errorf(migrateUsage)
+	}
+	return nil
+}
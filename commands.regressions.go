@@ -0,0 +1,22 @@
+// commands.regressions.go
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/siro20/boardstatus/pkg/model"
+)
+
+// Handle 'boardstatus rebuild-regressions', e.g. for tests stored before
+// regressions were recorded
+func runRebuildRegressions(store *model.Store) error {
+	if err := store.CheckSchema(); err != nil {
+		return err
+	}
+	if err := store.RebuildRegressions(); err != nil {
+		return err
+	}
+	fmt.Printf("Regressions rebuilt\n")
+	return nil
+}
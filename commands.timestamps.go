@@ -0,0 +1,23 @@
+// commands.timestamps.go
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/siro20/boardstatus/pkg/model"
+)
+
+// Handle 'boardstatus parse-timestamps', e.g. for tests stored before the
+// cbmem timestamps were parsed
+func runParseTimestamps(store *model.Store) error {
+	if err := store.CheckSchema(); err != nil {
+		return err
+	}
+	n, err := store.ParseStoredTimestamps()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Parsed the timestamps of %d tests\n", n)
+	return nil
+}
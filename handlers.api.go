@@ -0,0 +1,523 @@
+// handlers.api.go
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/siro20/boardstatus/pkg/lava"
+	"github.com/siro20/boardstatus/pkg/model"
+	"github.com/siro20/boardstatus/pkg/parser"
+	"gopkg.in/yaml.v2"
+)
+
+// Largest request body accepted by the REST API
+const apiMaxBodySize = 64 << 20
+
+// Abort the request with a JSON error message
+func apiError(c *gin.Context, code int, err error) {
+	c.Error(err)
+	res := gin.H{"error": err.Error()}
+	if fields := model.FieldErrors(err); fields != nil {
+		res["fields"] = fields
+	}
+	c.AbortWithStatusJSON(code, res)
+}
+
+// Abort with 422 for invalid input, 403 for missing permissions and 500 for
+// everything else
+func apiStoreError(c *gin.Context, err error) {
+	switch {
+	case model.IsValidationError(err):
+		apiError(c, http.StatusUnprocessableEntity, err)
+	case model.IsForbiddenError(err):
+		apiError(c, http.StatusForbidden, err)
+	default:
+		apiError(c, http.StatusInternalServerError, err)
+	}
+}
+
+// Decode the request body as JSON or YAML, depending on the Content-Type.
+// YAML is the default as it is a superset of JSON.
+func decodeBody(c *gin.Context, v interface{}) error {
+	data, err := ioutil.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, apiMaxBodySize))
+	if err != nil {
+		return err
+	}
+	return decodeData(c.ContentType(), data, v)
+}
+
+func decodeData(contentType string, data []byte, v interface{}) error {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+
+	switch mediaType {
+	case "application/json":
+		if err := json.Unmarshal(data, v); err != nil {
+			return fmt.Errorf("Invalid JSON: %v", err)
+		}
+	case "", "application/yaml", "application/x-yaml", "text/yaml", "text/x-yaml", "text/plain":
+		if err := yaml.Unmarshal(data, v); err != nil {
+			return fmt.Errorf("Invalid YAML: %v", err)
+		}
+	default:
+		return fmt.Errorf("Unsupported content type %s", mediaType)
+	}
+	return nil
+}
+
+// Result report formats accepted as multipart files of a test upload
+var reportParsers = []struct {
+	field string
+	parse func(io.Reader) ([]parser.Case, error)
+}{
+	{"junit", parser.ParseJUnit},
+	{"tap", parser.ParseTAP},
+	{"lava", parser.ParseLAVAResults},
+}
+
+// Decode the test of an upload. Besides a plain JSON or YAML body a
+// multipart form is accepted: the test in the part "test", result reports
+// in the file parts named after their format, e.g. "junit", and binary
+// files like the CMOS dump in the parts "cmos", "cmos_layout" and "smbios".
+func decodeTestUpload(c *gin.Context, t *model.Test) error {
+	mediaType, _, _ := mime.ParseMediaType(c.ContentType())
+	if mediaType != "multipart/form-data" {
+		return decodeBody(c, t)
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, apiMaxBodySize)
+	form, err := c.MultipartForm()
+	if err != nil {
+		return err
+	}
+
+	if fhs := form.File["test"]; len(fhs) > 0 {
+		data, err := readFormFile(fhs[0])
+		if err != nil {
+			return err
+		}
+		if err := decodeData(fhs[0].Header.Get("Content-Type"), data, t); err != nil {
+			return err
+		}
+	} else if v := form.Value["test"]; len(v) > 0 {
+		if err := decodeData("", []byte(v[0]), t); err != nil {
+			return err
+		}
+	}
+
+	for _, rp := range reportParsers {
+		for _, fh := range form.File[rp.field] {
+			f, err := fh.Open()
+			if err != nil {
+				return err
+			}
+			cases, err := rp.parse(f)
+			f.Close()
+			if err != nil {
+				return fmt.Errorf("%s report %s: %v", rp.field, fh.Filename, err)
+			}
+			t.AddCases(cases)
+		}
+	}
+
+	for field, dst := range map[string]*model.Blob{
+		"cmos":        &t.FileCMOS,
+		"cmos_layout": &t.FileCMOSLayout,
+		"smbios":      &t.FileSMBIOS,
+	} {
+		if fhs := form.File[field]; len(fhs) > 0 {
+			data, err := readFormFile(fhs[0])
+			if err != nil {
+				return err
+			}
+			*dst = data
+		}
+	}
+	return nil
+}
+
+func readFormFile(fh *multipart.FileHeader) ([]byte, error) {
+	f, err := fh.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ioutil.ReadAll(f)
+}
+
+// Parse the numeric :id parameter of the route
+func paramID(c *gin.Context, name string) (int, error) {
+	id, err := strconv.Atoi(c.Param(name))
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("Invalid %s %q", name, c.Param(name))
+	}
+	return id, nil
+}
+
+func testURL(t *model.Test) string {
+	return fmt.Sprintf("/api/v1/tests/%d", t.ID)
+}
+
+// Send the stored test with the URLs it can be found at
+func apiRespondTest(c *gin.Context, code int, t *model.Test) {
+	if code == http.StatusCreated {
+		c.Header("Location", testURL(t))
+	}
+	c.JSON(code, gin.H{
+		"test":     t,
+		"url":      testURL(t),
+		"html_url": fmt.Sprintf("/test/view/%d", t.ID),
+	})
+}
+
+// Handle POST /api/v1/tests, the board is taken from the body's board_id
+// or matched by the SMBIOS tables in file_smbios
+func apiCreateTest(store *model.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var t model.Test
+
+		if err := decodeTestUpload(c, &t); err != nil {
+			apiError(c, http.StatusBadRequest, err)
+			return
+		}
+		if err := store.ForRequest(c).CreateTest(&t); err != nil {
+			apiStoreError(c, err)
+			return
+		}
+		apiRespondTest(c, http.StatusCreated, &t)
+	}
+}
+
+// Handle POST /api/v1/boards/:id/tests
+func apiCreateBoardTest(store *model.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var t model.Test
+
+		boardID, err := paramID(c, "id")
+		if err != nil {
+			apiError(c, http.StatusBadRequest, err)
+			return
+		}
+		if _, err := store.GetBoardByID(boardID); err != nil {
+			apiError(c, http.StatusNotFound, fmt.Errorf("Board %d not found", boardID))
+			return
+		}
+
+		if err := decodeTestUpload(c, &t); err != nil {
+			apiError(c, http.StatusBadRequest, err)
+			return
+		}
+		if t.BoardID != 0 && t.BoardID != uint(boardID) {
+			apiError(c, http.StatusUnprocessableEntity,
+				&model.ValidationError{Field: "board_id", Message: "doesn't match the board in the URL"})
+			return
+		}
+		t.BoardID = uint(boardID)
+
+		if err := store.ForRequest(c).CreateTest(&t); err != nil {
+			apiStoreError(c, err)
+			return
+		}
+		apiRespondTest(c, http.StatusCreated, &t)
+	}
+}
+
+// Handle GET /api/v1/tests/:id
+func apiShowTest(store *model.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := paramID(c, "id")
+		if err != nil {
+			apiError(c, http.StatusBadRequest, err)
+			return
+		}
+		t, err := store.GetTestByID(id)
+		if err != nil {
+			apiError(c, http.StatusNotFound, fmt.Errorf("Test %d not found", id))
+			return
+		}
+		apiRespondTest(c, http.StatusOK, t)
+	}
+}
+
+// Return the uploaded file part of a multipart request or the raw body
+func uploadReader(c *gin.Context, field string) (io.ReadCloser, error) {
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, apiMaxBodySize)
+	c.Request.Body = body
+
+	mediaType, _, _ := mime.ParseMediaType(c.ContentType())
+	if mediaType != "multipart/form-data" {
+		return body, nil
+	}
+
+	fh, err := c.FormFile(field)
+	if err != nil {
+		return nil, fmt.Errorf("Missing file %s: %v", field, err)
+	}
+	return fh.Open()
+}
+
+// Return a form value, or the query parameter for raw uploads
+func formOrQuery(c *gin.Context, key string) string {
+	if v, ok := c.GetPostForm(key); ok {
+		return v
+	}
+	return c.Query(key)
+}
+
+// Handle POST /api/v1/boards/:id/bundles and /api/v1/bundles
+// The bundle is the raw body or the multipart file "bundle". Without a board
+// ID the board is found by the bundle's vendor/board directory.
+func apiImportBundle(store *model.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var boardID int
+		var err error
+
+		if c.Param("id") != "" {
+			boardID, err = paramID(c, "id")
+			if err != nil {
+				apiError(c, http.StatusBadRequest, err)
+				return
+			}
+			if _, err := store.GetBoardByID(boardID); err != nil {
+				apiError(c, http.StatusNotFound, fmt.Errorf("Board %d not found", boardID))
+				return
+			}
+		}
+
+		r, err := uploadReader(c, "bundle")
+		if err != nil {
+			apiError(c, http.StatusBadRequest, err)
+			return
+		}
+		defer r.Close()
+
+		tmpl := model.Test{
+			Name:                        formOrQuery(c, "name"),
+			Status:                      formOrQuery(c, "status"),
+			StatusComment:               formOrQuery(c, "status_comment"),
+			Comment:                     formOrQuery(c, "comment"),
+			ReferenceExternalValidation: formOrQuery(c, model.ExternalRefField),
+		}
+
+		t, err := store.ForRequest(c).WithSource(model.SourceImport).ImportBoardStatusBundle(r, uint(boardID), tmpl)
+		if err != nil {
+			apiStoreError(c, err)
+			return
+		}
+		apiRespondTest(c, http.StatusCreated, t)
+	}
+}
+
+// Parse an optional numeric query parameter
+func queryUint(c *gin.Context, key string) (uint, error) {
+	v := c.Query(key)
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseUint(v, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid %s %q", key, v)
+	}
+	return uint(n), nil
+}
+
+// Handle GET /api/v1/testcases
+// Filters by name, result, board_id and test_id, paginated by limit and offset
+func apiFindTestCases(store *model.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		q := model.TestCaseQuery{
+			Name:   c.Query("name"),
+			Result: c.Query("result"),
+		}
+
+		for key, dst := range map[string]*uint{
+			"board_id": &q.BoardID,
+			"test_id":  &q.TestID,
+		} {
+			v, err := queryUint(c, key)
+			if err != nil {
+				apiError(c, http.StatusBadRequest, err)
+				return
+			}
+			*dst = v
+		}
+		for key, dst := range map[string]*int{
+			"limit":  &q.Limit,
+			"offset": &q.Offset,
+		} {
+			v, err := queryUint(c, key)
+			if err != nil {
+				apiError(c, http.StatusBadRequest, err)
+				return
+			}
+			*dst = int(v)
+		}
+
+		cases, err := store.FindTestCases(q)
+		if err != nil {
+			apiError(c, http.StatusInternalServerError, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"test_cases": cases})
+	}
+}
+
+// Handle POST /api/v1/boards/:id/lava
+// The body is a test whose exeternal_ref names the LAVA job, either by ID
+// or by its URL. Cases, boot log and status are fetched from the job. A
+// job that was imported before isn't imported again. Results attached as
+// multipart file "lava" are stored as is, without talking to LAVA.
+func apiImportLAVA(store *model.Store, client *lava.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var t model.Test
+
+		boardID, err := paramID(c, "id")
+		if err != nil {
+			apiError(c, http.StatusBadRequest, err)
+			return
+		}
+		if _, err := store.GetBoardByID(boardID); err != nil {
+			apiError(c, http.StatusNotFound, fmt.Errorf("Board %d not found", boardID))
+			return
+		}
+
+		if err := decodeTestUpload(c, &t); err != nil {
+			apiError(c, http.StatusBadRequest, err)
+			return
+		}
+		if t.BoardID != 0 && t.BoardID != uint(boardID) {
+			apiError(c, http.StatusUnprocessableEntity,
+				&model.ValidationError{Field: "board_id", Message: "doesn't match the board in the URL"})
+			return
+		}
+		t.BoardID = uint(boardID)
+
+		if len(t.Cases) == 0 {
+			id, err := client.JobID(t.ReferenceExternalValidation)
+			if err != nil {
+				apiError(c, http.StatusUnprocessableEntity,
+					&model.ValidationError{Field: model.ExternalRefField, Message: err.Error()})
+				return
+			}
+			if old, err := store.GetTestByExternalRef(t.BoardID, client.JobURL(id)); err == nil {
+				apiRespondTest(c, http.StatusOK, old)
+				return
+			}
+			if err := client.Import(&t); err != nil {
+				if model.IsValidationError(err) {
+					apiError(c, http.StatusUnprocessableEntity, err)
+				} else {
+					apiError(c, http.StatusBadGateway, err)
+				}
+				return
+			}
+		}
+
+		if err := store.ForRequest(c).WithSource(model.SourceImport).CreateTest(&t); err != nil {
+			apiStoreError(c, err)
+			return
+		}
+		apiRespondTest(c, http.StatusCreated, &t)
+	}
+}
+
+// Handle GET /api/v1/commits/:hash, the hash can be abbreviated
+func apiShowCommit(store *model.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		commit, err := store.GetCommitByHash(c.Param("hash"))
+		if err != nil {
+			apiError(c, http.StatusNotFound, fmt.Errorf("Commit %s not found", c.Param("hash")))
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"commit": commit})
+	}
+}
+
+// Handle GET /api/v1/boards/:id/history
+// Returns the tests of the board with their commits, newest commit first
+func apiBoardHistory(store *model.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		boardID, err := paramID(c, "id")
+		if err != nil {
+			apiError(c, http.StatusBadRequest, err)
+			return
+		}
+		if _, err := store.GetBoardByID(boardID); err != nil {
+			apiError(c, http.StatusNotFound, fmt.Errorf("Board %d not found", boardID))
+			return
+		}
+
+		tests, err := store.GetTestHistory(uint(boardID))
+		if err != nil {
+			apiError(c, http.StatusInternalServerError, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"tests": tests})
+	}
+}
+
+// Handle GET /api/v1/regressions
+// Filters by board_id, test_id and kind, paginated by limit and offset
+func apiFindRegressions(store *model.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		q := model.RegressionQuery{
+			Kind: c.Query("kind"),
+		}
+
+		for key, dst := range map[string]*uint{
+			"board_id": &q.BoardID,
+			"test_id":  &q.TestID,
+		} {
+			v, err := queryUint(c, key)
+			if err != nil {
+				apiError(c, http.StatusBadRequest, err)
+				return
+			}
+			*dst = v
+		}
+		for key, dst := range map[string]*int{
+			"limit":  &q.Limit,
+			"offset": &q.Offset,
+		} {
+			v, err := queryUint(c, key)
+			if err != nil {
+				apiError(c, http.StatusBadRequest, err)
+				return
+			}
+			*dst = int(v)
+		}
+
+		regs, err := store.FindRegressions(q)
+		if err != nil {
+			apiError(c, http.StatusInternalServerError, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"regressions": regs})
+	}
+}
+
+// Handle GET /api/v1/flaky
+// Returns the flaky test cases, of one board if board_id is given
+func apiFlakyCases(store *model.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		boardID, err := queryUint(c, "board_id")
+		if err != nil {
+			apiError(c, http.StatusBadRequest, err)
+			return
+		}
+		cases, err := store.GetFlakyCases(boardID)
+		if err != nil {
+			apiError(c, http.StatusInternalServerError, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"flaky_cases": cases})
+	}
+}
@@ -0,0 +1,190 @@
+// handlers.api_test.go
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/siro20/boardstatus/pkg/lava"
+	"github.com/siro20/boardstatus/pkg/model"
+)
+
+// Set up the routes on a migrated in-memory database with the uploader
+// "lab" and the board "qemu-x86"
+func newTestRouter(t *testing.T) (*model.Store, *model.Board) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	store, err := model.NewStore(model.StoreConfig{Path: ":memory:", BusyTimeout: time.Second, MaxOpenConns: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	if _, err := store.MigrateUp(); err != nil {
+		t.Fatal(err)
+	}
+
+	u := model.User{Username: "lab", Password: "lab-password", Role: model.RoleUploader}
+	if err := u.InsertIntoDB(store); err != nil {
+		t.Fatal(err)
+	}
+	b := model.Board{Name: "qemu-x86"}
+	if err := store.CreateBoard(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	router = gin.New()
+	router.LoadHTMLGlob("templates/*")
+	initializeRoutes(store, lava.NewClient("", ""), nil)
+	return store, &b
+}
+
+func TestAPICreateTest(t *testing.T) {
+	store, b := newTestRouter(t)
+	boardTests := fmt.Sprintf("/api/v1/boards/%d/tests", b.ID)
+
+	tests := []struct {
+		name        string
+		path        string
+		contentType string
+		body        string
+		noAuth      bool
+		code        int
+		field       string
+	}{
+		{
+			name:        "JSON",
+			path:        "/api/v1/tests",
+			contentType: "application/json",
+			body:        fmt.Sprintf(`{"name": "boot", "status": "PASS", "board_id": %d}`, b.ID),
+			code:        http.StatusCreated,
+		},
+		{
+			name:        "YAML",
+			path:        "/api/v1/tests",
+			contentType: "application/yaml",
+			body:        fmt.Sprintf("name: boot\nstatus: FAIL\nboard_id: %d\ntest_cases:\n  - {name: usb, result: fail}\n", b.ID),
+			code:        http.StatusCreated,
+		},
+		{
+			name: "YAML without content type",
+			path: boardTests,
+			body: "name: boot\nstatus: PASS\n",
+			code: http.StatusCreated,
+		},
+		{
+			name:        "JSON to the board",
+			path:        boardTests,
+			contentType: "application/json",
+			body:        `{"name": "boot", "status": "PASS"}`,
+			code:        http.StatusCreated,
+		},
+		{
+			name:        "invalid status",
+			path:        "/api/v1/tests",
+			contentType: "application/json",
+			body:        fmt.Sprintf(`{"name": "boot", "status": "BROKEN", "board_id": %d}`, b.ID),
+			code:        http.StatusUnprocessableEntity,
+			field:       "status",
+		},
+		{
+			name:        "without name",
+			path:        boardTests,
+			contentType: "application/json",
+			body:        `{"status": "PASS"}`,
+			code:        http.StatusUnprocessableEntity,
+			field:       "name",
+		},
+		{
+			name:        "other board",
+			path:        boardTests,
+			contentType: "application/json",
+			body:        fmt.Sprintf(`{"name": "boot", "status": "PASS", "board_id": %d}`, b.ID+1),
+			code:        http.StatusUnprocessableEntity,
+			field:       "board_id",
+		},
+		{
+			name:        "unknown board",
+			path:        fmt.Sprintf("/api/v1/boards/%d/tests", b.ID+1),
+			contentType: "application/json",
+			body:        `{"name": "boot", "status": "PASS"}`,
+			code:        http.StatusNotFound,
+		},
+		{
+			name:        "invalid JSON",
+			path:        "/api/v1/tests",
+			contentType: "application/json",
+			body:        `{"name": `,
+			code:        http.StatusBadRequest,
+		},
+		{
+			name:        "without credentials",
+			path:        "/api/v1/tests",
+			contentType: "application/json",
+			body:        fmt.Sprintf(`{"name": "boot", "status": "PASS", "board_id": %d}`, b.ID),
+			noAuth:      true,
+			code:        http.StatusUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			if !tt.noAuth {
+				req.SetBasicAuth("lab", "lab-password")
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != tt.code {
+				t.Fatalf("Status = %d, want %d: %s", w.Code, tt.code, w.Body)
+			}
+
+			var res struct {
+				Test   model.Test `json:"test"`
+				URL    string     `json:"url"`
+				Error  string     `json:"error"`
+				Fields []struct {
+					Field string `json:"field"`
+				} `json:"fields"`
+			}
+			if tt.code == http.StatusUnauthorized {
+				if w.Header().Get("WWW-Authenticate") == "" {
+					t.Errorf("No WWW-Authenticate header")
+				}
+				return
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+				t.Fatalf("Invalid response %s: %v", w.Body, err)
+			}
+			if tt.code != http.StatusCreated {
+				if res.Error == "" {
+					t.Errorf("No error message in %s", w.Body)
+				}
+				if tt.field != "" && (len(res.Fields) != 1 || res.Fields[0].Field != tt.field) {
+					t.Errorf("Fields = %v, want an error of %s", res.Fields, tt.field)
+				}
+				return
+			}
+
+			url := fmt.Sprintf("/api/v1/tests/%d", res.Test.ID)
+			if res.Test.ID == 0 || res.URL != url || w.Header().Get("Location") != url {
+				t.Errorf("URL = %q, Location = %q, want %q", res.URL, w.Header().Get("Location"), url)
+			}
+			stored, err := store.GetTestByID(int(res.Test.ID))
+			if err != nil {
+				t.Fatalf("The created test isn't stored: %v", err)
+			}
+			if stored.BoardID != b.ID || stored.Name != "boot" {
+				t.Errorf("Stored test of board %d named %q", stored.BoardID, stored.Name)
+			}
+		})
+	}
+}
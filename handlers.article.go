@@ -5,20 +5,25 @@ package main
 import (
 	"fmt"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/siro20/boardstatus/pkg/model"
+	"gopkg.in/yaml.v2"
 )
 
-func showIndexPage(c *gin.Context) {
-	articles, err := model.GetAllBoards()
-	if err != nil {
-		return
+func showIndexPage(store *model.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		articles, err := store.GetAllBoards()
+		if err != nil {
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+		// Call the render function with the name of the template to render
+		render(c, gin.H{
+			"title":   "Board status overview",
+			"payload": articles}, "index.html")
 	}
-	// Call the render function with the name of the template to render
-	render(c, gin.H{
-		"title":   "Board status overview",
-		"payload": articles}, "index.html")
 }
 
 func showArticleCreationPage(c *gin.Context) {
@@ -27,32 +32,65 @@ func showArticleCreationPage(c *gin.Context) {
 		"title": "Create New Board"}, "create-board.html")
 }
 
-func createArticle(c *gin.Context) {
+// Quote form values unless they're numbers, SMBIOS strings often contain
+// commas and colons
+func yamlScalar(v string) string {
+	if _, err := strconv.Atoi(v); err == nil || v == "" {
+		return v
+	}
+	return strconv.Quote(v)
+}
+
+func createArticle(store *model.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		createBoard(store, c)
+	}
+}
+
+func createBoard(store *model.Store, c *gin.Context) {
 	// Obtain the POSTed values
 	c.Request.ParseForm()
-	yaml := "{"
+	data := "{"
 
 	for key, value := range c.Request.PostForm {
-		yaml += key + ": "
+		data += key + ": "
 		if len(value) == 1 {
-			yaml += fmt.Sprintf("%s,", value[0])
+			data += fmt.Sprintf("%s,", yamlScalar(value[0]))
 		} else {
-			yaml += fmt.Sprintf("%s,", value)
+			data += fmt.Sprintf("%s,", value)
 		}
 	}
 
-	if yaml[len(yaml)-1] == ',' {
-		yaml = yaml[0 : len(yaml)-1]
+	if data[len(data)-1] == ',' {
+		data = data[0 : len(data)-1]
 	}
-	yaml += "}"
+	data += "}"
 
-	if b, err := model.CreateNewBoard(yaml); err == nil {
+	var b model.Board
+	err := yaml.Unmarshal([]byte(data), &b)
+	if err == nil {
+		err = store.ForRequest(c).CreateBoard(&b)
+	}
+	if err == nil {
 		// If the article is created successfully, show success message
 		render(c, gin.H{
 			"title":   "Submission Successful",
-			"payload": b}, "submission-successful.html")
-	} else {
-		// if there was an error while creating the article, abort with an error
-		c.AbortWithStatus(http.StatusBadRequest)
+			"payload": &b}, "submission-successful.html")
+		return
+	}
+	if model.IsValidationError(err) {
+		// Show the form again with the errors next to the fields
+		renderStatus(c, http.StatusUnprocessableEntity, gin.H{
+			"title":        "Create New Board",
+			"board":        &b,
+			"errors":       model.FieldErrorMap(err),
+			"ErrorTitle":   "Board not created",
+			"ErrorMessage": "Please correct the marked fields"}, "create-board.html")
+		return
 	}
+	renderStatus(c, http.StatusBadRequest, gin.H{
+		"title":        "Create New Board",
+		"board":        &b,
+		"ErrorTitle":   "Board not created",
+		"ErrorMessage": err.Error()}, "create-board.html")
 }
@@ -0,0 +1,128 @@
+// handlers.audit.go
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/siro20/boardstatus/pkg/model"
+)
+
+// The entries shown on one page of the audit log
+const auditPageSize = 100
+
+// Parse the filters of the audit log from the query. Filters by kind,
+// record_id, actor, action and source, since and until take days as
+// 2006-01-02, paginated by limit and offset.
+func auditQuery(c *gin.Context) (model.AuditQuery, error) {
+	q := model.AuditQuery{
+		Kind:   c.Query("kind"),
+		Actor:  c.Query("actor"),
+		Action: c.Query("action"),
+		Source: c.Query("source"),
+	}
+
+	id, err := queryUint(c, "record_id")
+	if err != nil {
+		return q, err
+	}
+	q.RecordID = id
+	for key, dst := range map[string]*int{
+		"limit":  &q.Limit,
+		"offset": &q.Offset,
+	} {
+		v, err := queryUint(c, key)
+		if err != nil {
+			return q, err
+		}
+		*dst = int(v)
+	}
+	for key, dst := range map[string]*time.Time{
+		"since": &q.Since,
+		"until": &q.Until,
+	} {
+		v := c.Query(key)
+		if v == "" {
+			continue
+		}
+		t, err := time.ParseInLocation("2006-01-02", v, time.Local)
+		if err != nil {
+			return q, fmt.Errorf("Invalid %s %q, expected a day like 2006-01-02", key, v)
+		}
+		*dst = t
+	}
+	return q, nil
+}
+
+// Handle GET /api/v1/audit
+// e.g. /api/v1/audit?kind=boards&record_id=1&since=2020-01-01
+func apiShowAudit(store *model.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		q, err := auditQuery(c)
+		if err != nil {
+			apiError(c, http.StatusBadRequest, err)
+			return
+		}
+		entries, err := store.FindAuditEntries(q)
+		if err != nil {
+			apiError(c, http.StatusInternalServerError, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"entries": entries})
+	}
+}
+
+// Handle GET /audit/
+// Takes the filters of the API, shows the page with the filter form
+func showAuditPage(store *model.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		data := gin.H{
+			"title":   "Audit log",
+			"kinds":   model.TrashKinds,
+			"actions": model.AuditActions,
+			"sources": model.AuditSources,
+			"filter": gin.H{
+				"kind":      c.Query("kind"),
+				"record_id": c.Query("record_id"),
+				"actor":     c.Query("actor"),
+				"action":    c.Query("action"),
+				"source":    c.Query("source"),
+				"since":     c.Query("since"),
+				"until":     c.Query("until"),
+			},
+		}
+
+		q, err := auditQuery(c)
+		if err != nil {
+			data["ErrorTitle"] = "Invalid filter"
+			data["ErrorMessage"] = err.Error()
+			renderStatus(c, http.StatusBadRequest, data, "audit.html")
+			return
+		}
+		if q.Limit == 0 {
+			q.Limit = auditPageSize
+		}
+		entries, err := store.FindAuditEntries(q)
+		if err != nil {
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+		data["payload"] = entries
+
+		// Link the next page while pages are full
+		if len(entries) == q.Limit {
+			next := url.Values{}
+			for k, v := range c.Request.URL.Query() {
+				next[k] = v
+			}
+			next.Set("offset", strconv.Itoa(q.Offset+len(entries)))
+			data["next"] = "/audit/?" + next.Encode()
+		}
+		renderStatus(c, http.StatusOK, data, "audit.html")
+	}
+}
@@ -0,0 +1,90 @@
+// handlers.bisect.go
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+
+	"github.com/gin-gonic/gin"
+	"github.com/siro20/boardstatus/pkg/git"
+	"github.com/siro20/boardstatus/pkg/model"
+)
+
+// Compute the bisect range of the board given by :id. The bounds default to
+// the newest passing commit and the oldest failing one after it, they can
+// be overridden with the query parameters good and bad. Returns the HTTP
+// status to fail with along with the error.
+func boardBisect(store *model.Store, repo *git.Repo, c *gin.Context) (*model.Board, *git.Bisect, int, error) {
+	id, err := paramID(c, "id")
+	if err != nil {
+		return nil, nil, http.StatusBadRequest, err
+	}
+	board, err := store.GetBoardByID(id)
+	if err != nil {
+		return nil, nil, http.StatusNotFound, fmt.Errorf("Board %d not found", id)
+	}
+	if repo == nil {
+		return board, nil, http.StatusServiceUnavailable, fmt.Errorf("No git repository configured")
+	}
+
+	good, bad, err := store.BisectBounds(board.ID)
+	if err != nil {
+		return board, nil, http.StatusInternalServerError, err
+	}
+	if v := c.Query("good"); v != "" {
+		good = v
+	}
+	if v := c.Query("bad"); v != "" {
+		bad = v
+	}
+	if good == "" || bad == "" {
+		return board, nil, http.StatusUnprocessableEntity,
+			fmt.Errorf("Nothing to bisect, board %s needs a passing and a later failing test", board.Name)
+	}
+
+	dir := ""
+	if board.MainboardDir != "" {
+		dir = path.Join("src/mainboard", board.MainboardDir)
+	}
+	b, err := repo.Bisect(good, bad, dir)
+	if err != nil {
+		return board, nil, http.StatusUnprocessableEntity, err
+	}
+	return board, b, http.StatusOK, nil
+}
+
+// Handle GET /board/bisect/:id
+func showBisectPage(store *model.Store, repo *git.Repo) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		board, b, code, err := boardBisect(store, repo, c)
+		if board == nil {
+			c.AbortWithError(code, err)
+			return
+		}
+
+		data := gin.H{
+			"title":   "Bisect " + board.Name,
+			"board":   board,
+			"payload": b,
+		}
+		if err != nil {
+			data["ErrorTitle"] = "Can't bisect"
+			data["ErrorMessage"] = err.Error()
+		}
+		render(c, data, "bisect.html")
+	}
+}
+
+// Handle GET /api/v1/boards/:id/bisect
+func apiBoardBisect(store *model.Store, repo *git.Repo) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, b, code, err := boardBisect(store, repo, c)
+		if err != nil {
+			apiError(c, code, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"bisect": b})
+	}
+}
@@ -0,0 +1,136 @@
+// handlers.boottime.go
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/siro20/boardstatus/pkg/model"
+)
+
+// Size of the boot time chart in pixels
+const (
+	chartWidth  = 800
+	chartHeight = 300
+	chartMargin = 40
+)
+
+// Draw the boot times as line chart, oldest test left
+func bootTimeSVG(title string, points []model.BootTimePoint) []byte {
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif" font-size="12">`,
+		chartWidth, chartHeight, chartWidth, chartHeight)
+	fmt.Fprintf(&buf, `<text x="%d" y="20">%s</text>`, chartMargin, html.EscapeString(title))
+
+	var max int64
+	for _, p := range points {
+		if p.Value > max {
+			max = p.Value
+		}
+	}
+	if len(points) == 0 || max == 0 {
+		fmt.Fprintf(&buf, `<text x="%d" y="%d">No boot times</text></svg>`, chartMargin, chartHeight/2)
+		return buf.Bytes()
+	}
+	top := float64(max) * 1.1
+
+	plotW := float64(chartWidth - 2*chartMargin)
+	plotH := float64(chartHeight - 2*chartMargin)
+	x := func(i int) float64 {
+		if len(points) == 1 {
+			return chartMargin + plotW/2
+		}
+		return chartMargin + plotW*float64(i)/float64(len(points)-1)
+	}
+	y := func(v int64) float64 {
+		return chartMargin + plotH*(1-float64(v)/top)
+	}
+
+	// Axes with the scale in milliseconds
+	fmt.Fprintf(&buf, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="black"/>`,
+		chartMargin, chartMargin, chartMargin, chartHeight-chartMargin)
+	fmt.Fprintf(&buf, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="black"/>`,
+		chartMargin, chartHeight-chartMargin, chartWidth-chartMargin, chartHeight-chartMargin)
+	for _, f := range []float64{0, 0.5, 1} {
+		v := int64(top * f)
+		fmt.Fprintf(&buf, `<text x="2" y="%.1f">%d ms</text>`, y(v)+4, v/1000)
+	}
+
+	fmt.Fprintf(&buf, `<polyline fill="none" stroke="steelblue" stroke-width="2" points="`)
+	for i, p := range points {
+		fmt.Fprintf(&buf, "%.1f,%.1f ", x(i), y(p.Value))
+	}
+	fmt.Fprintf(&buf, `"/>`)
+
+	for i, p := range points {
+		fmt.Fprintf(&buf, `<a href="/test/view/%d"><circle cx="%.1f" cy="%.1f" r="4" fill="steelblue"><title>%s: %.1f ms</title></circle></a>`,
+			p.TestID, x(i), y(p.Value), html.EscapeString(p.Label), float64(p.Value)/1000)
+	}
+
+	// Label the oldest and newest commit
+	fmt.Fprintf(&buf, `<text x="%d" y="%d">%s</text>`,
+		chartMargin, chartHeight-chartMargin+16, html.EscapeString(points[0].Label))
+	fmt.Fprintf(&buf, `<text x="%d" y="%d" text-anchor="end">%s</text>`,
+		chartWidth-chartMargin, chartHeight-chartMargin+16, html.EscapeString(points[len(points)-1].Label))
+
+	buf.WriteString(`</svg>`)
+	return buf.Bytes()
+}
+
+// Load the boot times of the board given by :id, limited to the newest
+// limit tests and the stage given as query parameters
+func boardBootTimes(store *model.Store, c *gin.Context) (*model.Board, []model.BootTimePoint, int, error) {
+	id, err := paramID(c, "id")
+	if err != nil {
+		return nil, nil, http.StatusBadRequest, err
+	}
+	board, err := store.GetBoardByID(id)
+	if err != nil {
+		return nil, nil, http.StatusNotFound, fmt.Errorf("Board %d not found", id)
+	}
+
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if limit <= 0 {
+		limit = 50
+	}
+	points, err := store.GetBootTimeHistory(board.ID, c.Query("stage"), limit)
+	if err != nil {
+		return nil, nil, http.StatusInternalServerError, err
+	}
+	return board, points, http.StatusOK, nil
+}
+
+// Handle GET /board/boottime/:id, an SVG chart of the boot time
+func showBootTimeChart(store *model.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		board, points, code, err := boardBootTimes(store, c)
+		if err != nil {
+			c.AbortWithError(code, err)
+			return
+		}
+
+		title := "Boot time of " + board.Name
+		if stage := c.Query("stage"); stage != "" {
+			title = stage + " on " + board.Name
+		}
+		c.Data(http.StatusOK, "image/svg+xml", bootTimeSVG(title, points))
+	}
+}
+
+// Handle GET /api/v1/boards/:id/boottime
+func apiBoardBootTime(store *model.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, points, code, err := boardBootTimes(store, c)
+		if err != nil {
+			apiError(c, code, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"boot_times": points})
+	}
+}
@@ -0,0 +1,107 @@
+// handlers.config.go
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/siro20/boardstatus/pkg/model"
+)
+
+// Handle GET /api/v1/tests/:id/config/diff
+// Compares the .config of the test with the one of the test given by
+// against, by default the previous test of the board
+func apiConfigDiff(store *model.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		t, against, code, err := comparedTests(store, c)
+		if err != nil {
+			apiError(c, code, err)
+			return
+		}
+		if _, err := store.GetTestByID(int(against)); err != nil {
+			apiError(c, http.StatusNotFound, fmt.Errorf("Test %d not found", against))
+			return
+		}
+
+		changes, err := store.ConfigDiff(against, t.ID)
+		if err != nil {
+			apiError(c, http.StatusInternalServerError, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"old_test_id": against,
+			"new_test_id": t.ID,
+			"changes":     changes,
+		})
+	}
+}
+
+// Handle GET /api/v1/config
+// Returns the boards last tested with the config option given by option set
+// to value, e.g. ?option=CONFIG_USE_BLOBS&value=y. Without value all boards
+// are returned with their value of the option.
+func apiFindBoardsByConfig(store *model.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		option := c.Query("option")
+		if option == "" {
+			apiError(c, http.StatusBadRequest, fmt.Errorf("Query parameter option is required"))
+			return
+		}
+
+		boards, err := store.FindBoardsByConfig(option, c.Query("value"))
+		if err != nil {
+			apiError(c, http.StatusInternalServerError, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"boards": boards})
+	}
+}
+
+// Handle GET /api/v1/tests/:id/cmos
+// Returns the CMOS dump of the test decoded with its cmos.layout
+func apiShowCMOS(store *model.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := paramID(c, "id")
+		if err != nil {
+			apiError(c, http.StatusBadRequest, err)
+			return
+		}
+		if _, err := store.GetTestByID(id); err != nil {
+			apiError(c, http.StatusNotFound, fmt.Errorf("Test %d not found", id))
+			return
+		}
+
+		cmos, err := store.DecodeCMOS(uint(id))
+		if err != nil {
+			apiError(c, http.StatusUnprocessableEntity, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"cmos": cmos})
+	}
+}
+
+// Handle GET /api/v1/tests/:id/cmos/diff
+// Compares the CMOS options of the test with the ones of the test given by
+// against, by default the previous test of the board
+func apiCMOSDiff(store *model.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		t, against, code, err := comparedTests(store, c)
+		if err != nil {
+			apiError(c, code, err)
+			return
+		}
+
+		changes, err := store.CMOSDiff(against, t.ID)
+		if err != nil {
+			apiError(c, http.StatusUnprocessableEntity, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"old_test_id": against,
+			"new_test_id": t.ID,
+			"changes":     changes,
+		})
+	}
+}
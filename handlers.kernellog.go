@@ -0,0 +1,85 @@
+// handlers.kernellog.go
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/siro20/boardstatus/pkg/model"
+)
+
+// Return the test given by :id and the ID of the test to compare it with,
+// given by the query parameter against. It defaults to the previous test of
+// the same board. Returns the HTTP status to fail with along with the error.
+func comparedTests(store *model.Store, c *gin.Context) (*model.Test, uint, int, error) {
+	id, err := paramID(c, "id")
+	if err != nil {
+		return nil, 0, http.StatusBadRequest, err
+	}
+	t, err := store.GetTestByID(id)
+	if err != nil {
+		return nil, 0, http.StatusNotFound, fmt.Errorf("Test %d not found", id)
+	}
+
+	against, err := queryUint(c, "against")
+	if err != nil {
+		return nil, 0, http.StatusBadRequest, err
+	}
+	if against == 0 {
+		if against, err = store.PreviousTestID(t); err != nil {
+			return nil, 0, http.StatusInternalServerError, err
+		}
+		if against == 0 {
+			return nil, 0, http.StatusUnprocessableEntity,
+				fmt.Errorf("Test %d is the oldest of its board, nothing to compare with", t.ID)
+		}
+	}
+	return t, against, http.StatusOK, nil
+}
+
+// Diff the kernel logs of the tests selected by comparedTests
+func testKernelLogDiff(store *model.Store, c *gin.Context) (*model.KernelLogDiff, int, error) {
+	t, against, code, err := comparedTests(store, c)
+	if err != nil {
+		return nil, code, err
+	}
+	d, err := store.DiffKernelLogs(against, t.ID)
+	if err != nil {
+		return nil, http.StatusNotFound, err
+	}
+	return d, http.StatusOK, nil
+}
+
+// Handle GET /test/diff/:id
+func showKernelLogDiff(store *model.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		d, code, err := testKernelLogDiff(store, c)
+		if err != nil {
+			c.AbortWithError(code, err)
+			return
+		}
+		render(c, gin.H{
+			"title":   fmt.Sprintf("Kernel log of test %d against %d", d.NewTestID, d.OldTestID),
+			"payload": d,
+		}, "kernellog.html")
+	}
+}
+
+// Handle GET /api/v1/tests/:id/kernel-log/diff
+// With format=text the diff is returned in unified format.
+func apiKernelLogDiff(store *model.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		d, code, err := testKernelLogDiff(store, c)
+		if err != nil {
+			apiError(c, code, err)
+			return
+		}
+		if c.Query("format") == "text" {
+			c.String(http.StatusOK, d.Unified())
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"diff": d})
+	}
+}
@@ -0,0 +1,94 @@
+// handlers.maintainers.go
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+	"github.com/siro20/boardstatus/pkg/model"
+)
+
+// The body of PUT /api/v1/boards/:id/maintainers
+type maintainersBody struct {
+	Maintainers []string `json:"maintainers" yaml:"maintainers"`
+}
+
+// Handle GET /api/v1/boards/:id/maintainers
+func apiShowMaintainers(store *model.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := paramID(c, "id")
+		if err != nil {
+			apiError(c, http.StatusBadRequest, err)
+			return
+		}
+		if _, err := store.GetBoardByID(id); err != nil {
+			apiError(c, http.StatusNotFound, fmt.Errorf("Board %d not found", id))
+			return
+		}
+		users, err := store.BoardMaintainers(uint(id))
+		if err != nil {
+			apiError(c, http.StatusInternalServerError, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"maintainers": users})
+	}
+}
+
+// Handle PUT /api/v1/boards/:id/maintainers
+// The body lists the usernames of all maintainers, e.g.
+// {"maintainers": ["alice", "bob"]}
+func apiSetMaintainers(store *model.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := paramID(c, "id")
+		if err != nil {
+			apiError(c, http.StatusBadRequest, err)
+			return
+		}
+		var body maintainersBody
+		if err := decodeBody(c, &body); err != nil {
+			apiError(c, http.StatusBadRequest, err)
+			return
+		}
+		err = store.ForRequest(c).SetBoardMaintainers(uint(id), body.Maintainers)
+		if gorm.IsRecordNotFoundError(err) {
+			apiError(c, http.StatusNotFound, fmt.Errorf("Board %d not found", id))
+			return
+		} else if err != nil {
+			apiStoreError(c, err)
+			return
+		}
+		apiShowMaintainers(store)(c)
+	}
+}
+
+// Handle POST /board/maintainers/:id
+// The form field maintainers lists the usernames separated by commas
+func setMaintainersForm(store *model.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := paramID(c, "id")
+		if err != nil {
+			c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+		names := strings.Split(c.PostForm("maintainers"), ",")
+		err = store.ForRequest(c).SetBoardMaintainers(uint(id), names)
+		switch {
+		case err == nil:
+			c.Redirect(http.StatusSeeOther, fmt.Sprintf("/board/view/%d", id))
+		case gorm.IsRecordNotFoundError(err):
+			c.AbortWithError(http.StatusNotFound, err)
+		case model.IsValidationError(err):
+			c.Error(err)
+			renderStatus(c, http.StatusUnprocessableEntity, gin.H{
+				"title":        "Maintainers not saved",
+				"ErrorTitle":   "Maintainers not saved",
+				"ErrorMessage": err.Error()}, "error.html")
+		default:
+			c.AbortWithError(http.StatusInternalServerError, err)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+// handlers.matrix.go
+
+package main
+
+import (
+	"encoding/csv"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/siro20/boardstatus/pkg/model"
+)
+
+// Read the matrix filter from the query parameters
+func matrixFilter(c *gin.Context) model.MatrixFilter {
+	f := model.MatrixFilter{
+		Manufacturer: c.Query("manufacturer"),
+		BoardType:    c.Query("board_type"),
+		Family:       c.Query("family"),
+		Tags:         c.Query("columns") == "tags",
+	}
+	f.Limit, _ = strconv.Atoi(c.Query("limit"))
+	return f
+}
+
+// Write the matrix as CSV, one row per board, one column per commit
+func writeMatrixCSV(c *gin.Context, m *model.Matrix) {
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", `attachment; filename="matrix.csv"`)
+	c.Status(http.StatusOK)
+
+	w := csv.NewWriter(c.Writer)
+	header := []string{"board"}
+	for _, col := range m.Columns {
+		header = append(header, col.Label)
+	}
+	w.Write(header)
+
+	for _, row := range m.Rows {
+		record := []string{row.Board}
+		for _, cell := range row.Cells {
+			if cell == nil {
+				record = append(record, "")
+			} else {
+				record = append(record, cell.Status)
+			}
+		}
+		w.Write(record)
+	}
+	w.Flush()
+}
+
+// Handle GET /matrix
+// Responds with CSV for format=csv or Accept: text/csv, JSON for
+// format=json or Accept: application/json and HTML otherwise
+func showMatrixPage(store *model.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		f := matrixFilter(c)
+		m, err := store.GetMatrix(f)
+		if err != nil {
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+
+		switch {
+		case c.Query("format") == "csv" || c.GetHeader("Accept") == "text/csv":
+			writeMatrixCSV(c, m)
+		case c.Query("format") == "json":
+			c.JSON(http.StatusOK, m)
+		default:
+			render(c, gin.H{
+				"title":   "Board status matrix",
+				"filter":  f,
+				"payload": m}, "matrix.html")
+		}
+	}
+}
@@ -0,0 +1,157 @@
+// handlers.matrix_test.go
+
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/siro20/boardstatus/pkg/model"
+)
+
+// Turn the JSON matrix into records like the CSV ones
+func matrixRecords(t *testing.T, body []byte) [][]string {
+	t.Helper()
+	var m model.Matrix
+	if err := json.Unmarshal(body, &m); err != nil {
+		t.Fatalf("Invalid matrix %s: %v", body, err)
+	}
+	header := []string{"board"}
+	for _, col := range m.Columns {
+		header = append(header, col.Label)
+	}
+	records := [][]string{header}
+	for _, row := range m.Rows {
+		record := []string{row.Board}
+		for _, cell := range row.Cells {
+			if cell == nil {
+				record = append(record, "")
+			} else {
+				record = append(record, cell.Status)
+			}
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestMatrixOutput(t *testing.T) {
+	store, qemu := newTestRouter(t)
+	apu := model.Board{Name: "apu2", Manufacturer: "PC Engines"}
+	if err := store.CreateBoard(&apu); err != nil {
+		t.Fatal(err)
+	}
+
+	first := strings.Repeat("a", 40)
+	second := strings.Repeat("b", 40)
+	start := time.Date(2020, 5, 1, 0, 0, 0, 0, time.UTC)
+	for _, test := range []model.Test{
+		{BoardID: qemu.ID, Status: "PASS", TestedCommit: first, NameOfTestedCommit: "4.12-1-gaaaaaaa", TestedCommitTime: start},
+		{BoardID: qemu.ID, Status: "FAIL", TestedCommit: second, NameOfTestedCommit: "4.12-2-gbbbbbbb", TestedCommitTime: start.AddDate(0, 0, 1)},
+		{BoardID: apu.ID, Status: "PASS", TestedCommit: second, NameOfTestedCommit: "4.12-2-gbbbbbbb", TestedCommitTime: start.AddDate(0, 0, 1)},
+	} {
+		test.Name = "boot"
+		if err := store.CreateTest(&test); err != nil {
+			t.Fatalf("CreateTest: %v", err)
+		}
+	}
+
+	commits := [][]string{
+		{"board", "4.12-2-gbbbbbbb", "4.12-1-gaaaaaaa"},
+		{"apu2", "PASS", ""},
+		{"qemu-x86", "FAIL", "PASS"},
+	}
+	tests := []struct {
+		name        string
+		url         string
+		accept      string
+		contentType string
+		want        [][]string
+	}{
+		{
+			name:        "JSON",
+			url:         "/matrix?format=json",
+			contentType: "application/json",
+			want:        commits,
+		},
+		{
+			name:        "JSON by Accept",
+			url:         "/matrix",
+			accept:      "application/json",
+			contentType: "application/json",
+			want:        commits,
+		},
+		{
+			name:        "CSV",
+			url:         "/matrix?format=csv",
+			contentType: "text/csv",
+			want:        commits,
+		},
+		{
+			name:        "CSV by Accept",
+			url:         "/matrix",
+			accept:      "text/csv",
+			contentType: "text/csv",
+			want:        commits,
+		},
+		{
+			name:        "tags",
+			url:         "/matrix?format=csv&columns=tags",
+			contentType: "text/csv",
+			want:        [][]string{{"board", "4.12"}, {"apu2", "PASS"}, {"qemu-x86", "FAIL"}},
+		},
+		{
+			name:        "limit",
+			url:         "/matrix?format=json&limit=1",
+			contentType: "application/json",
+			want:        [][]string{{"board", "4.12-2-gbbbbbbb"}, {"apu2", "PASS"}, {"qemu-x86", "FAIL"}},
+		},
+		{
+			name:        "manufacturer",
+			url:         "/matrix?format=csv&manufacturer=PC+Engines",
+			contentType: "text/csv",
+			want:        [][]string{{"board", "4.12-2-gbbbbbbb"}, {"apu2", "PASS"}},
+		},
+		{
+			name:        "no boards",
+			url:         "/matrix?format=csv&family=none",
+			contentType: "text/csv",
+			want:        [][]string{{"board"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != http.StatusOK {
+				t.Fatalf("Status = %d: %s", w.Code, w.Body)
+			}
+			if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, tt.contentType) {
+				t.Fatalf("Content-Type = %q, want %q", ct, tt.contentType)
+			}
+
+			var got [][]string
+			if tt.contentType == "text/csv" {
+				var err error
+				if got, err = csv.NewReader(w.Body).ReadAll(); err != nil {
+					t.Fatalf("Invalid CSV %s: %v", w.Body, err)
+				}
+			} else {
+				got = matrixRecords(t, w.Body.Bytes())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Matrix = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
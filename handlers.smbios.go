@@ -0,0 +1,95 @@
+// handlers.smbios.go
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/siro20/boardstatus/pkg/model"
+	"github.com/siro20/boardstatus/pkg/parser"
+)
+
+// Parse the SMBIOS tables of the request, given as multipart file
+// "smbios", form value "dmidecode" or raw body
+func readSMBIOSUpload(c *gin.Context) (*parser.SMBIOS, error) {
+	if c.ContentType() == "multipart/form-data" {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, apiMaxBodySize)
+		if v := c.PostForm("dmidecode"); v != "" {
+			return parser.ParseSMBIOS([]byte(v))
+		}
+	}
+
+	r, err := uploadReader(c, "smbios")
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return parser.ParseSMBIOS(data)
+}
+
+// Handle POST /board/create/smbios
+// Shows the board creation page filled in from the SMBIOS tables
+func showBoardFromSMBIOS(store *model.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		data := gin.H{"title": "Create New Board"}
+
+		sm, err := readSMBIOSUpload(c)
+		if err != nil {
+			data["ErrorTitle"] = "Can't read the SMBIOS tables"
+			data["ErrorMessage"] = err.Error()
+			render(c, data, "create-board.html")
+			return
+		}
+
+		data["board"] = model.BoardFromSMBIOS(sm)
+		if matches, err := store.MatchBoards(model.BoardQueryFromSMBIOS(sm)); err == nil {
+			data["matches"] = matches
+		}
+		render(c, data, "create-board.html")
+	}
+}
+
+// Handle GET and POST /api/v1/boards/lookup
+// Finds the board by the query parameters manufacturer, product_name,
+// version and sku, or by the SMBIOS tables POSTed like to
+// /board/create/smbios
+func apiLookupBoard(store *model.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var q model.BoardQuery
+
+		if c.Request.Method == http.MethodPost {
+			sm, err := readSMBIOSUpload(c)
+			if err != nil {
+				apiError(c, http.StatusBadRequest, err)
+				return
+			}
+			q = model.BoardQueryFromSMBIOS(sm)
+		} else if err := c.BindQuery(&q); err != nil {
+			apiError(c, http.StatusBadRequest, err)
+			return
+		}
+
+		boards, err := store.MatchBoards(q)
+		if err != nil {
+			apiStoreError(c, err)
+			return
+		}
+		if len(boards) == 0 {
+			apiError(c, http.StatusNotFound, fmt.Errorf("No board matches %s %s", q.Manufacturer, q.ProductName))
+			return
+		}
+
+		res := gin.H{"query": q, "boards": boards}
+		if b, err := store.MatchBoard(q); err == nil {
+			res["board"] = b
+		}
+		c.JSON(http.StatusOK, res)
+	}
+}
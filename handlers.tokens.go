@@ -0,0 +1,154 @@
+// handlers.tokens.go
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+	"github.com/siro20/boardstatus/pkg/model"
+)
+
+// Tokens expire after this many days unless told otherwise
+const defaultTokenDays = 90
+
+// The body of POST /api/v1/tokens
+type tokenBody struct {
+	Name          string   `json:"name" yaml:"name"`
+	Scopes        []string `json:"scopes" yaml:"scopes"`
+	ExpiresInDays int      `json:"expires_in_days" yaml:"expires_in_days"`
+}
+
+// Handle GET /api/v1/tokens
+// Lists the tokens of the user, without the tokens themselves
+func apiListTokens(store *model.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokens, err := store.APITokens(currentUser(c).ID)
+		if err != nil {
+			apiError(c, http.StatusInternalServerError, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"tokens": tokens})
+	}
+}
+
+// Handle POST /api/v1/tokens
+// Responds with the new token, it isn't shown again. Tokens can create
+// other tokens only with the admin scope.
+func apiCreateToken(store *model.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if t := currentToken(c); t != nil && !t.Allows(model.PermAdmin) {
+			apiError(c, http.StatusForbidden, fmt.Errorf("The API token %q doesn't have the admin scope", t.Name))
+			return
+		}
+		var body tokenBody
+		if err := decodeBody(c, &body); err != nil {
+			apiError(c, http.StatusBadRequest, err)
+			return
+		}
+		if body.ExpiresInDays == 0 {
+			body.ExpiresInDays = defaultTokenDays
+		}
+
+		t, token, err := store.ForRequest(c).CreateAPIToken(currentUser(c).ID, body.Name, body.Scopes, body.ExpiresInDays)
+		if err != nil {
+			apiStoreError(c, err)
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{"token": token, "api_token": t})
+	}
+}
+
+// Handle DELETE /api/v1/tokens/:id
+// Revokes the token of the user
+func apiRevokeToken(store *model.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		code, err := revokeToken(store, c)
+		if err != nil {
+			apiError(c, code, err)
+			return
+		}
+		c.Status(code)
+	}
+}
+
+func revokeToken(store *model.Store, c *gin.Context) (int, error) {
+	id, err := paramID(c, "id")
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	err = store.ForRequest(c).RevokeAPIToken(currentUser(c).ID, uint(id))
+	switch {
+	case err == nil:
+		return http.StatusNoContent, nil
+	case gorm.IsRecordNotFoundError(err):
+		return http.StatusNotFound, fmt.Errorf("You have no API token with ID %d", id)
+	}
+	return http.StatusInternalServerError, err
+}
+
+// Handle GET /tokens/
+func showTokensPage(store *model.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		showTokens(store, c, http.StatusOK, gin.H{})
+	}
+}
+
+func showTokens(store *model.Store, c *gin.Context, code int, data gin.H) {
+	u := currentUser(c)
+	if u == nil {
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	tokens, err := store.APITokens(u.ID)
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	data["title"] = "API tokens"
+	data["scopes"] = model.TokenScopeNames
+	data["default_days"] = defaultTokenDays
+	data["payload"] = tokens
+	renderStatus(c, code, data, "tokens.html")
+}
+
+// Handle POST /tokens/
+// Shows the page with the new token, or with the errors
+func createTokenForm(store *model.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		days, err := strconv.Atoi(c.DefaultPostForm("expires_in_days", strconv.Itoa(defaultTokenDays)))
+		if err != nil {
+			days = 0
+		}
+		t, token, err := store.ForRequest(c).CreateAPIToken(currentUser(c).ID,
+			c.PostForm("name"), c.PostFormArray("scopes"), days)
+		switch {
+		case err == nil:
+			showTokens(store, c, http.StatusCreated, gin.H{"new_token": token, "new_name": t.Name})
+		case model.IsValidationError(err):
+			showTokens(store, c, http.StatusUnprocessableEntity, gin.H{
+				"ErrorTitle":   "Token not created",
+				"ErrorMessage": err.Error()})
+		default:
+			c.AbortWithError(http.StatusInternalServerError, err)
+		}
+	}
+}
+
+// Handle POST /tokens/:id/revoke
+func revokeTokenForm(store *model.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		code, err := revokeToken(store, c)
+		if err != nil {
+			c.Error(err)
+			showTokens(store, c, code, gin.H{
+				"ErrorTitle":   "Not revoked",
+				"ErrorMessage": err.Error()})
+			return
+		}
+		c.Redirect(http.StatusSeeOther, "/tokens/")
+	}
+}
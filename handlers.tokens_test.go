@@ -0,0 +1,135 @@
+// handlers.tokens_test.go
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/siro20/boardstatus/pkg/model"
+)
+
+// Send the request with the Bearer token, or as the user "lab" without one
+func tokenRequest(method, path, body, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	} else {
+		req.SetBasicAuth("lab", "lab-password")
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// Create a token of "lab" through the API
+func createToken(t *testing.T, body string) (model.APIToken, string) {
+	t.Helper()
+	w := tokenRequest(http.MethodPost, "/api/v1/tokens", body, "")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Creating a token: %d %s", w.Code, w.Body)
+	}
+	var res struct {
+		Token    string         `json:"token"`
+		APIToken model.APIToken `json:"api_token"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	return res.APIToken, res.Token
+}
+
+func TestAPITokens(t *testing.T) {
+	store, b := newTestRouter(t)
+	lab, err := store.GetUserByName("lab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	upload := fmt.Sprintf(`{"name": "boot", "status": "PASS", "board_id": %d}`, b.ID)
+
+	uploadToken, uploadPlain := createToken(t, `{"name": "lab CI", "scopes": ["upload-tests"]}`)
+	if days := time.Until(uploadToken.ExpiresAt).Hours() / 24; days < 89 || days > 90 {
+		t.Errorf("Token expires in %.1f days, want the default of 90", days)
+	}
+	_, editPlain := createToken(t, `{"name": "boards", "scopes": ["edit-boards"], "expires_in_days": 1}`)
+	expired, expiredPlain := createToken(t, `{"name": "expired", "scopes": ["upload-tests"]}`)
+	err = store.DB().Model(&model.APIToken{}).Where("id = ?", expired.ID).
+		UpdateColumn("expires_at", time.Now().Add(-time.Second)).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	revoked, revokedPlain := createToken(t, `{"name": "revoked", "scopes": ["upload-tests"]}`)
+	if w := tokenRequest(http.MethodDelete, fmt.Sprintf("/api/v1/tokens/%d", revoked.ID), "", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("Revoking the token: %d %s", w.Code, w.Body)
+	}
+	if w := tokenRequest(http.MethodDelete, "/api/v1/tokens/999", "", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Revoking an unknown token: %d, want 404", w.Code)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		token  string
+		code   int
+	}{
+		{name: "upload", method: http.MethodPost, path: "/api/v1/tests", body: upload, token: uploadPlain, code: http.StatusCreated},
+		{name: "upload to the board", method: http.MethodPost, path: fmt.Sprintf("/api/v1/boards/%d/tests", b.ID), body: `{"name": "boot", "status": "PASS"}`, token: uploadPlain, code: http.StatusCreated},
+		{name: "upload without scope", method: http.MethodPost, path: "/api/v1/tests", body: upload, token: editPlain, code: http.StatusForbidden},
+		{name: "account without scope", method: http.MethodPatch, path: fmt.Sprintf("/api/v1/users/%d", lab.ID), body: `{"name": "Lab"}`, token: uploadPlain, code: http.StatusForbidden},
+		{name: "token without admin scope", method: http.MethodPost, path: "/api/v1/tokens", body: `{"name": "more", "scopes": ["admin"]}`, token: uploadPlain, code: http.StatusForbidden},
+		{name: "reading", method: http.MethodGet, path: "/api/v1/tokens", token: editPlain, code: http.StatusOK},
+		{name: "expired", method: http.MethodPost, path: "/api/v1/tests", body: upload, token: expiredPlain, code: http.StatusUnauthorized},
+		{name: "revoked", method: http.MethodPost, path: "/api/v1/tests", body: upload, token: revokedPlain, code: http.StatusUnauthorized},
+		{name: "unknown", method: http.MethodPost, path: "/api/v1/tests", body: upload, token: "bst_unknown", code: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := tokenRequest(tt.method, tt.path, tt.body, tt.token)
+			if w.Code != tt.code {
+				t.Fatalf("Status = %d, want %d: %s", w.Code, tt.code, w.Body)
+			}
+			if tt.code == http.StatusUnauthorized && !strings.HasPrefix(w.Header().Get("WWW-Authenticate"), "Bearer") {
+				t.Errorf("WWW-Authenticate = %q", w.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+
+	// The tokens are listed without their plaintext, the used one with the
+	// time it was last used
+	w := tokenRequest(http.MethodGet, "/api/v1/tokens", "", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Listing the tokens: %d %s", w.Code, w.Body)
+	}
+	for _, plain := range []string{uploadPlain, editPlain, expiredPlain, revokedPlain} {
+		if strings.Contains(w.Body.String(), plain) {
+			t.Errorf("The token list contains a token: %s", w.Body)
+		}
+	}
+	var res struct {
+		Tokens []model.APIToken `json:"tokens"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	used := map[string]bool{}
+	for _, token := range res.Tokens {
+		used[token.Name] = token.LastUsedAt != nil
+		if token.Name == "revoked" && token.RevokedAt == nil {
+			t.Errorf("The revoked token has no revoked_at")
+		}
+	}
+	want := map[string]bool{"lab CI": true, "boards": true, "expired": false, "revoked": false}
+	for name, u := range want {
+		if used[name] != u {
+			t.Errorf("Token %q used = %v, want %v", name, used[name], u)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+// handlers.trash.go
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+	"github.com/siro20/boardstatus/pkg/model"
+)
+
+// A section of the trash page
+type trashSection struct {
+	Kind  string            `json:"kind"`
+	Title string            `json:"title"`
+	Items []model.TrashItem `json:"items"`
+}
+
+// Run the action of the kind on the record given by :id. Admins can't delete
+// themselves.
+func runTrashAction(c *gin.Context, store *model.Store, actions map[string]model.TrashAction, kind string) (int, error) {
+	action, ok := actions[kind]
+	if !ok {
+		return http.StatusNotFound, fmt.Errorf("Unknown kind %q, one of %v", kind, model.TrashKinds)
+	}
+	id, err := paramID(c, "id")
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	if u := currentUser(c); kind == model.TrashUsers && u != nil && u.ID == uint(id) {
+		return http.StatusUnprocessableEntity, errors.New("You can't delete yourself")
+	}
+
+	err = action(store.ForRequest(c), uint(id))
+	switch {
+	case err == nil:
+		return http.StatusNoContent, nil
+	case gorm.IsRecordNotFoundError(err):
+		return http.StatusNotFound, fmt.Errorf("No %s with ID %d", strings.TrimSuffix(kind, "s"), id)
+	case model.IsValidationError(err):
+		return http.StatusUnprocessableEntity, err
+	}
+	return http.StatusInternalServerError, err
+}
+
+// Handle DELETE requests of the API, moves the record to the trash
+func apiDelete(store *model.Store, kind string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		apiTrashAction(c, store, model.DeleteActions, kind)
+	}
+}
+
+// Handle POST /api/v1/trash/:kind/:id/restore
+func apiRestore(store *model.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		apiTrashAction(c, store, model.RestoreActions, c.Param("kind"))
+	}
+}
+
+// Handle DELETE /api/v1/trash/:kind/:id
+func apiPurge(store *model.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		apiTrashAction(c, store, model.PurgeActions, c.Param("kind"))
+	}
+}
+
+func apiTrashAction(c *gin.Context, store *model.Store, actions map[string]model.TrashAction, kind string) {
+	code, err := runTrashAction(c, store, actions, kind)
+	if err != nil {
+		apiError(c, code, err)
+		return
+	}
+	c.Status(code)
+}
+
+// Handle GET /api/v1/trash/:kind
+func apiShowTrash(store *model.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		items, err := store.Trash(c.Param("kind"))
+		if err != nil {
+			apiError(c, http.StatusNotFound, err)
+			return
+		}
+		c.JSON(http.StatusOK, items)
+	}
+}
+
+// Handle GET /trash/
+func showTrashPage(store *model.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		showTrash(store, c, http.StatusOK, nil)
+	}
+}
+
+func showTrash(store *model.Store, c *gin.Context, code int, actionErr error) {
+	titles := map[string]string{
+		model.TrashBoards: "Boards",
+		model.TrashTests:  "Tests",
+		model.TrashUsers:  "Users",
+	}
+	var sections []trashSection
+	for _, kind := range model.TrashKinds {
+		items, err := store.Trash(kind)
+		if err != nil {
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+		sections = append(sections, trashSection{kind, titles[kind], items})
+	}
+
+	data := gin.H{
+		"title":   "Trash",
+		"payload": sections}
+	if actionErr != nil {
+		data["ErrorTitle"] = "Failed"
+		data["ErrorMessage"] = actionErr.Error()
+	}
+	renderStatus(c, code, data, "trash.html")
+}
+
+// Handle the POSTed forms of the trash page and the delete buttons. Goes on
+// to redirect, or shows the trash page with the error.
+func trashForm(store *model.Store, actions map[string]model.TrashAction, kind, redirect string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		k := kind
+		if k == "" {
+			k = c.Param("kind")
+		}
+		code, err := runTrashAction(c, store, actions, k)
+		if err != nil {
+			showTrash(store, c, code, err)
+			return
+		}
+		c.Redirect(http.StatusSeeOther, redirect)
+	}
+}
@@ -0,0 +1,173 @@
+// handlers.update.go
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+	"github.com/siro20/boardstatus/pkg/model"
+)
+
+// The ETag of a record is its UpdatedAt, it's the version updates are based on
+func etag(m gorm.Model) string {
+	return strconv.Quote(m.UpdatedAt.Format(time.RFC3339Nano))
+}
+
+// The version the changes are based on, from the If-Match header or the
+// updated_at field of the body
+func updateVersion(c *gin.Context, ch model.Changes) (time.Time, error) {
+	v := strings.TrimPrefix(c.GetHeader("If-Match"), "W/")
+	if v != "" {
+		if s, err := strconv.Unquote(v); err == nil {
+			v = s
+		}
+	} else if s, ok := ch["updated_at"].(string); ok {
+		v = s
+	} else if s, ok := ch["UpdatedAt"].(string); ok {
+		v = s
+	} else {
+		return time.Time{}, errors.New("Send the updated_at of the record the changes are based on, or an If-Match header with its ETag")
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Invalid version %q, expected a RFC 3339 time", v)
+	}
+	return t, nil
+}
+
+// Decode the changes of a PUT or PATCH request and apply them with update.
+// load fetches the record to send back on a conflict.
+func apiUpdate(c *gin.Context, update func(id uint, u model.Update) (interface{}, error), load func(id int) (interface{}, error)) {
+	id, err := paramID(c, "id")
+	if err != nil {
+		apiError(c, http.StatusBadRequest, err)
+		return
+	}
+	var ch model.Changes
+	if err := decodeBody(c, &ch); err != nil {
+		apiError(c, http.StatusBadRequest, err)
+		return
+	}
+	version, err := updateVersion(c, ch)
+	if err != nil {
+		apiError(c, http.StatusPreconditionRequired, err)
+		return
+	}
+
+	v, err := update(uint(id), model.Update{
+		Changes: ch,
+		Version: version,
+		Replace: c.Request.Method == http.MethodPut,
+	})
+	switch {
+	case err == nil:
+		c.JSON(http.StatusOK, v)
+	case gorm.IsRecordNotFoundError(err):
+		apiError(c, http.StatusNotFound, fmt.Errorf("Record %d not found", id))
+	case err == model.ErrConflict:
+		// Send the current record along, the client has to merge
+		current, lerr := load(id)
+		if lerr != nil {
+			apiError(c, http.StatusInternalServerError, lerr)
+			return
+		}
+		c.Error(err)
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": err.Error(), "current": current})
+	default:
+		apiStoreError(c, err)
+	}
+}
+
+// Handle GET /api/v1/boards/:id
+func apiShowBoard(store *model.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := paramID(c, "id")
+		if err != nil {
+			apiError(c, http.StatusBadRequest, err)
+			return
+		}
+		b, err := store.GetBoardByID(id)
+		if err != nil {
+			apiError(c, http.StatusNotFound, fmt.Errorf("Board %d not found", id))
+			return
+		}
+		c.Header("ETag", etag(b.Model))
+		c.JSON(http.StatusOK, b)
+	}
+}
+
+// Handle PUT and PATCH /api/v1/boards/:id
+func apiUpdateBoard(store *model.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		apiUpdate(c, func(id uint, u model.Update) (interface{}, error) {
+			b, err := store.ForRequest(c).UpdateBoard(id, u)
+			if err == nil {
+				c.Header("ETag", etag(b.Model))
+			}
+			return b, err
+		}, func(id int) (interface{}, error) {
+			return store.GetBoardByID(id)
+		})
+	}
+}
+
+// Handle PUT and PATCH /api/v1/tests/:id
+func apiUpdateTest(store *model.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		apiUpdate(c, func(id uint, u model.Update) (interface{}, error) {
+			t, err := store.ForRequest(c).UpdateTest(id, u)
+			if err != nil {
+				return nil, err
+			}
+			c.Header("ETag", etag(t.Model))
+			return gin.H{
+				"test":     t,
+				"url":      testURL(t),
+				"html_url": fmt.Sprintf("/test/view/%d", t.ID),
+			}, nil
+		}, func(id int) (interface{}, error) {
+			return store.GetTestByID(id)
+		})
+	}
+}
+
+// Handle GET /api/v1/users/:id
+func apiShowUser(store *model.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := paramID(c, "id")
+		if err != nil {
+			apiError(c, http.StatusBadRequest, err)
+			return
+		}
+		u, err := store.GetUserByID(id)
+		if err != nil {
+			apiError(c, http.StatusNotFound, fmt.Errorf("User %d not found", id))
+			return
+		}
+		c.Header("ETag", etag(u.Model))
+		c.JSON(http.StatusOK, u)
+	}
+}
+
+// Handle PUT and PATCH /api/v1/users/:id
+func apiUpdateUser(store *model.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		apiUpdate(c, func(id uint, u model.Update) (interface{}, error) {
+			user, err := store.ForRequest(c).UpdateUser(id, u)
+			if err == nil {
+				c.Header("ETag", etag(user.Model))
+			}
+			return user, err
+		}, func(id int) (interface{}, error) {
+			return store.GetUserByID(id)
+		})
+	}
+}
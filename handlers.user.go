@@ -3,7 +3,6 @@
 package main
 
 import (
-	"fmt"
 	"math/rand"
 	"net/http"
 	"strconv"
@@ -21,17 +20,20 @@ func showLoginPage(c *gin.Context) {
 	}, "login.html")
 }
 
-func performLogin(c *gin.Context) {
+func performLogin(store *model.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		login(store, c)
+	}
+}
+
+func login(store *model.Store, c *gin.Context) {
 	// Obtain the POSTed username and password values
 	username := c.PostForm("username")
 	password := c.PostForm("password")
-	fmt.Printf("username %s, password %s\n", username, password)
-	user, err := model.GetUserByName(username)
+	user, err := store.GetUserByName(username)
 	if err == nil && user != nil {
-		fmt.Printf("User found\n")
 		v, err := model.UserIsPasswordValid(user, password)
 		if !v || err != nil {
-			fmt.Printf("%v\n", err)
 			// If the username/password combination is invalid,
 			// show the error message on the login page
 			c.HTML(http.StatusBadRequest, "login.html", gin.H{
@@ -80,25 +82,32 @@ func showRegistrationPage(c *gin.Context) {
 		"title": "Register"}, "register.html")
 }
 
-func register(c *gin.Context) {
+func register(store *model.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		registerUser(store, c)
+	}
+}
+
+func registerUser(store *model.Store, c *gin.Context) {
 	// Obtain the POSTed username and password values
 	username := c.PostForm("username")
 	password := c.PostForm("password")
 
-	user, err := model.GetUserByName(username)
-	if user == nil || err != nil {
-
+	if user, err := store.GetUserByName(username); user != nil && err == nil {
 		c.HTML(http.StatusBadRequest, "register.html", gin.H{
 			"ErrorTitle":   "Registration Failed",
 			"ErrorMessage": "Username already taken"})
 		return
-	} else {
-		user.ApiToken = password
 	}
-	if err := user.InsertIntoDB(); err == nil {
-		// If the user is created, set the token in a cookie and log the user in
-		token := generateSessionToken()
-		c.SetCookie("token", token, 3600, "", "", false, true)
+	// The password is stored hashed, API tokens are created separately
+	user := model.User{Username: username, Name: username, Password: password}
+	if err := user.InsertIntoDB(store.ForRequest(c)); err == nil {
+		// If the user is created, log the user in
+		session := sessions.Default(c)
+		session.Set("user", user.Username)
+		if err := session.Save(); err != nil {
+			glog.Errorf("Failed to save session: %v", err)
+		}
 		c.Set("is_logged_in", true)
 
 		render(c, gin.H{
@@ -3,34 +3,119 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"net/http"
+	"os"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/siro20/boardstatus/pkg/git"
+	"github.com/siro20/boardstatus/pkg/lava"
 	"github.com/siro20/boardstatus/pkg/model"
 )
 
 var router *gin.Engine
 
 func main() {
+	cfg := model.DefaultStoreConfig()
+	flag.StringVar(&cfg.Path, "db", cfg.Path, "Path of the SQLite database, ':memory:' for an in-memory database")
+	flag.DurationVar(&cfg.BusyTimeout, "db-busy-timeout", cfg.BusyTimeout, "How long to wait for a locked database")
+	flag.IntVar(&cfg.MaxOpenConns, "db-max-conns", cfg.MaxOpenConns, "Maximum number of open database connections")
+	autoMigrate := flag.Bool("auto-migrate", false, "Apply pending schema migrations on startup")
+	lavaURL := flag.String("lava-url", "", "Base URL of the LAVA instance to import jobs from, e.g. https://lava.example.com")
+	lavaToken := flag.String("lava-token", os.Getenv("LAVA_TOKEN"), "API token of the LAVA instance, defaults to $LAVA_TOKEN")
+	gitRepo := flag.String("git-repo", "", "Local clone of the firmware repository to resolve commits with")
+	gitBranch := flag.String("git-branch", "master", "Branch of the repository that counts as master")
+	flaky := model.DefaultFlakyConfig()
+	flag.Float64Var(&flaky.Threshold, "flaky-threshold", flaky.Threshold, "Flip rate from which a test case is flaky, 0 to 1")
+	flag.IntVar(&flaky.MinRuns, "flaky-min-runs", flaky.MinRuns, "Runs a test case needs before it can be flaky")
+	flag.IntVar(&flaky.Window, "flaky-window", flaky.Window, "Number of newest runs the flip rate is computed from")
+	flag.BoolVar(&flaky.IgnoreInStatus, "flaky-ignore", false, "Count tests that only failed flaky test cases as passed in the board status")
+	bootTimeThreshold := flag.Float64("boot-time-threshold", 10, "Percent the boot time or a boot stage may grow before it's a regression, 0 to disable")
+	flakyInterval := flag.Duration("flaky-interval", time.Hour, "How often the server detects flaky test cases, 0 to disable")
+	flag.Parse()
 
-	// for testing only
-	u, err := model.GetUserByName("root")
-	if u == nil || err != nil {
-		var newUser model.User = model.User{
-			Username:          "root",
-			Name:              "root",
-			Password:          "root",
-			Email:             "",
-			ProfilePictureURL: "",
-			OAuthProvider:     "",
-		}
-		err := newUser.InsertIntoDB()
+	// Open the database once, all handlers share the connection pool
+	store, err := model.NewStore(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	defer store.Close()
+	store.SetFlakyConfig(flaky)
+	store.SetBootTimeThreshold(*bootTimeThreshold)
+
+	var repo *git.Repo
+	if *gitRepo != "" {
+		repo, err = git.Open(*gitRepo, *gitBranch)
 		if err != nil {
-			fmt.Printf("Error inserting user root: %v\n", err)
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
 		}
-	} else {
-		fmt.Printf("%v\n", u)
+		store.SetCommitResolver(repo)
+		store.SetSourceReader(repo)
+	}
+
+	switch flag.Arg(0) {
+	case "":
+	case "migrate":
+		if err := runMigrate(store, flag.Args()[1:]); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		return
+	case "rebuild-regressions":
+		if err := runRebuildRegressions(store); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		return
+	case "parse-timestamps":
+		if err := runParseTimestamps(store); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		return
+	case "parse-configs":
+		if err := runParseConfigs(store); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		return
+	case "detect-flaky":
+		if err := runDetectFlaky(store); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		return
+	case "create-admin":
+		if err := runCreateAdmin(store, flag.Args()[1:]); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		return
+	case "git-sync":
+		if err := runGitSync(store, *gitRepo); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n", flag.Arg(0))
+		os.Exit(1)
+	}
+
+	if *autoMigrate {
+		if _, err := store.MigrateUp(); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+	}
+	// Refuse to serve from a database with an outdated schema
+	if err := store.CheckSchema(); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
 	}
 
 	// Set Gin to production mode
@@ -44,7 +129,11 @@ func main() {
 	router.LoadHTMLGlob("templates/*")
 
 	// Initialize the routes
-	initializeRoutes()
+	initializeRoutes(store, lava.NewClient(*lavaURL, *lavaToken), repo)
+
+	if *flakyInterval > 0 {
+		go detectFlakyPeriodically(store, *flakyInterval)
+	}
 
 	// Start serving the application
 	router.Run()
@@ -54,18 +143,25 @@ func main() {
 // If the header doesn't specify this, HTML is rendered, provided that
 // the template name is present
 func render(c *gin.Context, data gin.H, templateName string) {
+	renderStatus(c, http.StatusOK, data, templateName)
+}
+
+// Like render, with the given HTTP status, e.g. for forms with errors
+func renderStatus(c *gin.Context, code int, data gin.H, templateName string) {
 	loggedInInterface, _ := c.Get("is_logged_in")
 	data["is_logged_in"] = loggedInInterface.(bool)
+	data["is_admin"] = c.GetBool("is_admin")
+	data["can_add_boards"] = c.GetBool("can_add_boards")
 
 	switch c.Request.Header.Get("Accept") {
 	case "application/json":
 		// Respond with JSON
-		c.JSON(http.StatusOK, data["payload"])
+		c.JSON(code, data["payload"])
 	case "application/xml":
 		// Respond with XML
-		c.XML(http.StatusOK, data["payload"])
+		c.XML(code, data["payload"])
 	default:
 		// Respond with HTML
-		c.HTML(http.StatusOK, templateName, data)
+		c.HTML(code, templateName, data)
 	}
 }
@@ -4,9 +4,11 @@ package main
 
 import (
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/contrib/sessions"
 	"github.com/gin-gonic/gin"
@@ -18,7 +20,9 @@ func authorizationHeader(user, password string) string {
 	return "Basic " + base64.StdEncoding.EncodeToString([]byte(base))
 }
 
-func BasicAuth() gin.HandlerFunc {
+// BasicAuth authenticates API requests by a personal API token sent as
+// Bearer token, or by HTTP Basic authentication
+func BasicAuth(store *model.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var header string
 
@@ -26,12 +30,29 @@ func BasicAuth() gin.HandlerFunc {
 			header = values[0]
 		}
 		if header == "" {
-			c.AbortWithStatus(http.StatusBadRequest)
+			c.Header("WWW-Authenticate", "Basic realm="+strconv.Quote("Authorization Required"))
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+
+		if token := strings.TrimPrefix(header, "Bearer "); token != header {
+			u, t, err := store.GetUserByAPIToken(strings.TrimSpace(token))
+			if err != nil {
+				c.Header("WWW-Authenticate", "Bearer realm="+strconv.Quote("Authorization Required"))
+				apiError(c, http.StatusUnauthorized, errors.New("Invalid, expired or revoked API token"))
+				return
+			}
+			c.Set("user", u)
+			c.Set("api_token", t)
 			return
 		}
 
 		// Search user in the slice of allowed credentials
-		u, err := model.GetUserByBasicAuth(header)
+		u, err := store.GetUserByBasicAuth(header)
+		if u == nil || err != nil {
+			// Fall back to username and password
+			u, err = basicAuthByPassword(store, c)
+		}
 		if u == nil || err != nil {
 			// Credentials doesn't match, we return 401 and abort handlers chain.
 			c.Header("WWW-Authenticate", "Basic realm="+strconv.Quote("Authorization Required"))
@@ -43,6 +64,22 @@ func BasicAuth() gin.HandlerFunc {
 	}
 }
 
+// Check the username and password sent with the request
+func basicAuthByPassword(store *model.Store, c *gin.Context) (*model.User, error) {
+	username, password, ok := c.Request.BasicAuth()
+	if !ok {
+		return nil, fmt.Errorf("Malformed Authorization header")
+	}
+	u, err := store.GetUserByName(username)
+	if err != nil {
+		return nil, err
+	}
+	if v, err := model.UserIsPasswordValid(u, password); !v || err != nil {
+		return nil, fmt.Errorf("Invalid credentials")
+	}
+	return u, nil
+}
+
 // This middleware ensures that a request will be aborted with an error
 // if the user is not logged in
 func ensureLoggedIn() gin.HandlerFunc {
@@ -76,19 +113,115 @@ func ensureNotLoggedIn() gin.HandlerFunc {
 	}
 }
 
-// This middleware sets whether the user is logged in or not
-func setUserStatus() gin.HandlerFunc {
+// This middleware sets whether the user is logged in or not, and the user
+// of the session
+func setUserStatus(store *model.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		session := sessions.Default(c)
 		user := session.Get("user")
 		if user != nil {
 			u, ok := user.(string)
-			c.Set("is_logged_in", ok && u != "")
-			fmt.Printf("is_logged_in %v %s\n", ok && u != "", u)
+			// Users deleted since they logged in aren't logged in anymore
+			var su *model.User
+			if ok && u != "" {
+				su, _ = store.GetUserByName(u)
+			}
+			c.Set("is_logged_in", su != nil)
 
+			if su != nil {
+				c.Set("user", su)
+				c.Set("is_admin", su.IsAdmin)
+				c.Set("can_add_boards", store.Authorize(su, model.PermCreateBoard, 0) == nil)
+			}
 		} else {
-			fmt.Printf("is_logged_in false\n")
 			c.Set("is_logged_in", false)
 		}
 	}
 }
+
+// The user of the session or the API request, nil if there's none
+func currentUser(c *gin.Context) *model.User {
+	if v, ok := c.Get("user"); ok {
+		if u, ok := v.(*model.User); ok {
+			return u
+		}
+	}
+	return nil
+}
+
+// Abort with 403 and the reason, as JSON for the API and as page otherwise
+func abortForbidden(c *gin.Context, err error) {
+	if strings.HasPrefix(c.Request.URL.Path, "/api/") {
+		apiError(c, http.StatusForbidden, err)
+		return
+	}
+	c.Error(err)
+	renderStatus(c, http.StatusForbidden, gin.H{
+		"title":        "Forbidden",
+		"ErrorTitle":   "Forbidden",
+		"ErrorMessage": err.Error()}, "error.html")
+	c.Abort()
+}
+
+// The API token the request was authenticated with, nil if there's none
+func currentToken(c *gin.Context) *model.APIToken {
+	if v, ok := c.Get("api_token"); ok {
+		if t, ok := v.(*model.APIToken); ok {
+			return t
+		}
+	}
+	return nil
+}
+
+// This middleware ensures that a request will be aborted with an error
+// if the user isn't an admin
+func ensureAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		u := currentUser(c)
+		if u == nil {
+			c.AbortWithStatus(http.StatusUnauthorized)
+		} else if !u.IsAdmin {
+			abortForbidden(c, &model.ForbiddenError{Message: "Only admins can do this"})
+		} else if t := currentToken(c); t != nil && !t.Allows(model.PermAdmin) {
+			abortForbidden(c, &model.ForbiddenError{Message: fmt.Sprintf("The API token %q doesn't have the admin scope", t.Name)})
+		}
+	}
+}
+
+// This middleware ensures that a request will be aborted with an error
+// if the user isn't allowed to do p. The record is given by the route
+// parameter param, none if it's empty.
+func ensurePermission(store *model.Store, p model.Permission, param string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		u := currentUser(c)
+		if u == nil {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		var id uint
+		if param != "" {
+			n, err := paramID(c, param)
+			if err != nil {
+				c.AbortWithError(http.StatusBadRequest, err)
+				return
+			}
+			id = uint(n)
+		}
+		if err := store.AuthorizeToken(u, currentToken(c), p, id); err != nil {
+			abortForbidden(c, err)
+		}
+	}
+}
+
+// This middleware sets who changes records in the request, for the audit log
+// of the stores that handlers get with ForRequest
+func setAuditActor(source string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		a := model.Actor{Source: source, Token: currentToken(c)}
+		if u := currentUser(c); u != nil {
+			a.UserID = u.ID
+			a.Name = u.Username
+		}
+		c.Set(model.ActorKey, a)
+	}
+}
@@ -0,0 +1,250 @@
+// diff.go
+
+// Package diff computes line based differences
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Op is the kind of a diff line
+type Op string
+
+// Kinds of diff lines, as in unified diffs
+const (
+	Equal  Op = " "
+	Insert Op = "+"
+	Delete Op = "-"
+)
+
+// Beyond this many edits the rest is reported as replaced as a whole, to
+// bound time and memory on unrelated inputs
+const maxEdits = 2000
+
+// Line is a line of the diff
+type Line struct {
+	Op   Op     `json:"op"`
+	Text string `json:"text"`
+	// Line numbers in the old and new input, 0 if not present there
+	OldLine int `json:"old_line,omitempty"`
+	NewLine int `json:"new_line,omitempty"`
+}
+
+// Hunk is a run of changes with some unchanged lines around them
+type Hunk struct {
+	OldStart int    `json:"old_start"`
+	OldLines int    `json:"old_lines"`
+	NewStart int    `json:"new_start"`
+	NewLines int    `json:"new_lines"`
+	Lines    []Line `json:"lines"`
+}
+
+// Find the shortest edit script with Myers' algorithm. Returns the ops
+// in order, without line numbers.
+func myers(a, b []string) []Op {
+	n, m := len(a), len(b)
+	max := n + m
+	if max == 0 {
+		return nil
+	}
+
+	// v[k+off] is the furthest x on diagonal k
+	off := max + 1
+	v := make([]int, 2*max+3)
+	var trace [][]int
+
+	for d := 0; d <= max; d++ {
+		if d > maxEdits {
+			// Give up, replace everything
+			var ops []Op
+			for i := 0; i < n; i++ {
+				ops = append(ops, Delete)
+			}
+			for i := 0; i < m; i++ {
+				ops = append(ops, Insert)
+			}
+			return ops
+		}
+
+		// Keep the diagonals of the previous step for backtracking
+		snap := make([]int, 2*d+1)
+		copy(snap, v[off-d:off+d+1])
+		trace = append(trace, snap)
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[off+k-1] < v[off+k+1]) {
+				x = v[off+k+1]
+			} else {
+				x = v[off+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[off+k] = x
+			if x >= n && y >= m {
+				return backtrack(trace, n, m)
+			}
+		}
+	}
+	return nil
+}
+
+// Walk the trace back from the end to collect the ops
+func backtrack(trace [][]int, n, m int) []Op {
+	var ops []Op
+	x, y := n, m
+
+	for d := len(trace) - 1; d > 0; d-- {
+		snap := trace[d]
+		at := func(k int) int { return snap[k+d] }
+
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			ops = append(ops, Equal)
+			x--
+			y--
+		}
+		if x == prevX {
+			ops = append(ops, Insert)
+		} else {
+			ops = append(ops, Delete)
+		}
+		x, y = prevX, prevY
+	}
+	for x > 0 && y > 0 {
+		ops = append(ops, Equal)
+		x--
+		y--
+	}
+
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
+
+// Lines compares a and b line by line
+func Lines(a, b []string) []Line {
+	var lines []Line
+
+	// Common prefix and suffix don't need the expensive part
+	pre := 0
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+
+	for i := 0; i < pre; i++ {
+		lines = append(lines, Line{Op: Equal, Text: a[i], OldLine: i + 1, NewLine: i + 1})
+	}
+
+	x, y := pre, pre
+	for _, op := range myers(a[pre:len(a)-suf], b[pre:len(b)-suf]) {
+		switch op {
+		case Equal:
+			lines = append(lines, Line{Op: Equal, Text: a[x], OldLine: x + 1, NewLine: y + 1})
+			x++
+			y++
+		case Delete:
+			lines = append(lines, Line{Op: Delete, Text: a[x], OldLine: x + 1})
+			x++
+		case Insert:
+			lines = append(lines, Line{Op: Insert, Text: b[y], NewLine: y + 1})
+			y++
+		}
+	}
+
+	for i := 0; i < suf; i++ {
+		lines = append(lines, Line{Op: Equal, Text: a[x+i], OldLine: x + i + 1, NewLine: y + i + 1})
+	}
+	return lines
+}
+
+// Hunks groups the changes of the diff with context unchanged lines around
+// them. Returns nil if there are no changes.
+func Hunks(lines []Line, context int) []Hunk {
+	var hunks []Hunk
+
+	for i := 0; i < len(lines); {
+		if lines[i].Op == Equal {
+			i++
+			continue
+		}
+
+		// Extend the hunk until there's more than 2*context unchanged lines
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for end < len(lines) {
+			if lines[end].Op != Equal {
+				end++
+				continue
+			}
+			run := end
+			for run < len(lines) && lines[run].Op == Equal {
+				run++
+			}
+			if run == len(lines) || run-end > 2*context {
+				end += context
+				if end > len(lines) {
+					end = len(lines)
+				}
+				break
+			}
+			end = run
+		}
+
+		h := Hunk{Lines: lines[start:end]}
+		for _, l := range h.Lines {
+			if l.Op != Insert {
+				if h.OldStart == 0 {
+					h.OldStart = l.OldLine
+				}
+				h.OldLines++
+			}
+			if l.Op != Delete {
+				if h.NewStart == 0 {
+					h.NewStart = l.NewLine
+				}
+				h.NewLines++
+			}
+		}
+		hunks = append(hunks, h)
+		i = end
+	}
+	return hunks
+}
+
+// Unified formats the hunks as unified diff
+func Unified(oldName, newName string, hunks []Hunk) string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", oldName, newName)
+	for _, h := range hunks {
+		fmt.Fprintf(&sb, "@@ -%d,%d +%d,%d @@\n", h.OldStart, h.OldLines, h.NewStart, h.NewLines)
+		for _, l := range h.Lines {
+			sb.WriteString(string(l.Op))
+			sb.WriteString(l.Text)
+			sb.WriteByte('\n')
+		}
+	}
+	return sb.String()
+}
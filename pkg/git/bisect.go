@@ -0,0 +1,104 @@
+// bisect.go
+
+package git
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RangeCommit is a commit between the good and the bad one
+type RangeCommit struct {
+	Hash    string    `json:"hash"`
+	Subject string    `json:"subject"`
+	Author  string    `json:"author"`
+	Date    time.Time `json:"date"`
+	// Changes files below the board's mainboard directory
+	TouchesBoard bool `json:"touches_board"`
+}
+
+// Bisect is the range of commits that can have broken a board
+type Bisect struct {
+	Good string `json:"good"`
+	Bad  string `json:"bad"`
+	// Newest first, the bad commit included, the good one not
+	Commits []RangeCommit `json:"commits"`
+	// The commit to test next, empty once the first bad commit is found
+	Next string `json:"next"`
+	// Roughly how many tests are left after testing Next
+	Steps int `json:"steps"`
+}
+
+// Bisect lists the commits in good..bad. Commits touching path, e.g.
+// src/mainboard/emulation/qemu-i440fx, are marked. Leave path empty to
+// not mark any.
+func (r *Repo) Bisect(good, bad, path string) (*Bisect, error) {
+	var err error
+	b := &Bisect{}
+
+	if b.Good, err = r.revParse(good); err != nil {
+		return nil, fmt.Errorf("Good commit %s not found: %v", good, err)
+	}
+	if b.Bad, err = r.revParse(bad); err != nil {
+		return nil, fmt.Errorf("Bad commit %s not found: %v", bad, err)
+	}
+	rng := b.Good + ".." + b.Bad
+
+	out, err := r.run("log", "--format=%H%x00%s%x00%an <%ae>%x00%cI", rng)
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range strings.Split(out, "\n") {
+		if line == "" {
+			continue
+		}
+		f := strings.Split(line, "\x00")
+		if len(f) != 4 {
+			return nil, fmt.Errorf("Unexpected output of git log: %q", line)
+		}
+		c := RangeCommit{Hash: f[0], Subject: f[1], Author: f[2]}
+		if c.Date, err = time.Parse(time.RFC3339, f[3]); err != nil {
+			return nil, err
+		}
+		b.Commits = append(b.Commits, c)
+	}
+
+	if path != "" && len(b.Commits) > 0 {
+		out, err := r.run("log", "--format=%H", rng, "--", path)
+		if err != nil {
+			return nil, err
+		}
+		touching := map[string]bool{}
+		for _, h := range strings.Fields(out) {
+			touching[h] = true
+		}
+		for i := range b.Commits {
+			b.Commits[i].TouchesBoard = touching[b.Commits[i].Hash]
+		}
+	}
+
+	// With a single commit left it's the one that broke the board
+	if len(b.Commits) < 2 {
+		return b, nil
+	}
+	out, err = r.run("rev-list", "--bisect-vars", b.Bad, "^"+b.Good)
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range strings.Split(out, "\n") {
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		v := strings.Trim(kv[1], "'")
+		switch kv[0] {
+		case "bisect_rev":
+			b.Next = v
+		case "bisect_steps":
+			b.Steps, _ = strconv.Atoi(v)
+		}
+	}
+	return b, nil
+}
@@ -0,0 +1,90 @@
+// bisect_test.go
+
+package git
+
+import (
+	"testing"
+)
+
+func TestBisect(t *testing.T) {
+	r := newTestRepo(t)
+	board := "src/mainboard/emulation/qemu-i440fx"
+
+	tests := []struct {
+		name     string
+		good     string
+		bad      string
+		path     string
+		commits  []string
+		touching []bool
+		next     bool
+		err      bool
+	}{
+		{
+			name:     "range",
+			good:     "4.12",
+			bad:      r.master[2][:7],
+			path:     board,
+			commits:  []string{r.master[2], r.master[1]},
+			touching: []bool{false, true},
+			next:     true,
+		},
+		{
+			name:     "without path",
+			good:     r.master[0],
+			bad:      "master",
+			commits:  []string{r.master[2], r.master[1]},
+			touching: []bool{false, false},
+			next:     true,
+		},
+		{
+			name:     "first bad commit found",
+			good:     r.master[1],
+			bad:      r.master[2],
+			path:     board,
+			commits:  []string{r.master[2]},
+			touching: []bool{false},
+		},
+		{
+			name:     "bad commit off master",
+			good:     r.master[2],
+			bad:      r.topic,
+			path:     "src/lib",
+			commits:  []string{r.topic},
+			touching: []bool{true},
+		},
+		{
+			name: "good is newer",
+			good: r.master[2],
+			bad:  r.master[0],
+		},
+		{name: "unknown good", good: "deadbeef", bad: "master", err: true},
+		{name: "unknown bad", good: "4.12", bad: "deadbeef", err: true},
+		{name: "option", good: "--all", bad: "master", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := r.Bisect(tt.good, tt.bad, tt.path)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("Bisect(%q, %q) succeeded, want an error", tt.good, tt.bad)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Bisect(%q, %q): %v", tt.good, tt.bad, err)
+			}
+			if len(b.Commits) != len(tt.commits) {
+				t.Fatalf("Bisect(%q, %q) = %d commits, want %d", tt.good, tt.bad, len(b.Commits), len(tt.commits))
+			}
+			for i, c := range b.Commits {
+				if c.Hash != tt.commits[i] || c.TouchesBoard != tt.touching[i] {
+					t.Errorf("Commit %d = %s touching the board %v, want %s %v", i, c.Hash, c.TouchesBoard, tt.commits[i], tt.touching[i])
+				}
+			}
+			if tt.next && (b.Next != r.master[1] && b.Next != r.master[2]) || !tt.next && b.Next != "" {
+				t.Errorf("Next = %q, want one of the range: %v", b.Next, tt.next)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+// git.go
+
+// Package git reads commit metadata from a local clone of the firmware
+// repository by running the git command line tool
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/siro20/boardstatus/pkg/model"
+)
+
+// Repo is a local clone, e.g. a mirror of the coreboot repository that is
+// kept up to date by a cron job
+type Repo struct {
+	Dir string
+	// The branch commits are "on master" of, e.g. master or origin/master
+	Branch string
+}
+
+// Open checks that dir is a git repository containing branch
+func Open(dir, branch string) (*Repo, error) {
+	r := &Repo{Dir: dir, Branch: branch}
+
+	if _, err := r.run("rev-parse", "--git-dir"); err != nil {
+		return nil, fmt.Errorf("%s is no git repository: %v", dir, err)
+	}
+	if _, err := r.revParse(branch); err != nil {
+		return nil, fmt.Errorf("Branch %s not found in %s: %v", branch, dir, err)
+	}
+	return r, nil
+}
+
+// Run git in the repository and return its trimmed output
+func (r *Repo) run(args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.Command("git", append([]string{"-C", r.Dir}, args...)...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return "", fmt.Errorf("git %s: %v", args[0], err)
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// Revisions come from uploads, don't let them pass as options
+func checkRev(rev string) error {
+	if rev == "" || strings.HasPrefix(rev, "-") || strings.ContainsAny(rev, " \t\n\x00") {
+		return fmt.Errorf("Invalid revision %q", rev)
+	}
+	return nil
+}
+
+// Return the full hash of the commit rev names
+func (r *Repo) revParse(rev string) (string, error) {
+	if err := checkRev(rev); err != nil {
+		return "", err
+	}
+	return r.run("rev-parse", "--verify", "--quiet", rev+"^{commit}")
+}
+
+// Check whether commit is reachable from the branch
+func (r *Repo) onBranch(hash string) (bool, error) {
+	err := exec.Command("git", "-C", r.Dir, "merge-base", "--is-ancestor", hash, r.Branch).Run()
+	if ee, ok := err.(*exec.ExitError); ok && ee.ExitCode() == 1 {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("git merge-base: %v", err)
+	}
+	return true, nil
+}
+
+// ResolveCommit looks up rev, which can be a (short) hash, a tag or a
+// git describe name like 4.12-123-gabcdef0
+func (r *Repo) ResolveCommit(rev string) (*model.Commit, error) {
+	// board_status.sh marks uncommitted changes
+	rev = strings.TrimSuffix(strings.TrimSpace(rev), "-dirty")
+
+	hash, err := r.revParse(rev)
+	if err != nil {
+		return nil, fmt.Errorf("Commit %s not found: %v", rev, err)
+	}
+
+	out, err := r.run("show", "-s", "--format=%s%x00%an <%ae>%x00%aI%x00%cI", hash)
+	if err != nil {
+		return nil, err
+	}
+	f := strings.Split(out, "\x00")
+	if len(f) != 4 {
+		return nil, fmt.Errorf("Unexpected output of git show: %q", out)
+	}
+
+	c := &model.Commit{
+		Hash:    hash,
+		Subject: f[0],
+		Author:  f[1],
+	}
+	if c.AuthorDate, err = time.Parse(time.RFC3339, f[2]); err != nil {
+		return nil, err
+	}
+	if c.CommitDate, err = time.Parse(time.RFC3339, f[3]); err != nil {
+		return nil, err
+	}
+
+	if c.Describe, err = r.run("describe", "--tags", "--always", hash); err != nil {
+		return nil, err
+	}
+
+	if c.OnMaster, err = r.onBranch(hash); err != nil {
+		return nil, err
+	}
+	if c.OnMaster {
+		// Number of ancestors, always larger than that of any of them
+		out, err := r.run("rev-list", "--count", hash)
+		if err != nil {
+			return nil, err
+		}
+		if c.Position, err = strconv.Atoi(out); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// ReadFile returns the content of the file at path in the tree of rev
+func (r *Repo) ReadFile(rev, path string) ([]byte, error) {
+	if err := checkRev(rev); err != nil {
+		return nil, err
+	}
+	if path == "" || strings.HasPrefix(path, "/") || strings.Contains(path, "..") {
+		return nil, fmt.Errorf("Invalid path %q", path)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("git", "-C", r.Dir, "show", rev+":"+path)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s not found at %s: %s", path, rev, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
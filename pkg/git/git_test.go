@@ -0,0 +1,224 @@
+// git_test.go
+
+package git
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Run git in dir with a fixed identity and dates
+func gitRun(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	cmd.Env = append(os.Environ(),
+		"GIT_CONFIG_NOSYSTEM=1",
+		"GIT_AUTHOR_NAME=Jane Doe", "GIT_AUTHOR_EMAIL=jane@example.com",
+		"GIT_AUTHOR_DATE=2020-05-01T10:00:00Z",
+		"GIT_COMMITTER_NAME=Jane Doe", "GIT_COMMITTER_EMAIL=jane@example.com",
+		"GIT_COMMITTER_DATE=2020-05-02T10:00:00Z",
+	)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v: %s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// Commit a file with the given subject and return the commit's hash
+func commitFile(t *testing.T, dir, path, content, subject string) string {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Join(dir, filepath.Dir(path)), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, path), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	gitRun(t, dir, "add", path)
+	gitRun(t, dir, "commit", "-q", "-m", subject)
+	return gitRun(t, dir, "rev-parse", "HEAD")
+}
+
+// A repository with the commits of master, oldest first, the first one
+// tagged 4.12, and a commit on the branch "topic"
+type testRepo struct {
+	*Repo
+	master []string
+	topic  string
+}
+
+func newTestRepo(t *testing.T) *testRepo {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	gitRun(t, dir, "init", "-q")
+	gitRun(t, dir, "checkout", "-q", "-b", "master")
+
+	tr := &testRepo{}
+	tr.master = append(tr.master, commitFile(t, dir, "README", "coreboot\n", "Initial commit"))
+	gitRun(t, dir, "tag", "-a", "-m", "coreboot 4.12", "4.12")
+	tr.master = append(tr.master, commitFile(t, dir, "src/mainboard/emulation/qemu-i440fx/Kconfig", "config BOARD\n", "mb/emulation/qemu-i440fx: Add Kconfig"))
+	tr.master = append(tr.master, commitFile(t, dir, "src/lib/boot.c", "int main;\n", "lib: Add boot"))
+
+	gitRun(t, dir, "checkout", "-q", "-b", "topic")
+	tr.topic = commitFile(t, dir, "src/lib/topic.c", "int topic;\n", "lib: Work in progress")
+	gitRun(t, dir, "checkout", "-q", "master")
+
+	var err error
+	if tr.Repo, err = Open(dir, "master"); err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	return tr
+}
+
+func TestOpen(t *testing.T) {
+	r := newTestRepo(t)
+	if _, err := Open(r.Dir, "origin/master"); err == nil {
+		t.Errorf("Open with an unknown branch succeeded")
+	}
+	if _, err := Open(t.TempDir(), "master"); err == nil {
+		t.Errorf("Open of a directory without repository succeeded")
+	}
+}
+
+func TestResolveCommit(t *testing.T) {
+	r := newTestRepo(t)
+
+	tests := []struct {
+		name     string
+		rev      string
+		hash     string
+		subject  string
+		describe string
+		onMaster bool
+		position int
+		err      bool
+	}{
+		{
+			name:     "hash",
+			rev:      r.master[2],
+			hash:     r.master[2],
+			subject:  "lib: Add boot",
+			describe: "4.12-2-g" + r.master[2][:7],
+			onMaster: true,
+			position: 3,
+		},
+		{
+			name:     "short hash",
+			rev:      r.master[1][:7],
+			hash:     r.master[1],
+			subject:  "mb/emulation/qemu-i440fx: Add Kconfig",
+			describe: "4.12-1-g" + r.master[1][:7],
+			onMaster: true,
+			position: 2,
+		},
+		{
+			name:     "tag",
+			rev:      "4.12",
+			hash:     r.master[0],
+			subject:  "Initial commit",
+			describe: "4.12",
+			onMaster: true,
+			position: 1,
+		},
+		{
+			name:     "describe",
+			rev:      "4.12-2-g" + r.master[2][:7],
+			hash:     r.master[2],
+			subject:  "lib: Add boot",
+			describe: "4.12-2-g" + r.master[2][:7],
+			onMaster: true,
+			position: 3,
+		},
+		{
+			name:     "dirty",
+			rev:      " 4.12-1-g" + r.master[1][:7] + "-dirty\n",
+			hash:     r.master[1],
+			subject:  "mb/emulation/qemu-i440fx: Add Kconfig",
+			describe: "4.12-1-g" + r.master[1][:7],
+			onMaster: true,
+			position: 2,
+		},
+		{
+			name:     "not on master",
+			rev:      r.topic,
+			hash:     r.topic,
+			subject:  "lib: Work in progress",
+			describe: "4.12-3-g" + r.topic[:7],
+		},
+		{name: "unknown", rev: "deadbeef", err: true},
+		{name: "empty", rev: "", err: true},
+		{name: "option", rev: "--all", err: true},
+		{name: "space", rev: "4.12 master", err: true},
+		{name: "tree", rev: "master^{tree}", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := r.ResolveCommit(tt.rev)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("ResolveCommit(%q) = %s, want an error", tt.rev, c.Hash)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ResolveCommit(%q): %v", tt.rev, err)
+			}
+			if c.Hash != tt.hash || c.Subject != tt.subject || c.Describe != tt.describe {
+				t.Errorf("Commit = %s %q %q, want %s %q %q", c.Hash, c.Subject, c.Describe, tt.hash, tt.subject, tt.describe)
+			}
+			if c.OnMaster != tt.onMaster || c.Position != tt.position {
+				t.Errorf("OnMaster = %v at %d, want %v at %d", c.OnMaster, c.Position, tt.onMaster, tt.position)
+			}
+			if c.Author != "Jane Doe <jane@example.com>" {
+				t.Errorf("Author = %q", c.Author)
+			}
+			if c.AuthorDate.Format("2006-01-02") != "2020-05-01" || c.CommitDate.Format("2006-01-02") != "2020-05-02" {
+				t.Errorf("AuthorDate = %s, CommitDate = %s", c.AuthorDate, c.CommitDate)
+			}
+		})
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	r := newTestRepo(t)
+
+	tests := []struct {
+		name string
+		rev  string
+		path string
+		want string
+		err  bool
+	}{
+		{name: "file", rev: "master", path: "src/lib/boot.c", want: "int main;\n"},
+		{name: "older commit", rev: "4.12", path: "README", want: "coreboot\n"},
+		{name: "not yet added", rev: "4.12", path: "src/lib/boot.c", err: true},
+		{name: "parent directory", rev: "master", path: "src/../README", err: true},
+		{name: "absolute", rev: "master", path: "/etc/passwd", err: true},
+		{name: "empty path", rev: "master", path: "", err: true},
+		{name: "option", rev: "--output=x", path: "README", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := r.ReadFile(tt.rev, tt.path)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("ReadFile(%q, %q) = %q, want an error", tt.rev, tt.path, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ReadFile(%q, %q): %v", tt.rev, tt.path, err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("ReadFile(%q, %q) = %q, want %q", tt.rev, tt.path, got, tt.want)
+			}
+		})
+	}
+}
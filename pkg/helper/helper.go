@@ -12,18 +12,25 @@ import (
 // If the header doesn't specify this, HTML is rendered, provided that
 // the template name is present
 func Render(c *gin.Context, data gin.H, templateName string) {
+	RenderStatus(c, http.StatusOK, data, templateName)
+}
+
+// Like Render, with the given HTTP status, e.g. for forms with errors
+func RenderStatus(c *gin.Context, code int, data gin.H, templateName string) {
 	loggedInInterface, _ := c.Get("is_logged_in")
 	data["is_logged_in"] = loggedInInterface.(bool)
+	data["is_admin"] = c.GetBool("is_admin")
+	data["can_add_boards"] = c.GetBool("can_add_boards")
 
 	switch c.Request.Header.Get("Accept") {
 	case "application/json":
 		// Respond with JSON
-		c.JSON(http.StatusOK, data["payload"])
+		c.JSON(code, data["payload"])
 	case "application/xml":
 		// Respond with XML
-		c.XML(http.StatusOK, data["payload"])
+		c.XML(code, data["payload"])
 	default:
 		// Respond with HTML
-		c.HTML(http.StatusOK, templateName, data)
+		c.HTML(code, templateName, data)
 	}
 }
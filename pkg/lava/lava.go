@@ -0,0 +1,208 @@
+// lava.go
+
+// Package lava fetches the results of LAVA jobs and turns them into tests
+package lava
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/siro20/boardstatus/pkg/model"
+	"github.com/siro20/boardstatus/pkg/parser"
+	"gopkg.in/yaml.v2"
+)
+
+// Client talks to one LAVA instance
+type Client struct {
+	// e.g. https://lava.example.com
+	BaseURL string
+	// API token, sent as "Authorization: Token <token>" if not empty
+	Token string
+	// Defaults to a client with a 30 second timeout
+	HTTPClient *http.Client
+}
+
+// Job is the part of /api/v0.2/jobs/<id>/ we need
+type Job struct {
+	ID           int       `json:"id"`
+	Description  string    `json:"description"`
+	State        string    `json:"state"`  // e.g. Finished
+	Health       string    `json:"health"` // Complete, Incomplete, Canceled
+	ActualDevice string    `json:"actual_device"`
+	StartTime    time.Time `json:"start_time"`
+	EndTime      time.Time `json:"end_time"`
+}
+
+// A line of the job log returned by /api/v0.2/jobs/<id>/logs/
+type logLine struct {
+	Lvl string      `yaml:"lvl"`
+	Msg interface{} `yaml:"msg"`
+}
+
+// NewClient returns a client for the LAVA instance at baseURL
+func NewClient(baseURL, token string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		Token:      token,
+		HTTPClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+var jobRe = regexp.MustCompile(`^(.*?)/(?:scheduler/job|results|api/v0\.2/jobs)/(\d+)/?`)
+
+// JobID extracts the job ID from a reference, which can be the bare ID or
+// a URL of the job on this instance, e.g. https://lava.example.com/scheduler/job/42
+func (c *Client) JobID(ref string) (int, error) {
+	ref = strings.TrimSpace(ref)
+	if id, err := strconv.Atoi(ref); err == nil && id > 0 {
+		return id, nil
+	}
+
+	m := jobRe.FindStringSubmatch(ref)
+	if m == nil {
+		return 0, fmt.Errorf("%q is no LAVA job reference", ref)
+	}
+	// Only talk to the configured instance
+	if !strings.EqualFold(strings.TrimRight(m[1], "/"), c.BaseURL) {
+		return 0, fmt.Errorf("Job %q isn't on the configured LAVA instance %s", ref, c.BaseURL)
+	}
+	return strconv.Atoi(m[2])
+}
+
+// JobURL returns the web page of the job
+func (c *Client) JobURL(id int) string {
+	return fmt.Sprintf("%s/scheduler/job/%d", c.BaseURL, id)
+}
+
+func (c *Client) get(path string) ([]byte, error) {
+	if c.BaseURL == "" {
+		return nil, fmt.Errorf("No LAVA instance configured")
+	}
+	u, err := url.Parse(c.BaseURL + path)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Token "+c.Token)
+	}
+
+	hc := c.HTTPClient
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", u, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// Job fetches the job details
+func (c *Client) Job(id int) (*Job, error) {
+	data, err := c.get(fmt.Sprintf("/api/v0.2/jobs/%d/", id))
+	if err != nil {
+		return nil, err
+	}
+	var j Job
+	if err := json.Unmarshal(data, &j); err != nil {
+		return nil, fmt.Errorf("Invalid LAVA job %d: %v", id, err)
+	}
+	return &j, nil
+}
+
+// Results fetches the test results of the job
+func (c *Client) Results(id int) ([]parser.Case, error) {
+	data, err := c.get(fmt.Sprintf("/results/%d/yaml", id))
+	if err != nil {
+		return nil, err
+	}
+	return parser.ParseLAVAResults(bytes.NewReader(data))
+}
+
+// TargetLog fetches the serial output of the device under test
+func (c *Client) TargetLog(id int) ([]byte, error) {
+	data, err := c.get(fmt.Sprintf("/api/v0.2/jobs/%d/logs/", id))
+	if err != nil {
+		return nil, err
+	}
+
+	var lines []logLine
+	if err := yaml.Unmarshal(data, &lines); err != nil {
+		return nil, fmt.Errorf("Invalid LAVA log of job %d: %v", id, err)
+	}
+
+	var buf bytes.Buffer
+	for _, l := range lines {
+		if l.Lvl != "target" {
+			continue
+		}
+		buf.WriteString(fmt.Sprint(l.Msg))
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+// Import fills the test with the job given by t.ReferenceExternalValidation:
+// its cases, the serial log as boot log and a link back to the job. The
+// status is left empty, so it's derived from the cases, unless the job
+// didn't complete.
+func (c *Client) Import(t *model.Test) error {
+	id, err := c.JobID(t.ReferenceExternalValidation)
+	if err != nil {
+		return &model.ValidationError{Field: model.ExternalRefField, Message: err.Error()}
+	}
+
+	job, err := c.Job(id)
+	if err != nil {
+		return err
+	}
+	cases, err := c.Results(id)
+	if err != nil {
+		return err
+	}
+	log, err := c.TargetLog(id)
+	if err != nil {
+		return err
+	}
+
+	t.ReferenceExternalValidation = c.JobURL(id)
+	if t.Name == "" {
+		t.Name = fmt.Sprintf("LAVA job %d", id)
+		if job.Description != "" {
+			t.Name += ": " + job.Description
+		}
+	}
+	if t.Time.IsZero() {
+		t.Time = job.StartTime
+	}
+	if len(t.FileBootlog) == 0 {
+		t.FileBootlog = log
+	}
+	t.AddCases(cases)
+
+	if job.Health != "" && job.Health != "Complete" && t.Status == "" {
+		t.Status = "FAIL"
+		if t.StatusComment == "" {
+			t.StatusComment = "LAVA job " + strings.ToLower(job.Health)
+		}
+	}
+	return nil
+}
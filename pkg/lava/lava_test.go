@@ -0,0 +1,172 @@
+// lava_test.go
+
+package lava
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/siro20/boardstatus/pkg/model"
+)
+
+const (
+	testJob = `{"id": 42, "description": "qemu boot", "state": "Finished", "health": "Complete",
+		"actual_device": "qemu-01", "start_time": "2020-05-01T10:00:00Z", "end_time": "2020-05-01T10:05:00Z"}`
+	testResults = `- {suite: lava, name: job, result: pass, metadata: {duration: '1.50'}}
+- {suite: 1_smoke, name: boot, result: pass}
+- {suite: 1_smoke, name: usb, result: fail, metadata: {error_msg: no device}}
+`
+	testLog = `- {dt: '2020-05-01T10:00:01', lvl: info, msg: 'Booting'}
+- {dt: '2020-05-01T10:00:02', lvl: target, msg: 'coreboot-4.12 bootblock starting'}
+- {dt: '2020-05-01T10:00:03', lvl: target, msg: 'Linux version 5.4'}
+`
+)
+
+// Start a LAVA instance serving job 42 with the given health
+func newTestServer(t *testing.T, health string) (*httptest.Server, *Client) {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v0.2/jobs/42/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Token secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(strings.Replace(testJob, "Complete", health, 1)))
+	})
+	mux.HandleFunc("/api/v0.2/jobs/42/logs/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(testLog))
+	})
+	mux.HandleFunc("/results/42/yaml", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(testResults))
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv, NewClient(srv.URL+"/", "secret")
+}
+
+func TestJobID(t *testing.T) {
+	c := NewClient("https://lava.example.com/", "")
+	tests := []struct {
+		ref string
+		id  int
+		err bool
+	}{
+		{"42", 42, false},
+		{" 42 ", 42, false},
+		{"https://lava.example.com/scheduler/job/42", 42, false},
+		{"https://LAVA.example.com/results/42/", 42, false},
+		{"https://lava.example.com/api/v0.2/jobs/42/", 42, false},
+		{"https://lava.other.com/scheduler/job/42", 0, true},
+		{"https://lava.example.com.evil.com/scheduler/job/42", 0, true},
+		{"0", 0, true},
+		{"-1", 0, true},
+		{"", 0, true},
+		{"job 42", 0, true},
+	}
+	for _, tt := range tests {
+		id, err := c.JobID(tt.ref)
+		if (err != nil) != tt.err || id != tt.id {
+			t.Errorf("JobID(%q) = %d, %v, want %d, error %v", tt.ref, id, err, tt.id, tt.err)
+		}
+	}
+}
+
+func TestJob(t *testing.T) {
+	_, c := newTestServer(t, "Complete")
+	job, err := c.Job(42)
+	if err != nil {
+		t.Fatalf("Job: %v", err)
+	}
+	if job.ID != 42 || job.Health != "Complete" || job.ActualDevice != "qemu-01" {
+		t.Errorf("Job = %+v", job)
+	}
+	if !job.StartTime.Equal(time.Date(2020, 5, 1, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("StartTime = %v", job.StartTime)
+	}
+
+	if _, err := c.Job(43); err == nil {
+		t.Errorf("Job of an unknown job succeeded")
+	}
+	c.Token = "wrong"
+	if _, err := c.Job(42); err == nil {
+		t.Errorf("Job with a wrong token succeeded")
+	}
+}
+
+func TestResults(t *testing.T) {
+	_, c := newTestServer(t, "Complete")
+	cases, err := c.Results(42)
+	if err != nil {
+		t.Fatalf("Results: %v", err)
+	}
+	if len(cases) != 3 {
+		t.Fatalf("Results returned %d cases, want 3: %+v", len(cases), cases)
+	}
+	if cases[0].Duration != 1.5 {
+		t.Errorf("Duration = %v, want 1.5", cases[0].Duration)
+	}
+	if c := cases[2]; c.Suite != "smoke" || c.Result != "fail" || c.Message != "error_msg: no device" {
+		t.Errorf("Case = %+v", c)
+	}
+}
+
+func TestTargetLog(t *testing.T) {
+	_, c := newTestServer(t, "Complete")
+	log, err := c.TargetLog(42)
+	if err != nil {
+		t.Fatalf("TargetLog: %v", err)
+	}
+	want := "coreboot-4.12 bootblock starting\nLinux version 5.4\n"
+	if string(log) != want {
+		t.Errorf("TargetLog = %q, want %q", log, want)
+	}
+}
+
+func TestImport(t *testing.T) {
+	srv, c := newTestServer(t, "Complete")
+	test := model.Test{ReferenceExternalValidation: srv.URL + "/scheduler/job/42"}
+	if err := c.Import(&test); err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	if test.Name != "LAVA job 42: qemu boot" {
+		t.Errorf("Name = %q", test.Name)
+	}
+	if test.ReferenceExternalValidation != srv.URL+"/scheduler/job/42" {
+		t.Errorf("ReferenceExternalValidation = %q", test.ReferenceExternalValidation)
+	}
+	if len(test.Cases) != 3 || len(test.FileBootlog) == 0 || test.Time.IsZero() {
+		t.Errorf("Imported %d cases, %d bytes of boot log, time %v", len(test.Cases), len(test.FileBootlog), test.Time)
+	}
+	if test.Status != "" {
+		t.Errorf("Status = %q, want it derived from the cases", test.Status)
+	}
+
+	srv, c = newTestServer(t, "Incomplete")
+	test = model.Test{Name: "nightly", ReferenceExternalValidation: "42"}
+	if err := c.Import(&test); err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	if test.Name != "nightly" || test.Status != "FAIL" || test.StatusComment != "LAVA job incomplete" {
+		t.Errorf("Name, Status, StatusComment = %q, %q, %q", test.Name, test.Status, test.StatusComment)
+	}
+}
+
+func TestImportInvalidReference(t *testing.T) {
+	_, c := newTestServer(t, "Complete")
+	test := model.Test{ReferenceExternalValidation: "https://lava.other.com/scheduler/job/42"}
+	err := c.Import(&test)
+	e, ok := err.(*model.ValidationError)
+	if !ok {
+		t.Fatalf("Import = %v, want a validation error", err)
+	}
+
+	// Named like the field of uploads
+	f, _ := reflect.TypeOf(model.Test{}).FieldByName("ReferenceExternalValidation")
+	if want := strings.Split(f.Tag.Get("json"), ",")[0]; e.Field != want {
+		t.Errorf("Field = %q, want %q", e.Field, want)
+	}
+}
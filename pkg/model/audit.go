@@ -0,0 +1,258 @@
+// audit.go
+
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+)
+
+// Where a change came from
+const (
+	SourceWeb    = "web"
+	SourceAPI    = "api"
+	SourceImport = "import"
+	SourceSystem = "system"
+)
+
+// AuditSources lists where changes come from
+var AuditSources = []string{SourceWeb, SourceAPI, SourceImport, SourceSystem}
+
+// Audited actions
+const (
+	ActionCreate  = "create"
+	ActionUpdate  = "update"
+	ActionDelete  = "delete"
+	ActionRestore = "restore"
+	ActionPurge   = "purge"
+)
+
+// AuditActions lists the audited actions
+var AuditActions = []string{ActionCreate, ActionUpdate, ActionDelete, ActionRestore, ActionPurge}
+
+// ActorKey is the key of the Actor in the gin context
+const ActorKey = "audit_actor"
+
+// Actor is who changes records through a Store, recorded in the audit log
+type Actor struct {
+	UserID uint
+	Name   string
+	Source string
+	// The API token the request was authenticated with, limits what the
+	// user may do to its scopes
+	Token *APIToken
+}
+
+// The actor of stores that weren't given one, e.g. of the commands
+var systemActor = Actor{Source: SourceSystem}
+
+// WithActor returns a store that records changes as made by the actor
+func (s *Store) WithActor(a Actor) *Store {
+	c := *s
+	c.actor = a
+	return &c
+}
+
+// WithSource returns a store that records changes with the given source,
+// e.g. SourceImport
+func (s *Store) WithSource(source string) *Store {
+	a := s.actor
+	a.Source = source
+	return s.WithActor(a)
+}
+
+// ForRequest returns a store that records changes as made by the actor
+// of the request
+func (s *Store) ForRequest(c *gin.Context) *Store {
+	if v, ok := c.Get(ActorKey); ok {
+		if a, ok := v.(Actor); ok {
+			return s.WithActor(a)
+		}
+	}
+	return s
+}
+
+// FieldChange is the value of a field before and after a change
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// FieldChanges are stored as JSON
+type FieldChanges []FieldChange
+
+// Value implements driver.Valuer
+func (f FieldChanges) Value() (driver.Value, error) {
+	if len(f) == 0 {
+		return "", nil
+	}
+	data, err := json.Marshal(f)
+	return string(data), err
+}
+
+// Scan implements sql.Scanner
+func (f *FieldChanges) Scan(src interface{}) error {
+	var data []byte
+	switch v := src.(type) {
+	case nil:
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("Cannot scan %T into FieldChanges", src)
+	}
+	*f = nil
+	if len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, f)
+}
+
+// AuditEntry records a change of a board, test or user
+type AuditEntry struct {
+	gorm.Model
+	// One of TrashKinds, the table of the record
+	Kind     string       `json:"kind" gorm:"size:255"`
+	RecordID uint         `json:"record_id"`
+	Action   string       `json:"action" gorm:"size:255"`
+	ActorID  uint         `json:"actor_id"`
+	Actor    string       `json:"actor" gorm:"size:255"`
+	Source   string       `json:"source" gorm:"size:255"`
+	Changes  FieldChanges `json:"changes" gorm:"type:text"`
+}
+
+// Shown instead of the values of secrets
+const hiddenValue = "(hidden)"
+
+// The value of a field as recorded in the audit log, files by their size
+func auditValue(v reflect.Value) string {
+	if b, ok := v.Interface().(Blob); ok {
+		if len(b) == 0 {
+			return ""
+		}
+		return fmt.Sprintf("(%d bytes)", len(b))
+	}
+	return renderValue(v)
+}
+
+// Compare the fields of two models of the same type, old can be nil for new
+// records. Lists stored in their own tables aren't compared, secrets are
+// only recorded as changed.
+func diffFields(old, cur interface{}) FieldChanges {
+	var changes FieldChanges
+
+	cv := reflect.Indirect(reflect.ValueOf(cur))
+	ov := reflect.New(cv.Type()).Elem()
+	if old != nil {
+		ov = reflect.Indirect(reflect.ValueOf(old))
+	}
+	for i := 0; i < cv.Type().NumField(); i++ {
+		f := cv.Type().Field(i)
+		if f.Anonymous || f.PkgPath != "" || f.Tag.Get("gorm") == "-" {
+			continue
+		}
+		if _, isBlob := cv.Field(i).Interface().(Blob); !isBlob && f.Type.Kind() == reflect.Slice {
+			continue
+		}
+		o, n := auditValue(ov.Field(i)), auditValue(cv.Field(i))
+		if o == n {
+			continue
+		}
+		name := fieldName(f)
+		if strings.Split(f.Tag.Get("json"), ",")[0] == "-" {
+			name = gorm.ToColumnName(f.Name)
+			o, n = hiddenValue, hiddenValue
+		}
+		changes = append(changes, FieldChange{name, o, n})
+	}
+	return changes
+}
+
+// Record the action on the record v points to in the audit log
+func (s *Store) audit(tx *gorm.DB, v interface{}, id uint, action string, changes FieldChanges) error {
+	e := AuditEntry{
+		Kind:     tx.NewScope(v).TableName(),
+		RecordID: id,
+		Action:   action,
+		ActorID:  s.actor.UserID,
+		Actor:    s.actor.Name,
+		Source:   s.actor.Source,
+		Changes:  changes,
+	}
+	if e.Source == "" {
+		e.Source = systemActor.Source
+	}
+	return tx.Create(&e).Error
+}
+
+// AuditQuery selects audit entries. Empty fields match everything.
+type AuditQuery struct {
+	Kind     string
+	RecordID uint
+	Actor    string
+	Action   string
+	Source   string
+	// Days of the first and last entry
+	Since  time.Time
+	Until  time.Time
+	Limit  int
+	Offset int
+}
+
+// FindAuditEntries returns the matching audit entries, newest first
+func (s *Store) FindAuditEntries(q AuditQuery) ([]AuditEntry, error) {
+	db := s.db.Model(&AuditEntry{})
+
+	if q.Kind != "" {
+		db = db.Where("kind = ?", q.Kind)
+	}
+	if q.RecordID != 0 {
+		db = db.Where("record_id = ?", q.RecordID)
+	}
+	if q.Actor != "" {
+		db = db.Where("actor = ?", q.Actor)
+	}
+	if q.Action != "" {
+		db = db.Where("action = ?", q.Action)
+	}
+	if q.Source != "" {
+		db = db.Where("source = ?", q.Source)
+	}
+	if !q.Since.IsZero() {
+		db = db.Where("created_at >= ?", q.Since)
+	}
+	if !q.Until.IsZero() {
+		db = db.Where("created_at < ?", q.Until.AddDate(0, 0, 1))
+	}
+	if q.Limit <= 0 || q.Limit > 1000 {
+		q.Limit = 100
+	}
+
+	var entries []AuditEntry
+	err := db.Order("created_at DESC, id DESC").
+		Limit(q.Limit).
+		Offset(q.Offset).
+		Find(&entries).Error
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// The change history of a record, shown on its page
+func (s *Store) auditOf(kind string, id uint) []AuditEntry {
+	entries, err := s.FindAuditEntries(AuditQuery{Kind: kind, RecordID: id, Limit: 1000})
+	if err != nil {
+		return nil
+	}
+	return entries
+}
@@ -0,0 +1,50 @@
+// blob.go
+
+package model
+
+import (
+	"database/sql/driver"
+	"fmt"
+)
+
+// Blob is raw file content as stored in the database. In JSON it's base64
+// encoded, in YAML it can be given as a plain string or as !!binary.
+type Blob []byte
+
+// UnmarshalYAML accepts plain strings in addition to !!binary
+func (b *Blob) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	*b = Blob(s)
+	return nil
+}
+
+// MarshalYAML emits the content as string
+func (b Blob) MarshalYAML() (interface{}, error) {
+	return string(b), nil
+}
+
+// Value implements driver.Valuer
+func (b Blob) Value() (driver.Value, error) {
+	if b == nil {
+		return nil, nil
+	}
+	return []byte(b), nil
+}
+
+// Scan implements sql.Scanner
+func (b *Blob) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*b = nil
+	case []byte:
+		*b = append(Blob(nil), v...)
+	case string:
+		*b = Blob(v)
+	default:
+		return fmt.Errorf("Cannot scan %T into Blob", src)
+	}
+	return nil
+}
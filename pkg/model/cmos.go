@@ -0,0 +1,130 @@
+// cmos.go
+
+package model
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+
+	"github.com/siro20/boardstatus/pkg/parser"
+)
+
+// CMOS is the decoded CMOS dump of a test
+type CMOS struct {
+	TestID uint `json:"test_id"`
+	// Where the cmos.layout came from, "upload" or its path in the source
+	// tree
+	Layout    string                      `json:"layout"`
+	Options   []parser.CMOSValue          `json:"options"`
+	Checksums []parser.CMOSChecksumResult `json:"checksums"`
+	// All checksums match
+	Valid bool `json:"valid"`
+}
+
+// Return the cmos.layout for the test: the uploaded one or the one of the
+// board in the source tree of the tested commit
+func (s *Store) cmosLayout(t *Test) (*parser.CMOSLayout, string, error) {
+	if len(t.FileCMOSLayout) > 0 {
+		l, err := parser.ParseCMOSLayout(bytes.NewReader(t.FileCMOSLayout))
+		return l, "upload", err
+	}
+
+	if s.source == nil {
+		return nil, "", fmt.Errorf("No cmos.layout uploaded and no git repository configured")
+	}
+	board, err := s.GetBoardByID(int(t.BoardID))
+	if err != nil {
+		return nil, "", err
+	}
+	if board.MainboardDir == "" || t.TestedCommit == "" {
+		return nil, "", fmt.Errorf("No cmos.layout uploaded, the board's directory or the tested commit is unknown")
+	}
+	p := path.Join("src/mainboard", board.MainboardDir, "cmos.layout")
+	data, err := s.source.ReadFile(t.TestedCommit, p)
+	if err != nil {
+		return nil, "", err
+	}
+	l, err := parser.ParseCMOSLayout(bytes.NewReader(data))
+	return l, p, err
+}
+
+// Decode the CMOS dump of the test, nil if there's none
+func (s *Store) decodeCMOS(t *Test) (*CMOS, error) {
+	if len(t.FileCMOS) == 0 {
+		return nil, nil
+	}
+	l, source, err := s.cmosLayout(t)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &CMOS{TestID: t.ID, Layout: source, Valid: true}
+	c.Options, c.Checksums = l.Decode(parser.ParseCMOSDump(t.FileCMOS))
+	for _, cs := range c.Checksums {
+		if !cs.Valid {
+			c.Valid = false
+		}
+	}
+	return c, nil
+}
+
+// DecodeCMOS returns the decoded CMOS dump of the test
+func (s *Store) DecodeCMOS(id uint) (*CMOS, error) {
+	var t Test
+
+	err := s.db.Select("id, board_id, tested_commit, file_cmos, file_cmos_layout").Where("id = ?", id).First(&t).Error
+	if err != nil {
+		return nil, fmt.Errorf("Test %d not found", id)
+	}
+	c, err := s.decodeCMOS(&t)
+	if err != nil {
+		return nil, err
+	}
+	if c == nil {
+		return nil, fmt.Errorf("Test %d has no CMOS dump", id)
+	}
+	return c, nil
+}
+
+// Values of the options by name
+func (c *CMOS) values() map[string]string {
+	values := map[string]string{}
+	for _, o := range c.Options {
+		values[o.Name] = o.Value
+	}
+	return values
+}
+
+// CMOSDiff returns the options that differ between the CMOS dumps of two
+// tests, each decoded with its own layout
+func (s *Store) CMOSDiff(oldID, newID uint) ([]ConfigChange, error) {
+	prev, err := s.DecodeCMOS(oldID)
+	if err != nil {
+		return nil, err
+	}
+	cur, err := s.DecodeCMOS(newID)
+	if err != nil {
+		return nil, err
+	}
+	return compareConfigs(prev.values(), cur.values()), nil
+}
+
+// Decode the CMOS dump of the test for the test page, along with the
+// changes since the previous test. Errors are shown instead.
+func (s *Store) cmosOfTest(t *Test) (*CMOS, []ConfigChange, string) {
+	c, err := s.decodeCMOS(t)
+	if err != nil {
+		return nil, nil, err.Error()
+	}
+	if c == nil {
+		return nil, nil, ""
+	}
+
+	var changes []ConfigChange
+	if prev, err := s.PreviousTestID(t); err == nil && prev != 0 {
+		// The previous test may have no dump, nothing to compare then
+		changes, _ = s.CMOSDiff(prev, t.ID)
+	}
+	return c, changes, ""
+}
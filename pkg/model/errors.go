@@ -0,0 +1,77 @@
+// errors.go
+
+package model
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ValidationError is returned when submitted data can't be stored
+type ValidationError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("Field %s %s", e.Field, e.Message)
+}
+
+// ValidationErrors holds the errors of all invalid fields
+type ValidationErrors []*ValidationError
+
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// IsValidationError tells if err was caused by invalid input
+func IsValidationError(err error) bool {
+	switch err.(type) {
+	case *ValidationError, ValidationErrors:
+		return true
+	}
+	return false
+}
+
+// FieldErrors returns the errors of the invalid fields, nil if err isn't a
+// validation error
+func FieldErrors(err error) []*ValidationError {
+	switch e := err.(type) {
+	case *ValidationError:
+		return []*ValidationError{e}
+	case ValidationErrors:
+		return e
+	}
+	return nil
+}
+
+// FieldErrorMap returns the messages of the invalid fields by field name,
+// e.g. to show them next to the inputs of a form
+func FieldErrorMap(err error) map[string]string {
+	m := map[string]string{}
+	for _, e := range FieldErrors(err) {
+		if _, ok := m[e.Field]; !ok {
+			m[e.Field] = e.Message
+		}
+	}
+	return m
+}
+
+// ForbiddenError is returned when the user isn't allowed to do something
+type ForbiddenError struct {
+	Message string `json:"message"`
+}
+
+func (e *ForbiddenError) Error() string {
+	return e.Message
+}
+
+// IsForbiddenError tells if err was caused by missing permissions
+func IsForbiddenError(err error) bool {
+	_, ok := err.(*ForbiddenError)
+	return ok
+}
@@ -0,0 +1,222 @@
+// flaky.go
+
+package model
+
+import (
+	"sort"
+
+	"github.com/jinzhu/gorm"
+)
+
+// FlakyConfig controls when a test case counts as flaky
+type FlakyConfig struct {
+	// Share of reruns of a commit with another outcome than the run of the
+	// commit before, 0 to 1
+	Threshold float64
+	// Cases with fewer runs aren't judged
+	MinRuns int
+	// Only the newest runs are looked at
+	Window int
+	// Tests whose failed cases are all flaky count as PASS for the board status
+	IgnoreInStatus bool
+}
+
+// DefaultFlakyConfig returns the configuration used unless overridden
+func DefaultFlakyConfig() FlakyConfig {
+	return FlakyConfig{
+		Threshold: 0.3,
+		MinRuns:   5,
+		Window:    20,
+	}
+}
+
+// SetFlakyConfig changes how flaky cases are detected and treated
+func (s *Store) SetFlakyConfig(cfg FlakyConfig) {
+	s.flaky = cfg
+}
+
+// FlakyCase is the flip rate of a test case name on a board
+type FlakyCase struct {
+	gorm.Model
+	BoardID  uint    `json:"board_id" yaml:"board_id"`
+	Name     string  `json:"name" yaml:"name" gorm:"size:65536"`
+	Runs     int     `json:"runs" yaml:"runs"`           // passed or failed runs looked at
+	Flips    int     `json:"flips" yaml:"flips"`         // reruns with another outcome than the run of the commit before
+	FlipRate float64 `json:"flip_rate" yaml:"flip_rate"` // flips per rerun of a commit
+	Flaky    bool    `json:"flaky" yaml:"flaky"`
+}
+
+// The result of a case in a test, as needed for the flip rate
+type caseRun struct {
+	TestID       uint
+	TestedCommit string
+	Name         string
+	Result       string
+}
+
+// Compute the flip rates of all cases of the board from its history. Only
+// runs of a commit that was tested before are compared, a different outcome
+// for another commit can be a regression or a fix.
+func flakyCasesOf(tx *gorm.DB, boardID uint, cfg FlakyConfig) ([]FlakyCase, error) {
+	history, err := testHistory(tx, boardID)
+	if err != nil {
+		return nil, err
+	}
+	// Position of the test in history, oldest first
+	order := map[uint]int{}
+	for i, t := range history {
+		order[t.ID] = len(history) - i
+	}
+
+	var runs []caseRun
+	err = tx.Table("test_cases").
+		Select("test_cases.test_id, tests.tested_commit, test_cases.name, test_cases.result").
+		Joins("JOIN tests ON tests.id = test_cases.test_id").
+		Where("tests.board_id = ? AND tests.deleted_at IS NULL AND test_cases.deleted_at IS NULL", boardID).
+		Where("test_cases.result <> ?", ResultSkip).
+		Scan(&runs).Error
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(runs, func(i, j int) bool { return order[runs[i].TestID] < order[runs[j].TestID] })
+
+	byName := map[string][]caseRun{}
+	var names []string
+	for _, r := range runs {
+		if _, ok := byName[r.Name]; !ok {
+			names = append(names, r.Name)
+		}
+		byName[r.Name] = append(byName[r.Name], r)
+	}
+
+	var cases []FlakyCase
+	for _, name := range names {
+		nameRuns := byName[name]
+		if cfg.Window > 0 && len(nameRuns) > cfg.Window {
+			nameRuns = nameRuns[len(nameRuns)-cfg.Window:]
+		}
+		if len(nameRuns) < cfg.MinRuns || len(nameRuns) < 2 {
+			continue
+		}
+
+		fc := FlakyCase{BoardID: boardID, Name: name, Runs: len(nameRuns)}
+		// Whether the last run of each commit failed
+		failed := map[string]bool{}
+		reruns := 0
+		for _, r := range nameRuns {
+			if r.TestedCommit == "" {
+				continue
+			}
+			f := isFailing(r.Result)
+			if before, ok := failed[r.TestedCommit]; ok {
+				reruns++
+				if f != before {
+					fc.Flips++
+				}
+			}
+			failed[r.TestedCommit] = f
+		}
+		// Without reruns there's nothing to judge
+		if reruns == 0 {
+			continue
+		}
+		fc.FlipRate = float64(fc.Flips) / float64(reruns)
+		fc.Flaky = fc.FlipRate >= cfg.Threshold
+		cases = append(cases, fc)
+	}
+	return cases, nil
+}
+
+// DetectFlakyCases computes the flip rate of every test case of every board
+// and marks those above the threshold as flaky. Returns the number of flaky
+// cases.
+func (s *Store) DetectFlakyCases() (int, error) {
+	boards, err := s.GetAllBoards()
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, b := range boards {
+		err := s.transaction(func(tx *gorm.DB) error {
+			cases, err := flakyCasesOf(tx, b.ID, s.flaky)
+			if err != nil {
+				return err
+			}
+			if err := tx.Unscoped().Where("board_id = ?", b.ID).Delete(&FlakyCase{}).Error; err != nil {
+				return err
+			}
+			for i := range cases {
+				if err := tx.Create(&cases[i]).Error; err != nil {
+					return err
+				}
+				if cases[i].Flaky {
+					n++
+				}
+			}
+			// The status can depend on what's flaky
+			return s.updateBoardStatus(tx, b.ID)
+		})
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// GetFlakyCases returns the flaky cases, of one board or all if boardID is 0
+func (s *Store) GetFlakyCases(boardID uint) ([]FlakyCase, error) {
+	var cases []FlakyCase
+
+	db := s.db.Where("flaky")
+	if boardID != 0 {
+		db = db.Where("board_id = ?", boardID)
+	}
+	if err := db.Order("flip_rate DESC, name").Find(&cases).Error; err != nil {
+		return nil, err
+	}
+	return cases, nil
+}
+
+// Return the names of the flaky cases of the board
+func (s *Store) flakyCaseNames(boardID uint) map[string]bool {
+	names := map[string]bool{}
+
+	cases, err := s.GetFlakyCases(boardID)
+	if err != nil {
+		return names
+	}
+	for _, fc := range cases {
+		names[fc.Name] = true
+	}
+	return names
+}
+
+// Return the tests of the board that only failed because of flaky cases
+func onlyFlakyFailures(tx *gorm.DB, boardID uint) (map[uint]bool, error) {
+	var rows []struct {
+		TestID uint
+		Failed int
+		Flaky  int
+	}
+
+	err := tx.Table("test_cases").
+		Select("test_cases.test_id, COUNT(*) AS failed, "+
+			"SUM(CASE WHEN test_cases.name IN (SELECT name FROM flaky_cases WHERE board_id = ? AND flaky AND deleted_at IS NULL) THEN 1 ELSE 0 END) AS flaky", boardID).
+		Joins("JOIN tests ON tests.id = test_cases.test_id").
+		Where("tests.board_id = ? AND tests.deleted_at IS NULL AND test_cases.deleted_at IS NULL", boardID).
+		Where("test_cases.result IN (?)", []string{ResultFail, ResultError}).
+		Group("test_cases.test_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	tests := map[uint]bool{}
+	for _, r := range rows {
+		if r.Failed > 0 && r.Failed == r.Flaky {
+			tests[r.TestID] = true
+		}
+	}
+	return tests, nil
+}
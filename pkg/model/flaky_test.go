@@ -0,0 +1,116 @@
+// flaky_test.go
+
+package model
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// A run of the case "usb", in upload order
+type flakyRun struct {
+	commit string
+	// Days after the first commit the tested commit was made
+	day    int
+	result string
+}
+
+func TestFlakyCasesOf(t *testing.T) {
+	cfg := FlakyConfig{Threshold: 0.3, MinRuns: 3}
+
+	tests := []struct {
+		name string
+		cfg  FlakyConfig
+		runs []flakyRun
+		want *FlakyCase
+	}{
+		{
+			name: "rerun flipping",
+			runs: []flakyRun{{"a", 1, "pass"}, {"a", 1, "fail"}, {"a", 1, "pass"}, {"b", 2, "pass"}},
+			want: &FlakyCase{Runs: 4, Flips: 2, FlipRate: 1, Flaky: true},
+		},
+		{
+			name: "regression",
+			runs: []flakyRun{{"a", 1, "pass"}, {"a", 1, "pass"}, {"b", 2, "fail"}, {"b", 2, "fail"}, {"c", 3, "pass"}, {"c", 3, "pass"}},
+			want: &FlakyCase{Runs: 6},
+		},
+		{
+			name: "commits alternating",
+			runs: []flakyRun{{"a", 1, "pass"}, {"b", 2, "fail"}, {"c", 3, "pass"}, {"d", 4, "fail"}},
+		},
+		{
+			name: "below threshold",
+			runs: []flakyRun{{"a", 1, "pass"}, {"a", 1, "pass"}, {"a", 1, "pass"}, {"a", 1, "pass"}, {"a", 1, "error"}},
+			want: &FlakyCase{Runs: 5, Flips: 1, FlipRate: 0.25},
+		},
+		{
+			name: "older commit rerun later",
+			runs: []flakyRun{{"a", 1, "pass"}, {"b", 2, "fail"}, {"a", 1, "fail"}, {"b", 2, "fail"}},
+			want: &FlakyCase{Runs: 4, Flips: 1, FlipRate: 0.5, Flaky: true},
+		},
+		{
+			name: "skipped left out",
+			runs: []flakyRun{{"a", 1, "pass"}, {"a", 1, "skip"}, {"a", 1, "pass"}, {"a", 1, "skip"}, {"a", 1, "pass"}},
+			want: &FlakyCase{Runs: 3},
+		},
+		{
+			name: "too few runs",
+			runs: []flakyRun{{"a", 1, "pass"}, {"a", 1, "fail"}},
+		},
+		{
+			name: "without commit",
+			runs: []flakyRun{{"", 1, "pass"}, {"", 2, "fail"}, {"", 3, "pass"}},
+		},
+		{
+			name: "window",
+			cfg:  FlakyConfig{Threshold: 0.3, MinRuns: 3, Window: 3},
+			runs: []flakyRun{{"a", 1, "pass"}, {"a", 1, "fail"}, {"a", 1, "pass"}, {"b", 2, "fail"}, {"b", 2, "fail"}, {"b", 2, "fail"}},
+			want: &FlakyCase{Runs: 3, Flips: 0, FlipRate: 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.cfg == (FlakyConfig{}) {
+				tt.cfg = cfg
+			}
+			s := newTestStore(t)
+			b := createBoard(t, s, "qemu-x86")
+			start := time.Date(2020, 5, 1, 0, 0, 0, 0, time.UTC)
+			for i, r := range tt.runs {
+				test := Test{
+					Name:         "boot",
+					BoardID:      b.ID,
+					TestedCommit: r.commit,
+					Time:         start.AddDate(0, 0, r.day).Add(time.Duration(i) * time.Minute),
+					Cases:        []TestCase{{Name: "usb", Result: r.result}},
+				}
+				if r.commit != "" {
+					test.TestedCommitTime = start.AddDate(0, 0, r.day)
+				}
+				if err := s.CreateTest(&test); err != nil {
+					t.Fatalf("CreateTest: %v", err)
+				}
+			}
+
+			cases, err := flakyCasesOf(s.db, b.ID, tt.cfg)
+			if err != nil {
+				t.Fatalf("flakyCasesOf: %v", err)
+			}
+			if tt.want == nil {
+				if len(cases) != 0 {
+					t.Errorf("flakyCasesOf() = %+v, want the case not judged", cases)
+				}
+				return
+			}
+			if len(cases) != 1 {
+				t.Fatalf("flakyCasesOf() = %+v, want one case", cases)
+			}
+			want := *tt.want
+			want.BoardID, want.Name = b.ID, "usb"
+			if !reflect.DeepEqual(cases[0], want) {
+				t.Errorf("flakyCasesOf() = %+v, want %+v", cases[0], want)
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+// import.boardstatus.go
+
+package model
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Largest file accepted from a board_status bundle
+const bundleMaxFileSize = 32 << 20
+
+// BoardStatusBundle is the content of a coreboot board_status.sh result tarball
+type BoardStatusBundle struct {
+	// Directory below the board-status repository root, e.g.
+	// emulation/qemu-i440fx/4.12-123-gabcdef/2020-05-01T10:00:00Z
+	Dir string
+	// Files by their base name
+	Files map[string][]byte
+}
+
+// Decompress the bundle if needed. Supports plain, gzip and bzip2 tarballs.
+func bundleReader(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(6)
+
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		return gzip.NewReader(br)
+	case bytes.HasPrefix(magic, []byte("BZh")):
+		return bzip2.NewReader(br), nil
+	case bytes.HasPrefix(magic, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}):
+		return nil, fmt.Errorf("xz compressed bundles aren't supported, use gzip or bzip2")
+	}
+	return br, nil
+}
+
+// ReadBoardStatusBundle unpacks a board_status.sh tarball
+func ReadBoardStatusBundle(r io.Reader) (*BoardStatusBundle, error) {
+	dr, err := bundleReader(r)
+	if err != nil {
+		return nil, &ValidationError{"bundle", err.Error()}
+	}
+
+	b := BoardStatusBundle{Files: map[string][]byte{}}
+	tr := tar.NewReader(dr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, &ValidationError{"bundle", fmt.Sprintf("is not a valid tarball: %v", err)}
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		if hdr.Size > bundleMaxFileSize {
+			return nil, &ValidationError{"bundle", fmt.Sprintf("file %s is too big", hdr.Name)}
+		}
+
+		data, err := ioutil.ReadAll(io.LimitReader(tr, bundleMaxFileSize))
+		if err != nil {
+			return nil, &ValidationError{"bundle", fmt.Sprintf("is not a valid tarball: %v", err)}
+		}
+
+		name := path.Base(hdr.Name)
+		b.Files[name] = data
+		if name == "revision.txt" {
+			b.Dir = strings.TrimPrefix(path.Dir(path.Clean("/"+hdr.Name)), "/")
+		}
+	}
+
+	if _, ok := b.Files["revision.txt"]; !ok {
+		return nil, &ValidationError{"bundle", "doesn't contain revision.txt"}
+	}
+	return &b, nil
+}
+
+// MainboardDir returns the vendor/board part of the bundle's directory, if
+// the bundle was packed with the board-status repository layout
+func (b *BoardStatusBundle) MainboardDir() string {
+	parts := strings.Split(b.Dir, "/")
+	// vendor/board/revision/timestamp
+	if len(parts) < 4 {
+		return ""
+	}
+	return strings.Join(parts[len(parts)-4:len(parts)-2], "/")
+}
+
+// Parse the "Key: value" lines of revision.txt
+func (b *BoardStatusBundle) revision() map[string]string {
+	rev := map[string]string{}
+	for _, line := range strings.Split(string(b.Files["revision.txt"]), "\n") {
+		kv := strings.SplitN(line, ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		rev[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+	return rev
+}
+
+// git describe output, e.g. 4.12-123-gabcdef0-dirty
+var describeRe = regexp.MustCompile(`-g([0-9a-f]{7,40})(-dirty)?$`)
+
+// Test converts the bundle into a Test. BoardID is left for the caller.
+func (b *BoardStatusBundle) Test() *Test {
+	var t Test
+
+	t.FileBootlog = b.Files["coreboot_console.txt"]
+	t.FileConfig = b.Files["config.txt"]
+	t.FileKernelLog = b.Files["kernel_log.txt"]
+	t.FileTimestamps = b.Files["timestamps.txt"]
+	t.FileCMOS = b.Files["cmos"]
+	t.FilePayloadconfig = b.Files["payload_config.txt"]
+
+	rev := b.revision()
+	t.NameOfTestedCommit = rev["Local revision"]
+	if m := describeRe.FindStringSubmatch(t.NameOfTestedCommit); m != nil {
+		t.TestedCommit = m[1]
+	} else {
+		// Built from a tag
+		t.TestedCommit = t.NameOfTestedCommit
+	}
+	if ts, err := time.Parse(time.RFC3339, rev["Timestamp"]); err == nil {
+		t.Time = ts
+	}
+
+	t.Name = "board_status " + t.NameOfTestedCommit
+	return &t
+}
+
+// ImportBoardStatusBundle stores the bundle as test of the given board. If
+// boardID is zero the board is looked up by the bundle's mainboard directory.
+// Fields already set in tmpl (status, comments, ...) take precedence.
+func (s *Store) ImportBoardStatusBundle(r io.Reader, boardID uint, tmpl Test) (*Test, error) {
+	b, err := ReadBoardStatusBundle(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if boardID == 0 {
+		dir := b.MainboardDir()
+		if dir == "" {
+			return nil, &ValidationError{"board_id", "is required, the bundle has no vendor/board directory"}
+		}
+		board, err := s.GetBoardByMainboardDir(dir)
+		if err != nil {
+			return nil, &ValidationError{"board_id", fmt.Sprintf("no board with mainboard directory %s", dir)}
+		}
+		boardID = board.ID
+	}
+
+	t := b.Test()
+	t.BoardID = boardID
+	t.Status = tmpl.Status
+	t.StatusComment = tmpl.StatusComment
+	t.Comment = tmpl.Comment
+	t.ReferenceExternalValidation = tmpl.ReferenceExternalValidation
+	if tmpl.Name != "" {
+		t.Name = tmpl.Name
+	}
+
+	if err := s.CreateTest(t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
@@ -0,0 +1,210 @@
+// import.boardstatus_test.go
+
+package model
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"testing"
+)
+
+const bundleDir = "emulation/qemu-i440fx/4.12-123-gabcdef0/2020-05-01T10:00:00Z/"
+
+const bundleRevision = `Local revision: 4.12-123-gabcdef0-dirty
+Upstream revision: 4.12
+Upstream URL: https://review.coreboot.org/coreboot.git
+Timestamp: 2020-05-01T10:00:00Z
+`
+
+// Pack the files into a tarball, gzip compressed if asked to
+func packBundle(t *testing.T, compress bool, files ...string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for i := 0; i+1 < len(files); i += 2 {
+		hdr := tar.Header{Name: files[i], Mode: 0644, Size: int64(len(files[i+1])), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(&hdr); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte(files[i+1]))
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !compress {
+		return buf.Bytes()
+	}
+
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write(buf.Bytes())
+	zw.Close()
+	return gz.Bytes()
+}
+
+func TestReadBoardStatusBundle(t *testing.T) {
+	gzipped := packBundle(t, true, bundleDir+"revision.txt", bundleRevision, bundleDir+"kernel_log.txt", "Linux version 5.4")
+
+	// A header announcing more than the limit, the data doesn't matter
+	var tooBig bytes.Buffer
+	tw := tar.NewWriter(&tooBig)
+	tw.WriteHeader(&tar.Header{Name: "revision.txt", Mode: 0644, Size: bundleMaxFileSize + 1, Typeflag: tar.TypeReg})
+	tw.Flush()
+
+	tests := []struct {
+		name         string
+		data         []byte
+		dir          string
+		mainboardDir string
+		files        int
+		err          bool
+	}{
+		{
+			name:         "board-status layout",
+			data:         gzipped,
+			dir:          "emulation/qemu-i440fx/4.12-123-gabcdef0/2020-05-01T10:00:00Z",
+			mainboardDir: "emulation/qemu-i440fx",
+			files:        2,
+		},
+		{
+			name:  "flat",
+			data:  packBundle(t, false, "revision.txt", bundleRevision, "./cmos", "\x00\x01"),
+			files: 2,
+		},
+		{
+			name:  "short directory",
+			data:  packBundle(t, false, "out/revision.txt", bundleRevision),
+			dir:   "out",
+			files: 1,
+		},
+		{
+			name: "without revision.txt",
+			data: packBundle(t, true, bundleDir+"kernel_log.txt", "Linux version 5.4"),
+			err:  true,
+		},
+		{
+			name: "empty",
+			data: nil,
+			err:  true,
+		},
+		{
+			name: "not a tarball",
+			data: []byte("Local revision: 4.12\n"),
+			err:  true,
+		},
+		{
+			name: "truncated",
+			data: gzipped[:len(gzipped)/2],
+			err:  true,
+		},
+		{
+			name: "xz",
+			data: []byte("\xfd7zXZ\x00\x00\x04"),
+			err:  true,
+		},
+		{
+			name: "file too big",
+			data: tooBig.Bytes(),
+			err:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := ReadBoardStatusBundle(bytes.NewReader(tt.data))
+			if tt.err {
+				if !IsValidationError(err) {
+					t.Fatalf("ReadBoardStatusBundle() = %v, want a validation error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ReadBoardStatusBundle(): %v", err)
+			}
+			if b.Dir != tt.dir || b.MainboardDir() != tt.mainboardDir || len(b.Files) != tt.files {
+				t.Errorf("Dir = %q, MainboardDir = %q, %d files, want %q, %q, %d files",
+					b.Dir, b.MainboardDir(), len(b.Files), tt.dir, tt.mainboardDir, tt.files)
+			}
+		})
+	}
+}
+
+func TestBoardStatusBundleTest(t *testing.T) {
+	tests := []struct {
+		name     string
+		revision string
+		commit   string
+		testName string
+		time     string
+	}{
+		{
+			name:     "describe",
+			revision: bundleRevision,
+			commit:   "abcdef0",
+			testName: "board_status 4.12-123-gabcdef0-dirty",
+			time:     "2020-05-01T10:00:00Z",
+		},
+		{
+			name:     "tag",
+			revision: "Local revision: 4.12\nTimestamp: yesterday\n",
+			commit:   "4.12",
+			testName: "board_status 4.12",
+		},
+		{
+			name:     "garbage",
+			revision: "no revision here\n\x00\n",
+			testName: "board_status ",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := BoardStatusBundle{Files: map[string][]byte{"revision.txt": []byte(tt.revision), "config.txt": []byte("CONFIG_X=y\n")}}
+			test := b.Test()
+			if test.TestedCommit != tt.commit || test.Name != tt.testName {
+				t.Errorf("TestedCommit = %q, Name = %q, want %q, %q", test.TestedCommit, test.Name, tt.commit, tt.testName)
+			}
+			if got := test.Time.Format("2006-01-02T15:04:05Z07:00"); tt.time != "" && got != tt.time || tt.time == "" && !test.Time.IsZero() {
+				t.Errorf("Time = %s, want %q", got, tt.time)
+			}
+			if string(test.FileConfig) != "CONFIG_X=y\n" {
+				t.Errorf("FileConfig = %q", test.FileConfig)
+			}
+		})
+	}
+}
+
+func TestImportBoardStatusBundle(t *testing.T) {
+	s := newTestStore(t)
+	b := Board{Name: "qemu-i440fx", MainboardDir: "emulation/qemu-i440fx"}
+	if err := s.CreateBoard(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	bundle := packBundle(t, true, bundleDir+"revision.txt", bundleRevision)
+	test, err := s.ImportBoardStatusBundle(bytes.NewReader(bundle), 0, Test{Status: "PASS", Comment: "nightly"})
+	if err != nil {
+		t.Fatalf("ImportBoardStatusBundle: %v", err)
+	}
+	if test.BoardID != b.ID || test.Status != "PASS" || test.Comment != "nightly" {
+		t.Errorf("Imported test of board %d with status %q and comment %q", test.BoardID, test.Status, test.Comment)
+	}
+
+	// The board given overrides the directory
+	other := createBoard(t, s, "other")
+	test, err = s.ImportBoardStatusBundle(bytes.NewReader(bundle), other.ID, Test{Status: "PASS", Name: "manual"})
+	if err != nil {
+		t.Fatalf("ImportBoardStatusBundle: %v", err)
+	}
+	if test.BoardID != other.ID || test.Name != "manual" {
+		t.Errorf("Imported test %q of board %d, want manual of board %d", test.Name, test.BoardID, other.ID)
+	}
+
+	unknown := packBundle(t, true, "emulation/qemu-q35/4.12/2020-05-01T10:00:00Z/revision.txt", bundleRevision)
+	if _, err := s.ImportBoardStatusBundle(bytes.NewReader(unknown), 0, Test{Status: "PASS"}); !IsValidationError(err) {
+		t.Errorf("Importing a bundle of an unknown board = %v, want a validation error", err)
+	}
+	flat := packBundle(t, false, "revision.txt", bundleRevision)
+	if _, err := s.ImportBoardStatusBundle(bytes.NewReader(flat), 0, Test{Status: "PASS"}); !IsValidationError(err) {
+		t.Errorf("Importing a bundle without board directory = %v, want a validation error", err)
+	}
+}
@@ -0,0 +1,105 @@
+// kernellog.go
+
+package model
+
+import (
+	"fmt"
+
+	"github.com/siro20/boardstatus/pkg/diff"
+	"github.com/siro20/boardstatus/pkg/parser"
+)
+
+// Unchanged lines shown around each change
+const kernelLogDiffContext = 3
+
+// KernelLogDiff is the difference between the normalized kernel logs of two
+// tests
+type KernelLogDiff struct {
+	OldTestID uint        `json:"old_test_id"`
+	NewTestID uint        `json:"new_test_id"`
+	OldName   string      `json:"old_name"`
+	NewName   string      `json:"new_name"`
+	Added     int         `json:"added"`
+	Removed   int         `json:"removed"`
+	Hunks     []diff.Hunk `json:"hunks"`
+}
+
+// Unified returns the diff in unified format
+func (d *KernelLogDiff) Unified() string {
+	return diff.Unified(
+		fmt.Sprintf("test %d: %s", d.OldTestID, d.OldName),
+		fmt.Sprintf("test %d: %s", d.NewTestID, d.NewName),
+		d.Hunks)
+}
+
+// PreviousTestID returns the test before the given one in the history of its
+// board, 0 if it's the oldest
+func (s *Store) PreviousTestID(t *Test) (uint, error) {
+	history, err := testHistory(s.db, t.BoardID)
+	if err != nil {
+		return 0, err
+	}
+	for i, h := range history {
+		if h.ID == t.ID && i+1 < len(history) {
+			return history[i+1].ID, nil
+		}
+	}
+	return 0, nil
+}
+
+// Load the name and kernel log of a test
+func (s *Store) kernelLog(id uint) (*Test, error) {
+	var t Test
+
+	if err := s.db.Select("id, name, board_id, file_kernel_log").Where("id = ?", id).First(&t).Error; err != nil {
+		return nil, fmt.Errorf("Test %d not found", id)
+	}
+	return &t, nil
+}
+
+// DiffKernelLogs compares the kernel logs of two tests. Timestamps,
+// addresses and other values that change on every boot are left out.
+func (s *Store) DiffKernelLogs(oldID, newID uint) (*KernelLogDiff, error) {
+	oldTest, err := s.kernelLog(oldID)
+	if err != nil {
+		return nil, err
+	}
+	newTest, err := s.kernelLog(newID)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := diff.Lines(
+		parser.NormalizeKernelLog(oldTest.FileKernelLog),
+		parser.NormalizeKernelLog(newTest.FileKernelLog))
+
+	d := &KernelLogDiff{
+		OldTestID: oldTest.ID,
+		NewTestID: newTest.ID,
+		OldName:   oldTest.Name,
+		NewName:   newTest.Name,
+		Hunks:     diff.Hunks(lines, kernelLogDiffContext),
+	}
+	for _, l := range lines {
+		switch l.Op {
+		case diff.Insert:
+			d.Added++
+		case diff.Delete:
+			d.Removed++
+		}
+	}
+	return d, nil
+}
+
+// Link to the kernel log diff against the previous test of the board, empty
+// if there's nothing to compare with
+func (s *Store) kernelLogDiffURL(t *Test) (string, error) {
+	if len(t.FileKernelLog) == 0 {
+		return "", nil
+	}
+	prev, err := s.PreviousTestID(t)
+	if err != nil || prev == 0 {
+		return "", err
+	}
+	return fmt.Sprintf("/test/diff/%d?against=%d", t.ID, prev), nil
+}
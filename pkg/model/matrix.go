@@ -0,0 +1,182 @@
+// matrix.go
+
+package model
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MatrixFilter selects the boards and columns of the status matrix. Empty
+// fields match every board.
+type MatrixFilter struct {
+	Manufacturer string
+	BoardType    string
+	Family       string
+	// Group the tests by release tag instead of commit
+	Tags bool
+	// Number of columns, newest first
+	Limit int
+}
+
+// MatrixColumn is a tested commit or a release tag
+type MatrixColumn struct {
+	Key   string `json:"key"`   // the full hash or the tag
+	Label string `json:"label"` // e.g. the git describe name
+
+	position int
+	time     time.Time
+}
+
+// MatrixCell is the newest test of a board for a column
+type MatrixCell struct {
+	TestID        uint   `json:"test_id"`
+	Status        string `json:"status"`
+	StatusComment string `json:"status_comment"`
+	Commit        string `json:"commit"`
+}
+
+// MatrixRow is a board with one cell per column, nil if it wasn't tested
+type MatrixRow struct {
+	BoardID uint          `json:"board_id"`
+	Board   string        `json:"board"`
+	Status  string        `json:"status"`
+	Cells   []*MatrixCell `json:"cells"`
+}
+
+// Matrix is the status of boards across commits
+type Matrix struct {
+	Columns []MatrixColumn `json:"columns"`
+	Rows    []MatrixRow    `json:"rows"`
+}
+
+var releaseRe = regexp.MustCompile(`^(.+)-\d+-g[0-9a-f]+$`)
+var hashRe = regexp.MustCompile(`^[0-9a-f]{7,40}$`)
+
+// Return the release a git describe name is based on, e.g. 4.12 for
+// 4.12-123-gabcdef0. Empty if the name is a plain hash.
+func releaseTag(name string) string {
+	name = strings.TrimSuffix(strings.TrimSpace(name), "-dirty")
+	if m := releaseRe.FindStringSubmatch(name); m != nil {
+		return m[1]
+	}
+	if hashRe.MatchString(name) {
+		return ""
+	}
+	return name
+}
+
+// Return the column key and label of the test
+func matrixKey(t TestHistory, tags bool) (string, string) {
+	name := t.Describe
+	if name == "" {
+		name = t.NameOfTestedCommit
+	}
+
+	if tags {
+		tag := releaseTag(name)
+		return tag, tag
+	}
+	if t.TestedCommit == "" {
+		return "", ""
+	}
+	if name == "" {
+		name = t.TestedCommit
+		if len(name) > 12 {
+			name = name[:12]
+		}
+	}
+	return t.TestedCommit, name
+}
+
+// GetMatrix returns the status of the matching boards for the newest
+// tested commits or release tags
+func (s *Store) GetMatrix(f MatrixFilter) (*Matrix, error) {
+	var boards []Board
+
+	db := s.db
+	if f.Manufacturer != "" {
+		db = db.Where("manufacturer = ?", f.Manufacturer)
+	}
+	if f.BoardType != "" {
+		db = db.Where("board_type = ?", f.BoardType)
+	}
+	if f.Family != "" {
+		db = db.Where("family = ?", f.Family)
+	}
+	if err := db.Order("name").Find(&boards).Error; err != nil {
+		return nil, err
+	}
+	if f.Limit <= 0 || f.Limit > 200 {
+		f.Limit = 20
+	}
+
+	columns := map[string]*MatrixColumn{}
+	cells := make([]map[string]*MatrixCell, len(boards))
+
+	for i, b := range boards {
+		history, err := testHistory(s.db, b.ID)
+		if err != nil {
+			return nil, err
+		}
+		cells[i] = map[string]*MatrixCell{}
+
+		for _, t := range history {
+			key, label := matrixKey(t, f.Tags)
+			if key == "" {
+				continue
+			}
+
+			col, ok := columns[key]
+			if !ok {
+				col = &MatrixColumn{Key: key, Label: label}
+				columns[key] = col
+			}
+			if t.Position > col.position {
+				col.position = t.Position
+			}
+			if t.commitTime().After(col.time) {
+				col.time = t.commitTime()
+			}
+
+			// History is newest first, the first test of a column wins
+			if _, ok := cells[i][key]; !ok {
+				cells[i][key] = &MatrixCell{
+					TestID:        t.ID,
+					Status:        t.Status,
+					StatusComment: t.StatusComment,
+					Commit:        t.TestedCommit,
+				}
+			}
+		}
+	}
+
+	m := &Matrix{}
+	for _, col := range columns {
+		m.Columns = append(m.Columns, *col)
+	}
+	sort.Slice(m.Columns, func(i, j int) bool {
+		ci, cj := m.Columns[i], m.Columns[j]
+		if ci.position > 0 && cj.position > 0 && ci.position != cj.position {
+			return ci.position > cj.position
+		}
+		if !ci.time.Equal(cj.time) {
+			return ci.time.After(cj.time)
+		}
+		return ci.Key > cj.Key
+	})
+	if len(m.Columns) > f.Limit {
+		m.Columns = m.Columns[:f.Limit]
+	}
+
+	for i, b := range boards {
+		row := MatrixRow{BoardID: b.ID, Board: b.Name, Status: b.Status}
+		for _, col := range m.Columns {
+			row.Cells = append(row.Cells, cells[i][col.Key])
+		}
+		m.Rows = append(m.Rows, row)
+	}
+	return m, nil
+}
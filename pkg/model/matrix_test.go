@@ -0,0 +1,29 @@
+// matrix_test.go
+
+package model
+
+import (
+	"testing"
+)
+
+func TestReleaseTag(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "4.12-123-gabcdef0", want: "4.12"},
+		{name: "4.12-123-gabcdef0-dirty", want: "4.12"},
+		{name: " 4.12\n", want: "4.12"},
+		{name: "4.12-rc1-5-g0123456789ab", want: "4.12-rc1"},
+		{name: "abcdef0", want: ""},
+		{name: "0123456789abcdef0123456789abcdef01234567", want: ""},
+		{name: "", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := releaseTag(tt.name); got != tt.want {
+				t.Errorf("releaseTag(%q) = %q, want %q", tt.name, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,376 @@
+// migrate.go
+
+package model
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Migration is one numbered step of the database schema history.
+// Up applies the step, Down reverts it. Both run inside a transaction.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+}
+
+// MigrationState tells whether a migration has been applied to the database
+type MigrationState struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// schemaVersion is a row of the schema_version table
+type schemaVersion struct {
+	Version   int       `gorm:"primary_key;auto_increment:false"`
+	Name      string    `gorm:"size:255"`
+	AppliedAt time.Time ``
+}
+
+func (schemaVersion) TableName() string {
+	return "schema_version"
+}
+
+// Run every statement in order, stop at the first failure
+func execAll(tx *gorm.DB, stmts ...string) error {
+	for _, stmt := range stmts {
+		if err := tx.Exec(stmt).Error; err != nil {
+			return fmt.Errorf("%v: %s", err, stmt)
+		}
+	}
+	return nil
+}
+
+// Drop the columns of the table. SQLite before 3.35 can't drop columns, the
+// table is copied without them instead. The new table is created from the
+// CREATE TABLE statement of the old one with the column definitions removed,
+// so the constraints of the other columns are kept. So are the rows, the
+// indexes on the other columns and the autoincrement counter.
+func dropColumns(tx *gorm.DB, table string, columns ...string) error {
+	drop := map[string]bool{}
+	for _, c := range columns {
+		drop[c] = true
+	}
+
+	var create string
+	if err := tx.Raw(`SELECT sql FROM sqlite_master WHERE type = 'table' AND name = ?`, table).Row().Scan(&create); err != nil {
+		return fmt.Errorf("Table %s: %v", table, err)
+	}
+	open, end := strings.Index(create, "("), strings.LastIndex(create, ")")
+	if open < 0 || end < open {
+		return fmt.Errorf("Table %s: can't parse %s", table, create)
+	}
+
+	var defs, keep []string
+	for _, def := range splitDefinitions(create[open+1 : end]) {
+		name, isColumn := definitionName(def)
+		if !isColumn {
+			for c := range drop {
+				if usesColumn(def, c) {
+					return fmt.Errorf("Table %s: can't drop column %s, it is used by %s", table, c, strings.TrimSpace(def))
+				}
+			}
+		} else if drop[name] {
+			continue
+		} else {
+			keep = append(keep, fmt.Sprintf(`"%s"`, name))
+		}
+		defs = append(defs, def)
+	}
+	autoincrement := strings.Contains(strings.ToLower(create), "autoincrement")
+
+	// Indexes go away with the old table, keep the ones not using the columns
+	var indexes []string
+	rows, err := tx.Raw(`SELECT name, sql FROM sqlite_master WHERE type = 'index' AND tbl_name = ? AND sql IS NOT NULL`, table).Rows()
+	if err != nil {
+		return err
+	}
+	names := map[string]string{}
+	for rows.Next() {
+		var name, stmt string
+		if err := rows.Scan(&name, &stmt); err != nil {
+			rows.Close()
+			return err
+		}
+		names[name] = stmt
+	}
+	rows.Close()
+	for name, stmt := range names {
+		used, err := indexColumns(tx, name)
+		if err != nil {
+			return err
+		}
+		dropped := false
+		for _, c := range used {
+			dropped = dropped || drop[c]
+		}
+		if !dropped {
+			indexes = append(indexes, stmt)
+		}
+	}
+
+	var seq sql.NullInt64
+	if autoincrement {
+		tx.Raw(`SELECT seq FROM sqlite_sequence WHERE name = ?`, table).Row().Scan(&seq)
+	}
+
+	cols := strings.Join(keep, ",")
+	err = execAll(tx,
+		fmt.Sprintf(`CREATE TABLE "%s__new" (%s)%s`, table, strings.Join(defs, ","), create[end+1:]),
+		fmt.Sprintf(`INSERT INTO "%s__new" (%s) SELECT %s FROM "%s"`, table, cols, cols, table),
+		fmt.Sprintf(`DROP TABLE "%s"`, table),
+		fmt.Sprintf(`ALTER TABLE "%s__new" RENAME TO "%s"`, table, table),
+	)
+	if err != nil {
+		return err
+	}
+	if err := execAll(tx, indexes...); err != nil {
+		return err
+	}
+	if seq.Valid {
+		return tx.Exec(`UPDATE sqlite_sequence SET seq = ? WHERE name = ? AND seq < ?`, seq.Int64, table, seq.Int64).Error
+	}
+	return nil
+}
+
+// Split the column definitions and table constraints of a CREATE TABLE
+// statement at the commas outside of parentheses and quotes. The parts keep
+// their whitespace, joining them with commas gives back the statement.
+func splitDefinitions(body string) []string {
+	var defs []string
+	depth, start := 0, 0
+	var quote byte
+	for i := 0; i < len(body); i++ {
+		c := body[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'' || c == '`':
+			quote = c
+		case c == '[':
+			quote = ']'
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ',' && depth == 0:
+			defs = append(defs, body[start:i])
+			start = i + 1
+		}
+	}
+	return append(defs, body[start:])
+}
+
+// Return the column name of a definition, isColumn is false for table
+// constraints
+func definitionName(def string) (name string, isColumn bool) {
+	def = strings.TrimSpace(def)
+	fields := strings.Fields(strings.ToUpper(def))
+	if len(fields) == 0 {
+		return "", false
+	}
+	for _, kw := range []string{"CONSTRAINT", "PRIMARY", "UNIQUE", "CHECK", "FOREIGN"} {
+		if fields[0] == kw || strings.HasPrefix(fields[0], kw+"(") {
+			return "", false
+		}
+	}
+
+	switch def[0] {
+	case '"', '\'', '`', '[':
+		closing := def[0]
+		if closing == '[' {
+			closing = ']'
+		}
+		if i := strings.IndexByte(def[1:], closing); i >= 0 {
+			return def[1 : i+1], true
+		}
+	}
+	if i := strings.IndexAny(def, " \t\n\r("); i >= 0 {
+		return def[:i], true
+	}
+	return def, true
+}
+
+// Tell if the table constraint refers to the column
+func usesColumn(def, column string) bool {
+	re := regexp.MustCompile(`(?i)(^|[^\w$])["'\x60\[]?` + regexp.QuoteMeta(column) + `["'\x60\]]?([^\w$]|$)`)
+	return re.MatchString(def)
+}
+
+// Return the columns of the index
+func indexColumns(tx *gorm.DB, index string) ([]string, error) {
+	rows, err := tx.Raw(fmt.Sprintf(`PRAGMA index_info("%s")`, index)).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var cols []string
+	for rows.Next() {
+		var seqno, cid int
+		var name sql.NullString
+		if err := rows.Scan(&seqno, &cid, &name); err != nil {
+			return nil, err
+		}
+		cols = append(cols, name.String)
+	}
+	return cols, nil
+}
+
+// Create the schema_version table if it doesn't exist yet
+func (s *Store) initSchemaVersion() error {
+	return execAll(s.db, `CREATE TABLE IF NOT EXISTS "schema_version" ("version" integer primary key,"name" varchar(255),"applied_at" datetime )`)
+}
+
+// Return the applied migrations keyed by version
+func (s *Store) appliedMigrations() (map[int]schemaVersion, error) {
+	if err := s.initSchemaVersion(); err != nil {
+		return nil, err
+	}
+
+	var rows []schemaVersion
+	if err := s.db.Order("version").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	applied := map[int]schemaVersion{}
+	for _, r := range rows {
+		applied[r.Version] = r
+	}
+	return applied, nil
+}
+
+// SchemaVersion returns the version of the newest applied migration
+func (s *Store) SchemaVersion() (int, error) {
+	applied, err := s.appliedMigrations()
+	if err != nil {
+		return 0, err
+	}
+
+	version := 0
+	for v := range applied {
+		if v > version {
+			version = v
+		}
+	}
+	return version, nil
+}
+
+// LatestSchemaVersion returns the version the code expects the database to be at
+func LatestSchemaVersion() int {
+	if len(migrations) == 0 {
+		return 0
+	}
+	return migrations[len(migrations)-1].Version
+}
+
+// MigrationStatus lists all known migrations and whether they are applied
+func (s *Store) MigrationStatus() ([]MigrationState, error) {
+	applied, err := s.appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var states []MigrationState
+	for _, m := range migrations {
+		r, ok := applied[m.Version]
+		states = append(states, MigrationState{
+			Migration: m,
+			Applied:   ok,
+			AppliedAt: r.AppliedAt,
+		})
+	}
+	return states, nil
+}
+
+// Run fn inside a transaction, roll back if it fails
+func (s *Store) transaction(fn func(tx *gorm.DB) error) error {
+	tx := s.db.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// MigrateUp applies all pending migrations in order and returns the applied ones
+func (s *Store) MigrateUp() ([]Migration, error) {
+	applied, err := s.appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		err := s.transaction(func(tx *gorm.DB) error {
+			if err := m.Up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&schemaVersion{
+				Version:   m.Version,
+				Name:      m.Name,
+				AppliedAt: time.Now(),
+			}).Error
+		})
+		if err != nil {
+			return done, fmt.Errorf("Migration %d (%s) failed: %v", m.Version, m.Name, err)
+		}
+		done = append(done, m)
+	}
+	return done, nil
+}
+
+// MigrateDown reverts the newest applied migration. It returns nil if there
+// is nothing left to revert.
+func (s *Store) MigrateDown() (*Migration, error) {
+	applied, err := s.appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := len(migrations) - 1; i >= 0; i-- {
+		m := migrations[i]
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		err := s.transaction(func(tx *gorm.DB) error {
+			if err := m.Down(tx); err != nil {
+				return err
+			}
+			return tx.Delete(&schemaVersion{Version: m.Version}).Error
+		})
+		if err != nil {
+			return nil, fmt.Errorf("Reverting migration %d (%s) failed: %v", m.Version, m.Name, err)
+		}
+		return &m, nil
+	}
+	return nil, nil
+}
+
+// CheckSchema returns an error if the database isn't at the latest version
+func (s *Store) CheckSchema() error {
+	version, err := s.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	if version != LatestSchemaVersion() {
+		return fmt.Errorf("Database schema is at version %d, expected %d. Run 'boardstatus migrate up'",
+			version, LatestSchemaVersion())
+	}
+	return nil
+}
@@ -0,0 +1,298 @@
+// migrate_test.go
+
+package model
+
+import (
+	"strings"
+	"testing"
+)
+
+// Revert migrations until the database is at the version
+func migrateDownTo(t *testing.T, s *Store, version int) {
+	t.Helper()
+	for {
+		v, err := s.SchemaVersion()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v <= version {
+			return
+		}
+		if _, err := s.MigrateDown(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func countRows(t *testing.T, s *Store, table string) int {
+	t.Helper()
+	var n int
+	if err := s.db.Table(table).Count(&n).Error; err != nil {
+		t.Fatalf("Counting %s: %v", table, err)
+	}
+	return n
+}
+
+func TestMigrateUpDown(t *testing.T) {
+	s := openTestStore(t)
+	if err := s.CheckSchema(); err == nil {
+		t.Errorf("CheckSchema of an empty database succeeded")
+	}
+
+	done, err := s.MigrateUp()
+	if err != nil {
+		t.Fatalf("MigrateUp: %v", err)
+	}
+	if len(done) != len(migrations) {
+		t.Errorf("MigrateUp applied %d migrations, want %d", len(done), len(migrations))
+	}
+	if err := s.CheckSchema(); err != nil {
+		t.Errorf("CheckSchema: %v", err)
+	}
+	if done, err := s.MigrateUp(); err != nil || len(done) != 0 {
+		t.Errorf("MigrateUp of a migrated database = %v, %v", done, err)
+	}
+
+	for i := len(migrations) - 1; i >= 0; i-- {
+		m, err := s.MigrateDown()
+		if err != nil {
+			t.Fatalf("MigrateDown: %v", err)
+		}
+		if m == nil || m.Version != migrations[i].Version {
+			t.Fatalf("MigrateDown reverted %v, want version %d", m, migrations[i].Version)
+		}
+	}
+	if m, err := s.MigrateDown(); m != nil || err != nil {
+		t.Errorf("MigrateDown of an empty database = %v, %v", m, err)
+	}
+	if s.db.HasTable("boards") {
+		t.Errorf("The boards table is left after reverting all migrations")
+	}
+
+	if _, err := s.MigrateUp(); err != nil {
+		t.Fatalf("MigrateUp after reverting: %v", err)
+	}
+}
+
+func TestMigrateDownKeepsRows(t *testing.T) {
+	s := newTestStore(t)
+	b := createBoard(t, s, "qemu-x86")
+	gone := createBoard(t, s, "gone")
+	test := Test{Name: "boot", BoardID: b.ID, Status: "PASS", Cases: []TestCase{{Name: "boot", Result: "pass"}}}
+	if err := s.CreateTest(&test); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.PurgeBoard(gone.ID); err == nil {
+		t.Fatalf("PurgeBoard of a board outside the trash succeeded")
+	}
+	if err := s.DeleteBoard(gone.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.PurgeBoard(gone.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reverts the columns added to all tables
+	migrateDownTo(t, s, 2)
+	for table, want := range map[string]int{"boards": 1, "tests": 1, "test_cases": 1} {
+		if n := countRows(t, s, table); n != want {
+			t.Errorf("%s has %d rows after migrating down, want %d", table, n, want)
+		}
+	}
+	if s.db.Dialect().HasColumn("tests", "tested_commit") {
+		t.Errorf("tests.tested_commit is left after migrating down")
+	}
+	if !s.db.Dialect().HasIndex("tests", "idx_tests_board_id") {
+		t.Errorf("The index of tests.board_id is gone after migrating down")
+	}
+
+	if _, err := s.MigrateUp(); err != nil {
+		t.Fatalf("MigrateUp: %v", err)
+	}
+	// The ID of the purged board isn't given out again
+	again := createBoard(t, s, "gone")
+	if again.ID <= gone.ID {
+		t.Errorf("New board got ID %d, the purged one had %d", again.ID, gone.ID)
+	}
+	if _, err := s.GetTestByID(int(test.ID)); err != nil {
+		t.Errorf("GetTestByID after migrating: %v", err)
+	}
+}
+
+func TestMigrateLegacyTokens(t *testing.T) {
+	s := newTestStore(t)
+	migrateDownTo(t, s, 16)
+	err := s.db.Exec(`INSERT INTO "users" ("username","api_token","deleted_at") VALUES ('alice','secret',NULL),('bob','',NULL)`).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.MigrateUp(); err != nil {
+		t.Fatalf("MigrateUp: %v", err)
+	}
+
+	if s.db.Dialect().HasColumn("users", "api_token") {
+		t.Errorf("users.api_token is left after migrating")
+	}
+	if u, _, err := s.GetUserByAPIToken("secret"); err == nil {
+		t.Errorf("The former api_token of %s is accepted", u.Username)
+	}
+	if n := countRows(t, s, "api_tokens"); n != 0 {
+		t.Errorf("%d tokens were migrated, want none", n)
+	}
+}
+
+func TestMigrateRoles(t *testing.T) {
+	s := newTestStore(t)
+	migrateDownTo(t, s, 15)
+	err := s.db.Exec(`INSERT INTO "users" ("id","username","api_token","basic_authorization","deleted_at") VALUES (1,'token','t','',NULL),(2,'basic',NULL,'x',NULL),(3,'web','','',NULL),(4,'oauth',NULL,NULL,NULL)`).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.MigrateUp(); err != nil {
+		t.Fatalf("MigrateUp: %v", err)
+	}
+
+	// Nothing tells who uploaded, everybody could before
+	for _, name := range []string{"token", "basic", "web", "oauth"} {
+		u, err := s.GetUserByName(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if u.Role != RoleUploader {
+			t.Errorf("Role of %s = %q, want %q", name, u.Role, RoleUploader)
+		}
+	}
+	if u := createUser(t, s, User{Username: "new"}); u.Role != RoleViewer {
+		t.Errorf("Role of a user created after migrating = %q, want %q", u.Role, RoleViewer)
+	}
+}
+
+func TestMigrateDuplicateNames(t *testing.T) {
+	s := newTestStore(t)
+	migrateDownTo(t, s, 17)
+	if err := s.db.Exec(`INSERT INTO "boards" ("name") VALUES ('qemu-x86'),('qemu-x86')`).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.MigrateUp(); err == nil {
+		t.Fatalf("MigrateUp with duplicate board names succeeded")
+	}
+	if err := s.db.Exec(`UPDATE "boards" SET "deleted_at" = CURRENT_TIMESTAMP WHERE "id" = 2`).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.MigrateUp(); err != nil {
+		t.Fatalf("MigrateUp with the duplicate in the trash: %v", err)
+	}
+}
+
+// Return the statements creating the tables and indexes, keyed by name
+func schema(t *testing.T, s *Store) map[string]string {
+	t.Helper()
+	rows, err := s.db.Raw(`SELECT name, sql FROM sqlite_master WHERE sql IS NOT NULL`).Rows()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	stmts := map[string]string{}
+	for rows.Next() {
+		var name, stmt string
+		if err := rows.Scan(&name, &stmt); err != nil {
+			t.Fatal(err)
+		}
+		stmts[name] = stmt
+	}
+	return stmts
+}
+
+func TestMigrateDownUpKeepsSchema(t *testing.T) {
+	// An existing database, adopted by the first migration, with a
+	// constraint the migrations don't know about
+	var create string
+	s := openTestStore(t)
+	if err := migrations[0].Up(s.db); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.db.Raw(`SELECT sql FROM sqlite_master WHERE name = 'boards'`).Row().Scan(&create); err != nil {
+		t.Fatal(err)
+	}
+	err := execAll(s.db,
+		`DROP TABLE "boards"`,
+		strings.TrimSuffix(create, ")")+`, CHECK ("name" != ''))`,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.MigrateUp(); err != nil {
+		t.Fatalf("MigrateUp: %v", err)
+	}
+	want := schema(t, s)
+
+	// Reverts the columns added to the tables of the first migration
+	migrateDownTo(t, s, 1)
+	if _, err := s.MigrateUp(); err != nil {
+		t.Fatalf("MigrateUp: %v", err)
+	}
+	got := schema(t, s)
+	for name := range want {
+		if got[name] != want[name] {
+			t.Errorf("%s after migrating down and up:\n%s\nwant\n%s", name, got[name], want[name])
+		}
+	}
+	for name := range got {
+		if _, ok := want[name]; !ok {
+			t.Errorf("%s is new after migrating down and up", name)
+		}
+	}
+	if err := s.db.Exec(`INSERT INTO "boards" ("name") VALUES ('')`).Error; err == nil {
+		t.Errorf("The constraint on boards.name is gone after migrating down and up")
+	}
+}
+
+func TestDropColumns(t *testing.T) {
+	s := newTestStore(t)
+	err := execAll(s.db,
+		`CREATE TABLE "parts" ("id" integer primary key autoincrement,"serial" varchar(255) NOT NULL UNIQUE,`+
+			`"kind" varchar(16) DEFAULT 'cpu' CHECK ("kind" IN ('cpu', 'ram')),"name" text COLLATE NOCASE,`+
+			`"board_id" integer REFERENCES "boards"("id"), CHECK ("serial" != ''))`,
+		`ALTER TABLE "parts" ADD COLUMN "extra" varchar(255)`,
+		`CREATE INDEX idx_parts_name ON "parts"(name)`,
+		`CREATE INDEX idx_parts_extra ON "parts"(extra)`,
+		`INSERT INTO "parts" ("serial","name","extra") VALUES ('1','CPU','x')`,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dropColumns(s.db, "parts", "extra"); err != nil {
+		t.Fatalf("dropColumns: %v", err)
+	}
+
+	if s.db.Dialect().HasColumn("parts", "extra") {
+		t.Errorf("parts.extra is left")
+	}
+	if !s.db.Dialect().HasIndex("parts", "idx_parts_name") || s.db.Dialect().HasIndex("parts", "idx_parts_extra") {
+		t.Errorf("The index of parts.name is gone or the one of parts.extra is left")
+	}
+	if n := countRows(t, s, "parts"); n != 1 {
+		t.Errorf("parts has %d rows, want 1", n)
+	}
+
+	for _, stmt := range []string{
+		`INSERT INTO "parts" ("serial") VALUES ('1')`,
+		`INSERT INTO "parts" ("serial") VALUES (NULL)`,
+		`INSERT INTO "parts" ("serial") VALUES ('')`,
+		`INSERT INTO "parts" ("serial","kind") VALUES ('2','gpu')`,
+		`INSERT INTO "parts" ("serial","board_id") VALUES ('3',1000)`,
+	} {
+		if err := s.db.Exec(stmt).Error; err == nil {
+			t.Errorf("Constraint is gone, %s succeeded", stmt)
+		}
+	}
+	var n int
+	s.db.Table("parts").Where(`"name" = 'cpu'`).Count(&n)
+	if n != 1 {
+		t.Errorf("The collation of parts.name is gone")
+	}
+
+	if err := dropColumns(s.db, "parts", "serial"); err == nil {
+		t.Errorf("Dropping a column used by a table constraint succeeded")
+	}
+}
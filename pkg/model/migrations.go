@@ -0,0 +1,357 @@
+// migrations.go
+
+package model
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+)
+
+// All schema migrations, ordered by version. Never modify a migration that
+// has been released, add a new one instead.
+var migrations = []Migration{
+	{
+		// Matches the tables AutoMigrate used to create, so existing
+		// databases are adopted as version 1 without changes.
+		Version: 1,
+		Name:    "initial schema",
+		Up: func(tx *gorm.DB) error {
+			return execAll(tx,
+				`CREATE TABLE IF NOT EXISTS "boards" ("id" integer primary key autoincrement,"created_at" datetime,"updated_at" datetime,"deleted_at" datetime,"name" varchar(255),"manufacturer" varchar(255),"product_name" varchar(255),"version" varchar(255),"sku" varchar(255),"family" varchar(255),"board_type" varchar(255),"enclosure" varchar(255),"northbridge_name" varchar(255),"southbridge_name" varchar(255),"super_io_name" varchar(255),"ec_name" varchar(255),"flash_ic_name" varchar(255),"flash_ic_capacity_in_byte" integer,"processor_manufacturer" varchar(255),"processor_family" varchar(255),"processor_type" varchar(255),"processor_socket" varchar(255),"processor_socket_count" integer,"max_memory_slots" integer,"max_supported_memory_in_gb" integer,"soldered_down_memory_in_gb" integer,"first_commit" varchar(255),"last_commit" varchar(255),"last_failed_commit" varchar(255),"last_good_commit" varchar(255),"tested_commit" varchar(255),"name_of_tested_commit" varchar(255),"tested_commit_time" datetime,"status" varchar(255),"status_comment" varchar(255),"comment" text )`,
+				`CREATE INDEX IF NOT EXISTS idx_boards_deleted_at ON "boards"(deleted_at)`,
+				`CREATE TABLE IF NOT EXISTS "tests" ("id" integer primary key autoincrement,"created_at" datetime,"updated_at" datetime,"deleted_at" datetime,"name" varchar(255),"time" datetime,"checksum" varchar(255),"reference_external_validation" varchar(255),"failed_tests_count" integer,"passed_tests_count" integer,"skipped_tests_count" integer,"file_kernel_log" blob,"file_cmos" blob,"file_config" blob,"file_bootlog" blob,"file_timestamps" blob,"file_payloadconfig" blob,"status" varchar(255),"status_comment" varchar(255),"comment" text,"board_id" integer )`,
+				`CREATE INDEX IF NOT EXISTS idx_tests_deleted_at ON "tests"(deleted_at)`,
+				`CREATE TABLE IF NOT EXISTS "test_cases" ("id" integer primary key autoincrement,"created_at" datetime,"updated_at" datetime,"deleted_at" datetime,"name" text,"result" text,"test_id" integer )`,
+				`CREATE INDEX IF NOT EXISTS idx_test_cases_deleted_at ON "test_cases"(deleted_at)`,
+				`CREATE TABLE IF NOT EXISTS "users" ("id" integer primary key autoincrement,"created_at" datetime,"updated_at" datetime,"deleted_at" datetime,"username" varchar(255),"name" varchar(255),"email" varchar(255),"hidden" bool,"is_admin" bool,"profile_picture_url" varchar(255),"o_auth_provider" varchar(255),"api_token" varchar(255),"basic_authorization" varchar(255),"password_hash" varchar(255) )`,
+				`CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON "users"(deleted_at)`,
+			)
+		},
+		Down: func(tx *gorm.DB) error {
+			return execAll(tx,
+				`DROP TABLE IF EXISTS "users"`,
+				`DROP TABLE IF EXISTS "test_cases"`,
+				`DROP TABLE IF EXISTS "tests"`,
+				`DROP TABLE IF EXISTS "boards"`,
+			)
+		},
+	},
+	{
+		// Lookups by foreign key and by username happen on every request
+		Version: 2,
+		Name:    "lookup indexes",
+		Up: func(tx *gorm.DB) error {
+			return execAll(tx,
+				`CREATE INDEX IF NOT EXISTS idx_tests_board_id ON "tests"(board_id)`,
+				`CREATE INDEX IF NOT EXISTS idx_test_cases_test_id ON "test_cases"(test_id)`,
+				`CREATE INDEX IF NOT EXISTS idx_users_username ON "users"(username)`,
+			)
+		},
+		Down: func(tx *gorm.DB) error {
+			return execAll(tx,
+				`DROP INDEX IF EXISTS idx_users_username`,
+				`DROP INDEX IF EXISTS idx_test_cases_test_id`,
+				`DROP INDEX IF EXISTS idx_tests_board_id`,
+			)
+		},
+	},
+	{
+		Version: 3,
+		Name:    "tested commit of tests, mainboard directory of boards",
+		Up: func(tx *gorm.DB) error {
+			return execAll(tx,
+				`ALTER TABLE "tests" ADD COLUMN "tested_commit" varchar(255)`,
+				`ALTER TABLE "tests" ADD COLUMN "name_of_tested_commit" varchar(255)`,
+				`ALTER TABLE "boards" ADD COLUMN "mainboard_dir" varchar(255)`,
+				`CREATE INDEX IF NOT EXISTS idx_boards_mainboard_dir ON "boards"(mainboard_dir)`,
+			)
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := execAll(tx,
+				`DROP INDEX IF EXISTS idx_boards_mainboard_dir`,
+			); err != nil {
+				return err
+			}
+			if err := dropColumns(tx, "boards", "mainboard_dir"); err != nil {
+				return err
+			}
+			return dropColumns(tx, "tests", "name_of_tested_commit", "tested_commit")
+		},
+	},
+	{
+		Version: 4,
+		Name:    "commit time of tests",
+		Up: func(tx *gorm.DB) error {
+			return execAll(tx,
+				`ALTER TABLE "tests" ADD COLUMN "tested_commit_time" datetime`,
+			)
+		},
+		Down: func(tx *gorm.DB) error {
+			return dropColumns(tx, "tests", "tested_commit_time")
+		},
+	},
+	{
+		Version: 5,
+		Name:    "test case duration, message and error count",
+		Up: func(tx *gorm.DB) error {
+			return execAll(tx,
+				`ALTER TABLE "test_cases" ADD COLUMN "duration" real`,
+				`ALTER TABLE "test_cases" ADD COLUMN "message" text`,
+				`UPDATE "test_cases" SET "result" = lower(trim("result"))`,
+				`CREATE INDEX IF NOT EXISTS idx_test_cases_name ON "test_cases"(name)`,
+				`ALTER TABLE "tests" ADD COLUMN "error_tests_count" integer`,
+			)
+		},
+		// One way for the results: they stay lower case and trimmed, the
+		// original spelling is gone
+		Down: func(tx *gorm.DB) error {
+			if err := dropColumns(tx, "tests", "error_tests_count"); err != nil {
+				return err
+			}
+			if err := execAll(tx,
+				`DROP INDEX IF EXISTS idx_test_cases_name`,
+			); err != nil {
+				return err
+			}
+			return dropColumns(tx, "test_cases", "message", "duration")
+		},
+	},
+	{
+		Version: 6,
+		Name:    "test case suite",
+		Up: func(tx *gorm.DB) error {
+			return execAll(tx,
+				`ALTER TABLE "test_cases" ADD COLUMN "suite" varchar(255)`,
+			)
+		},
+		Down: func(tx *gorm.DB) error {
+			return dropColumns(tx, "test_cases", "suite")
+		},
+	},
+	{
+		Version: 7,
+		Name:    "external validation index",
+		Up: func(tx *gorm.DB) error {
+			return execAll(tx,
+				`CREATE INDEX IF NOT EXISTS idx_tests_reference_external_validation ON "tests"(reference_external_validation)`,
+			)
+		},
+		Down: func(tx *gorm.DB) error {
+			return execAll(tx,
+				`DROP INDEX IF EXISTS idx_tests_reference_external_validation`,
+			)
+		},
+	},
+	{
+		Version: 8,
+		Name:    "commits",
+		Up: func(tx *gorm.DB) error {
+			return execAll(tx,
+				`CREATE TABLE IF NOT EXISTS "commits" ("id" integer primary key autoincrement,"created_at" datetime,"updated_at" datetime,"deleted_at" datetime,"hash" varchar(40),"subject" varchar(65536),"author" varchar(255),"author_date" datetime,"commit_date" datetime,"describe" varchar(255),"on_master" bool,"position" integer )`,
+				`CREATE INDEX IF NOT EXISTS idx_commits_deleted_at ON "commits"(deleted_at)`,
+				`CREATE UNIQUE INDEX IF NOT EXISTS uix_commits_hash ON "commits"(hash)`,
+				`CREATE INDEX IF NOT EXISTS idx_tests_tested_commit ON "tests"(tested_commit)`,
+			)
+		},
+		Down: func(tx *gorm.DB) error {
+			return execAll(tx,
+				`DROP INDEX IF EXISTS idx_tests_tested_commit`,
+				`DROP TABLE IF EXISTS "commits"`,
+			)
+		},
+	},
+	{
+		Version: 9,
+		Name:    "regressions",
+		Up: func(tx *gorm.DB) error {
+			return execAll(tx,
+				`CREATE TABLE IF NOT EXISTS "regressions" ("id" integer primary key autoincrement,"created_at" datetime,"updated_at" datetime,"deleted_at" datetime,"test_id" integer,"previous_test_id" integer,"board_id" integer,"name" varchar(65536),"kind" varchar(255),"old_result" varchar(255),"new_result" varchar(255) )`,
+				`CREATE INDEX IF NOT EXISTS idx_regressions_deleted_at ON "regressions"(deleted_at)`,
+				`CREATE INDEX IF NOT EXISTS idx_regressions_test_id ON "regressions"(test_id)`,
+				`CREATE INDEX IF NOT EXISTS idx_regressions_board_id ON "regressions"(board_id)`,
+			)
+		},
+		Down: func(tx *gorm.DB) error {
+			return execAll(tx,
+				`DROP TABLE IF EXISTS "regressions"`,
+			)
+		},
+	},
+	{
+		Version: 10,
+		Name:    "flaky test cases",
+		Up: func(tx *gorm.DB) error {
+			return execAll(tx,
+				`CREATE TABLE IF NOT EXISTS "flaky_cases" ("id" integer primary key autoincrement,"created_at" datetime,"updated_at" datetime,"deleted_at" datetime,"board_id" integer,"name" varchar(65536),"runs" integer,"flips" integer,"flip_rate" real,"flaky" bool )`,
+				`CREATE INDEX IF NOT EXISTS idx_flaky_cases_deleted_at ON "flaky_cases"(deleted_at)`,
+				`CREATE INDEX IF NOT EXISTS idx_flaky_cases_board_id ON "flaky_cases"(board_id)`,
+			)
+		},
+		Down: func(tx *gorm.DB) error {
+			return execAll(tx,
+				`DROP TABLE IF EXISTS "flaky_cases"`,
+			)
+		},
+	},
+	{
+		Version: 11,
+		Name:    "boot stages",
+		Up: func(tx *gorm.DB) error {
+			return execAll(tx,
+				`CREATE TABLE IF NOT EXISTS "boot_stages" ("id" integer primary key autoincrement,"created_at" datetime,"updated_at" datetime,"deleted_at" datetime,"test_id" integer,"seq" integer,"stage_id" integer,"name" varchar(255),"time" bigint,"duration" bigint )`,
+				`CREATE INDEX IF NOT EXISTS idx_boot_stages_deleted_at ON "boot_stages"(deleted_at)`,
+				`CREATE INDEX IF NOT EXISTS idx_boot_stages_test_id ON "boot_stages"(test_id)`,
+				`ALTER TABLE "tests" ADD COLUMN "boot_time" bigint`,
+			)
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := dropColumns(tx, "tests", "boot_time"); err != nil {
+				return err
+			}
+			return execAll(tx,
+				`DROP TABLE IF EXISTS "boot_stages"`,
+			)
+		},
+	},
+	{
+		Version: 12,
+		Name:    "config options",
+		Up: func(tx *gorm.DB) error {
+			return execAll(tx,
+				`CREATE TABLE IF NOT EXISTS "config_options" ("id" integer primary key autoincrement,"created_at" datetime,"updated_at" datetime,"deleted_at" datetime,"test_id" integer,"name" varchar(255),"value" varchar(65536) )`,
+				`CREATE INDEX IF NOT EXISTS idx_config_options_deleted_at ON "config_options"(deleted_at)`,
+				`CREATE INDEX IF NOT EXISTS idx_config_options_test_id_name ON "config_options"(test_id, name)`,
+			)
+		},
+		Down: func(tx *gorm.DB) error {
+			return execAll(tx,
+				`DROP TABLE IF EXISTS "config_options"`,
+			)
+		},
+	},
+	{
+		Version: 13,
+		Name:    "cmos layout",
+		Up: func(tx *gorm.DB) error {
+			return execAll(tx,
+				`ALTER TABLE "tests" ADD COLUMN "file_cmos_layout" blob`,
+			)
+		},
+		Down: func(tx *gorm.DB) error {
+			return dropColumns(tx, "tests", "file_cmos_layout")
+		},
+	},
+	{
+		Version: 14,
+		Name:    "smbios",
+		Up: func(tx *gorm.DB) error {
+			return execAll(tx,
+				`ALTER TABLE "tests" ADD COLUMN "file_smbios" blob`,
+				`CREATE INDEX IF NOT EXISTS idx_boards_product ON "boards"(manufacturer, product_name)`,
+			)
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := execAll(tx,
+				`DROP INDEX IF EXISTS idx_boards_product`,
+			); err != nil {
+				return err
+			}
+			return dropColumns(tx, "tests", "file_smbios")
+		},
+	},
+	{
+		Version: 15,
+		Name:    "audit log",
+		Up: func(tx *gorm.DB) error {
+			return execAll(tx,
+				`CREATE TABLE IF NOT EXISTS "audit_entries" ("id" integer primary key autoincrement,"created_at" datetime,"updated_at" datetime,"deleted_at" datetime,"kind" varchar(255),"record_id" integer,"action" varchar(255),"actor_id" integer,"actor" varchar(255),"source" varchar(255),"changes" text )`,
+				`CREATE INDEX IF NOT EXISTS idx_audit_entries_deleted_at ON "audit_entries"(deleted_at)`,
+				`CREATE INDEX IF NOT EXISTS idx_audit_entries_kind_record_id ON "audit_entries"(kind, record_id)`,
+				`CREATE INDEX IF NOT EXISTS idx_audit_entries_created_at ON "audit_entries"(created_at)`,
+			)
+		},
+		Down: func(tx *gorm.DB) error {
+			return execAll(tx,
+				`DROP TABLE IF EXISTS "audit_entries"`,
+			)
+		},
+	},
+	{
+		Version: 16,
+		Name:    "roles",
+		Up: func(tx *gorm.DB) error {
+			return execAll(tx,
+				`ALTER TABLE "users" ADD COLUMN "role" varchar(255) DEFAULT 'viewer'`,
+				// Everybody could upload before and the tests don't record
+				// who uploaded them, existing users keep uploading. New
+				// users start as viewers.
+				`UPDATE "users" SET "role" = 'uploader'`,
+				`CREATE TABLE IF NOT EXISTS "board_maintainers" ("board_id" integer,"user_id" integer, PRIMARY KEY ("board_id","user_id"))`,
+				`CREATE INDEX IF NOT EXISTS idx_board_maintainers_user_id ON "board_maintainers"(user_id)`,
+			)
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := execAll(tx,
+				`DROP TABLE IF EXISTS "board_maintainers"`,
+			); err != nil {
+				return err
+			}
+			return dropColumns(tx, "users", "role")
+		},
+	},
+	{
+		Version: 17,
+		Name:    "api tokens",
+		Up: func(tx *gorm.DB) error {
+			if err := execAll(tx,
+				`CREATE TABLE IF NOT EXISTS "api_tokens" ("id" integer primary key autoincrement,"created_at" datetime,"updated_at" datetime,"deleted_at" datetime,"user_id" integer,"name" varchar(255),"prefix" varchar(255),"hash" varchar(255),"scopes" varchar(255),"expires_at" datetime,"last_used_at" datetime,"revoked_at" datetime )`,
+				`CREATE INDEX IF NOT EXISTS idx_api_tokens_deleted_at ON "api_tokens"(deleted_at)`,
+				`CREATE INDEX IF NOT EXISTS idx_api_tokens_user_id ON "api_tokens"(user_id)`,
+				`CREATE UNIQUE INDEX IF NOT EXISTS uix_api_tokens_hash ON "api_tokens"(hash)`,
+			); err != nil {
+				return err
+			}
+			// The plaintext tokens of before can be old passwords, they
+			// are dropped. Users create new tokens instead.
+			return dropColumns(tx, "users", "api_token")
+		},
+		// The plaintext tokens can't be restored from their hashes
+		Down: func(tx *gorm.DB) error {
+			return execAll(tx,
+				`ALTER TABLE "users" ADD COLUMN "api_token" varchar(255)`,
+				`DROP TABLE IF EXISTS "api_tokens"`,
+			)
+		},
+	},
+	{
+		// Validation checks the names too, the indexes catch concurrent
+		// requests. Deleted records keep their names for restoring them.
+		Version: 18,
+		Name:    "unique names",
+		Up: func(tx *gorm.DB) error {
+			for _, c := range []struct{ table, column string }{{"boards", "name"}, {"users", "username"}} {
+				var taken []string
+				err := tx.Table(c.table).Where("deleted_at IS NULL").Group(c.column).
+					Having("count(*) > 1").Pluck(c.column, &taken).Error
+				if err != nil {
+					return err
+				}
+				if len(taken) > 0 {
+					return fmt.Errorf("Rename the %s sharing the %s %s first", c.table, c.column, strings.Join(taken, ", "))
+				}
+			}
+			return execAll(tx,
+				`CREATE UNIQUE INDEX IF NOT EXISTS uix_boards_name ON "boards"(name) WHERE deleted_at IS NULL`,
+				`CREATE UNIQUE INDEX IF NOT EXISTS uix_users_username ON "users"(username) WHERE deleted_at IS NULL`,
+			)
+		},
+		Down: func(tx *gorm.DB) error {
+			return execAll(tx,
+				`DROP INDEX IF EXISTS uix_users_username`,
+				`DROP INDEX IF EXISTS uix_boards_name`,
+			)
+		},
+	},
+}
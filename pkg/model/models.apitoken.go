@@ -0,0 +1,223 @@
+// models.apitoken.go
+
+package model
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Scopes of API tokens. A token allows what its user may do in its scopes,
+// reading is always allowed.
+const (
+	// Upload tests
+	ScopeUploadTests = "upload-tests"
+	// Add and change boards and their tests
+	ScopeEditBoards = "edit-boards"
+	// Everything the user may do
+	ScopeAdmin = "admin"
+)
+
+// TokenScopeNames lists the scopes of API tokens
+var TokenScopeNames = []string{ScopeUploadTests, ScopeEditBoards, ScopeAdmin}
+
+// Tokens start with this, to recognize them e.g. in leaked files
+const tokenPrefix = "bst_"
+
+// Tokens expire after at most this many days
+const maxTokenDays = 365
+
+// TokenScopes are stored separated by spaces
+type TokenScopes []string
+
+// Value implements driver.Valuer
+func (t TokenScopes) Value() (driver.Value, error) {
+	return strings.Join(t, " "), nil
+}
+
+// Scan implements sql.Scanner
+func (t *TokenScopes) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*t = nil
+	case []byte:
+		*t = strings.Fields(string(v))
+	case string:
+		*t = strings.Fields(v)
+	default:
+		return fmt.Errorf("Cannot scan %T into TokenScopes", src)
+	}
+	return nil
+}
+
+// Has tells if the scope is one of them
+func (t TokenScopes) Has(scope string) bool {
+	for _, s := range t {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// APIToken is a personal token of a user for the API. Only the hash of the
+// token is stored, the token itself is shown once on creation.
+type APIToken struct {
+	gorm.Model
+	UserID uint   `json:"user_id"`
+	Name   string `json:"name" gorm:"size:255" validate:"required"`
+	// The start of the token, to tell them apart
+	Prefix     string      `json:"prefix" gorm:"size:255"`
+	Hash       string      `json:"-" gorm:"size:255"`
+	Scopes     TokenScopes `json:"scopes" gorm:"size:255"`
+	ExpiresAt  time.Time   `json:"expires_at"`
+	LastUsedAt *time.Time  `json:"last_used_at"`
+	RevokedAt  *time.Time  `json:"revoked_at"`
+}
+
+// Active tells if the token can be used
+func (t *APIToken) Active() bool {
+	return t.RevokedAt == nil && time.Now().Before(t.ExpiresAt)
+}
+
+// Allows tells if the scopes of the token cover p
+func (t *APIToken) Allows(p Permission) bool {
+	if t.Scopes.Has(ScopeAdmin) {
+		return true
+	}
+	switch p {
+	case PermUpload:
+		return t.Scopes.Has(ScopeUploadTests)
+	case PermCreateBoard, PermEditBoard, PermEditTest:
+		return t.Scopes.Has(ScopeEditBoards)
+	}
+	return false
+}
+
+// AuthorizeToken is Authorize for requests authenticated with the token t,
+// which must have the scope for p in addition. t is nil for other requests.
+func (s *Store) AuthorizeToken(u *User, t *APIToken, p Permission, id uint) error {
+	if t != nil && !t.Allows(p) {
+		return &ForbiddenError{fmt.Sprintf("The API token %q doesn't have the scope for this", t.Name)}
+	}
+	return s.Authorize(u, p, id)
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateAPIToken creates a token of the user that expires after the given
+// number of days. Returns the token, which can't be recovered later.
+func (s *Store) CreateAPIToken(userID uint, name string, scopes []string, days int) (*APIToken, string, error) {
+	t := APIToken{
+		UserID:    userID,
+		Name:      strings.TrimSpace(name),
+		ExpiresAt: time.Now().AddDate(0, 0, days),
+	}
+	var errs ValidationErrors
+	if err := s.validate(s.db, &t); err != nil {
+		errs = append(errs, FieldErrors(err)...)
+	}
+	for _, scope := range scopes {
+		if !TokenScopes(TokenScopeNames).Has(scope) {
+			errs = append(errs, &ValidationError{"scopes", "must be one of " + strings.Join(TokenScopeNames, ", ")})
+			break
+		}
+		if !t.Scopes.Has(scope) {
+			t.Scopes = append(t.Scopes, scope)
+		}
+	}
+	if len(t.Scopes) == 0 && len(errs) == 0 {
+		errs = append(errs, &ValidationError{"scopes", "must name at least one scope"})
+	}
+	if days < 1 || days > maxTokenDays {
+		errs = append(errs, &ValidationError{"expires_in_days", fmt.Sprintf("must be between 1 and %d", maxTokenDays)})
+	}
+	if len(errs) > 0 {
+		return nil, "", errs
+	}
+
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, "", err
+	}
+	token := tokenPrefix + base64.RawURLEncoding.EncodeToString(buf)
+	t.Prefix = token[:len(tokenPrefix)+6]
+	t.Hash = hashToken(token)
+
+	err := s.transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&t).Error; err != nil {
+			return err
+		}
+		return s.audit(tx, &User{}, userID, ActionUpdate,
+			FieldChanges{{"api_tokens", "", fmt.Sprintf("created %q (%s)", t.Name, t.Prefix)}})
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return &t, token, nil
+}
+
+// APITokens returns the tokens of the user, the newest first
+func (s *Store) APITokens(userID uint) ([]APIToken, error) {
+	var tokens []APIToken
+	if err := s.db.Where("user_id = ?", userID).Order("id DESC").Find(&tokens).Error; err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// RevokeAPIToken revokes the token of the user, ErrRecordNotFound if the user
+// has no such token
+func (s *Store) RevokeAPIToken(userID, id uint) error {
+	return s.transaction(func(tx *gorm.DB) error {
+		var t APIToken
+		if err := tx.Where("user_id = ?", userID).First(&t, id).Error; err != nil {
+			return err
+		}
+		if t.RevokedAt != nil {
+			return nil
+		}
+		if err := tx.Model(&t).UpdateColumn("revoked_at", gorm.NowFunc()).Error; err != nil {
+			return err
+		}
+		return s.audit(tx, &User{}, userID, ActionUpdate,
+			FieldChanges{{"api_tokens", "", fmt.Sprintf("revoked %q (%s)", t.Name, t.Prefix)}})
+	})
+}
+
+// GetUserByAPIToken returns the user of an active token and the token, which
+// is marked as used
+func (s *Store) GetUserByAPIToken(token string) (*User, *APIToken, error) {
+	if token == "" {
+		return nil, nil, fmt.Errorf("Not an API token")
+	}
+	var t APIToken
+	if err := s.db.Where("hash = ?", hashToken(token)).First(&t).Error; err != nil {
+		return nil, nil, err
+	}
+	if !t.Active() {
+		return nil, nil, fmt.Errorf("The API token is expired or revoked")
+	}
+	u, err := s.GetUserByID(int(t.UserID))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := gorm.NowFunc()
+	if err := s.db.Model(&t).UpdateColumn("last_used_at", now).Error; err != nil {
+		return nil, nil, err
+	}
+	t.LastUsedAt = &now
+	return u, &t, nil
+}
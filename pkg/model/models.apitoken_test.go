@@ -0,0 +1,208 @@
+// models.apitoken_test.go
+
+package model
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+func TestCreateAPIToken(t *testing.T) {
+	s := newTestStore(t)
+	alice := createUser(t, s, User{Username: "alice", Role: RoleUploader})
+
+	tests := []struct {
+		name   string
+		token  string
+		scopes []string
+		days   int
+		field  string
+	}{
+		{name: "upload", token: "lab CI", scopes: []string{ScopeUploadTests}, days: 30},
+		{name: "all scopes", token: " admin ", scopes: []string{ScopeAdmin, ScopeUploadTests, ScopeEditBoards, ScopeAdmin}, days: maxTokenDays},
+		{name: "without name", token: " ", scopes: []string{ScopeUploadTests}, days: 30, field: "name"},
+		{name: "unknown scope", token: "ci", scopes: []string{"delete-everything"}, days: 30, field: "scopes"},
+		{name: "without scopes", token: "ci", days: 30, field: "scopes"},
+		{name: "expired", token: "ci", scopes: []string{ScopeUploadTests}, days: 0, field: "expires_in_days"},
+		{name: "too long", token: "ci", scopes: []string{ScopeUploadTests}, days: maxTokenDays + 1, field: "expires_in_days"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			apiToken, token, err := s.CreateAPIToken(alice.ID, tt.token, tt.scopes, tt.days)
+			if tt.field != "" {
+				errs := FieldErrors(err)
+				if len(errs) != 1 || errs[0].Field != tt.field {
+					t.Fatalf("CreateAPIToken() = %v, want a validation error of %s", err, tt.field)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("CreateAPIToken: %v", err)
+			}
+			if !strings.HasPrefix(token, tokenPrefix) || !strings.HasPrefix(token, apiToken.Prefix) || len(token) < 32 {
+				t.Errorf("Token %q with prefix %q", token, apiToken.Prefix)
+			}
+			if apiToken.Name != strings.TrimSpace(tt.token) || apiToken.UserID != alice.ID {
+				t.Errorf("Token %q of user %d", apiToken.Name, apiToken.UserID)
+			}
+			if days := time.Until(apiToken.ExpiresAt).Hours() / 24; days < float64(tt.days)-1 || days > float64(tt.days) {
+				t.Errorf("Token expires in %.1f days, want %d", days, tt.days)
+			}
+			for _, scope := range tt.scopes {
+				if !apiToken.Scopes.Has(scope) || len(apiToken.Scopes) > len(TokenScopeNames) {
+					t.Errorf("Scopes = %v, want %v", apiToken.Scopes, tt.scopes)
+				}
+			}
+
+			// Only the hash is kept, the token can't be read back
+			var stored APIToken
+			if err := s.db.First(&stored, apiToken.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			if stored.Hash != hashToken(token) || strings.Contains(stored.Hash+stored.Prefix+stored.Name, token) {
+				t.Errorf("Stored token %+v contains the token", stored)
+			}
+		})
+	}
+
+	_, first, _ := s.CreateAPIToken(alice.ID, "first", []string{ScopeUploadTests}, 1)
+	_, second, _ := s.CreateAPIToken(alice.ID, "second", []string{ScopeUploadTests}, 1)
+	if first == second {
+		t.Errorf("Two tokens are the same: %q", first)
+	}
+}
+
+func TestGetUserByAPIToken(t *testing.T) {
+	s := newTestStore(t)
+	alice := createUser(t, s, User{Username: "alice", Role: RoleUploader})
+	bob := createUser(t, s, User{Username: "bob", Role: RoleUploader})
+
+	newToken := func(name string) (*APIToken, string) {
+		t.Helper()
+		apiToken, token, err := s.CreateAPIToken(alice.ID, name, []string{ScopeUploadTests}, 30)
+		if err != nil {
+			t.Fatalf("CreateAPIToken: %v", err)
+		}
+		return apiToken, token
+	}
+
+	active, token := newToken("active")
+	if active.LastUsedAt != nil {
+		t.Errorf("A new token was used at %s", active.LastUsedAt)
+	}
+	u, apiToken, err := s.GetUserByAPIToken(token)
+	if err != nil {
+		t.Fatalf("GetUserByAPIToken: %v", err)
+	}
+	if u.ID != alice.ID || apiToken.ID != active.ID || apiToken.LastUsedAt == nil {
+		t.Errorf("GetUserByAPIToken() = user %d, token %d used at %v", u.ID, apiToken.ID, apiToken.LastUsedAt)
+	}
+	tokens, err := s.APITokens(alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 1 || tokens[0].LastUsedAt == nil || time.Since(*tokens[0].LastUsedAt) > time.Minute {
+		t.Errorf("last_used_at isn't stored: %+v", tokens)
+	}
+
+	expired, expiredToken := newToken("expired")
+	if err := s.db.Model(expired).UpdateColumn("expires_at", time.Now().Add(-time.Second)).Error; err != nil {
+		t.Fatal(err)
+	}
+	revoked, revokedToken := newToken("revoked")
+	if err := s.RevokeAPIToken(bob.ID, revoked.ID); !gorm.IsRecordNotFoundError(err) {
+		t.Errorf("Revoking the token of another user = %v, want ErrRecordNotFound", err)
+	}
+	if err := s.RevokeAPIToken(alice.ID, revoked.ID); err != nil {
+		t.Fatalf("RevokeAPIToken: %v", err)
+	}
+	if err := s.RevokeAPIToken(alice.ID, revoked.ID); err != nil {
+		t.Errorf("Revoking a token again: %v", err)
+	}
+
+	for _, tt := range []struct {
+		name  string
+		token string
+	}{
+		{"expired", expiredToken},
+		{"revoked", revokedToken},
+		{"unknown", token + "x"},
+		{"prefix only", active.Prefix},
+		{"empty", ""},
+	} {
+		if u, _, err := s.GetUserByAPIToken(tt.token); err == nil {
+			t.Errorf("GetUserByAPIToken of a %s token = user %s, want an error", tt.name, u.Username)
+		}
+	}
+	for _, tt := range []*APIToken{expired, revoked} {
+		var stored APIToken
+		if err := s.db.First(&stored, tt.ID).Error; err != nil {
+			t.Fatal(err)
+		}
+		if stored.LastUsedAt != nil {
+			t.Errorf("The rejected token %q is marked as used", stored.Name)
+		}
+	}
+}
+
+func TestAPITokenAllows(t *testing.T) {
+	perms := []Permission{PermUpload, PermCreateBoard, PermEditBoard, PermEditTest, PermEditUser, PermAdmin}
+	tests := []struct {
+		scopes TokenScopes
+		// Whether each of perms is allowed
+		allows []bool
+	}{
+		{TokenScopes{ScopeUploadTests}, []bool{true, false, false, false, false, false}},
+		{TokenScopes{ScopeEditBoards}, []bool{false, true, true, true, false, false}},
+		{TokenScopes{ScopeUploadTests, ScopeEditBoards}, []bool{true, true, true, true, false, false}},
+		{TokenScopes{ScopeAdmin}, []bool{true, true, true, true, true, true}},
+		{nil, []bool{false, false, false, false, false, false}},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.scopes, " "), func(t *testing.T) {
+			token := APIToken{Scopes: tt.scopes}
+			for i, p := range perms {
+				if got := token.Allows(p); got != tt.allows[i] {
+					t.Errorf("Allows(%v) = %v, want %v", p, got, tt.allows[i])
+				}
+			}
+		})
+	}
+}
+
+func TestAuthorizeToken(t *testing.T) {
+	s := newTestStore(t)
+	b := createBoard(t, s, "qemu-x86")
+	uploader := createUser(t, s, User{Username: "lab", Role: RoleUploader})
+	viewer := createUser(t, s, User{Username: "viewer"})
+
+	upload := &APIToken{Name: "upload", Scopes: TokenScopes{ScopeUploadTests}}
+	edit := &APIToken{Name: "edit", Scopes: TokenScopes{ScopeEditBoards}}
+	tests := []struct {
+		name    string
+		user    *User
+		token   *APIToken
+		perm    Permission
+		allowed bool
+	}{
+		{name: "upload scope", user: uploader, token: upload, perm: PermUpload, allowed: true},
+		{name: "without upload scope", user: uploader, token: edit, perm: PermUpload},
+		{name: "without edit scope", user: uploader, token: upload, perm: PermCreateBoard},
+		{name: "without token", user: uploader, perm: PermUpload, allowed: true},
+		{name: "scope beyond the role", user: viewer, token: upload, perm: PermUpload},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.AuthorizeToken(tt.user, tt.token, tt.perm, b.ID)
+			if tt.allowed && err != nil {
+				t.Errorf("AuthorizeToken() = %v, want it allowed", err)
+			}
+			if !tt.allowed && !IsForbiddenError(err) {
+				t.Errorf("AuthorizeToken() = %v, want a forbidden error", err)
+			}
+		})
+	}
+}
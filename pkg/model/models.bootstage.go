@@ -0,0 +1,287 @@
+// models.bootstage.go
+
+package model
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+
+	"github.com/jinzhu/gorm"
+	"github.com/siro20/boardstatus/pkg/parser"
+)
+
+// Stages that took less are too noisy to compare
+const minComparedStageDuration = 1000 // microseconds
+
+// BootStage is an entry of the cbmem timestamps of a test
+type BootStage struct {
+	gorm.Model
+	TestID   uint   `json:"test_id" yaml:"test_id"`
+	Seq      int    `json:"seq" yaml:"seq"`           // position in the timestamp table
+	StageID  int    `json:"stage_id" yaml:"stage_id"` // coreboot's timestamp ID
+	Name     string `json:"name" yaml:"name" gorm:"size:255"`
+	Time     int64  `json:"time_us" yaml:"time_us"`         // since the first timestamp
+	Duration int64  `json:"duration_us" yaml:"duration_us"` // since the previous entry
+}
+
+// SetBootTimeThreshold sets by how many percent the boot time or a stage
+// has to grow compared to the previous test to count as regression. 0
+// disables the check.
+func (s *Store) SetBootTimeThreshold(percent float64) {
+	s.bootTimeThreshold = percent
+}
+
+// Parse the cbmem timestamps of the test into BootStages and BootTime.
+// Files that can't be parsed are kept as they are.
+func (t *Test) prepareBootStages() {
+	t.BootStages = nil
+	t.BootTime = 0
+	if len(t.FileTimestamps) == 0 {
+		return
+	}
+
+	stamps, total, err := parser.ParseTimestamps(bytes.NewReader(t.FileTimestamps))
+	if err != nil {
+		return
+	}
+	for i, ts := range stamps {
+		t.BootStages = append(t.BootStages, BootStage{
+			Seq:      i,
+			StageID:  ts.ID,
+			Name:     ts.Name,
+			Time:     ts.Time,
+			Duration: ts.Duration,
+		})
+	}
+	t.BootTime = total
+}
+
+// Load the stage durations of the test by name
+func stageDurations(tx *gorm.DB, testID uint) (map[string]int64, []string, error) {
+	var stages []BootStage
+
+	if err := tx.Where("test_id = ?", testID).Order("seq").Find(&stages).Error; err != nil {
+		return nil, nil, err
+	}
+	durations, names := numberStages(stages)
+	return durations, names, nil
+}
+
+// Return the durations of the stages of a test, in order, by name. Stages
+// reached more than once are numbered, e.g. "finished loading #2".
+func numberStages(stages []BootStage) (map[string]int64, []string) {
+	durations := map[string]int64{}
+	var names []string
+	seen := map[string]int{}
+	for _, st := range stages {
+		name := st.Name
+		seen[st.Name]++
+		if n := seen[st.Name]; n > 1 {
+			name = fmt.Sprintf("%s #%d", st.Name, n)
+		}
+		durations[name] = st.Duration
+		names = append(names, name)
+	}
+	return durations, names
+}
+
+var numberedStageRe = regexp.MustCompile(`^(.+) #\d+$`)
+
+// Load the boot times of the tests, or the durations of the stage if given,
+// by test ID
+func bootTimes(tx *gorm.DB, ids []uint, stage string) (map[uint]int64, error) {
+	values := map[uint]int64{}
+	if len(ids) == 0 {
+		return values, nil
+	}
+
+	if stage == "" {
+		var tests []Test
+		if err := tx.Select("id, boot_time").Where("id IN (?) AND boot_time > 0", ids).Find(&tests).Error; err != nil {
+			return nil, err
+		}
+		for _, t := range tests {
+			values[t.ID] = t.BootTime
+		}
+		return values, nil
+	}
+
+	// All entries of a numbered stage are needed to count them
+	names := []string{stage}
+	if m := numberedStageRe.FindStringSubmatch(stage); m != nil {
+		names = append(names, m[1])
+	}
+	var stages []BootStage
+	if err := tx.Where("test_id IN (?) AND name IN (?)", ids, names).Order("test_id, seq").Find(&stages).Error; err != nil {
+		return nil, err
+	}
+	byTest := map[uint][]BootStage{}
+	for _, st := range stages {
+		byTest[st.TestID] = append(byTest[st.TestID], st)
+	}
+	for id, st := range byTest {
+		durations, _ := numberStages(st)
+		values[id] = durations[stage]
+	}
+	return values, nil
+}
+
+func formatMicroseconds(us int64) string {
+	return fmt.Sprintf("%.1f ms", float64(us)/1000)
+}
+
+// Compare the boot times of two tests. Total and stages that grew by more
+// than percent are returned.
+func compareBootTimes(tx *gorm.DB, prevID, curID uint, percent float64) ([]Regression, error) {
+	if percent <= 0 {
+		return nil, nil
+	}
+	var totals []Test
+	if err := tx.Select("id, boot_time").Where("id IN (?)", []uint{prevID, curID}).Find(&totals).Error; err != nil {
+		return nil, err
+	}
+	bootTime := map[uint]int64{}
+	for _, t := range totals {
+		bootTime[t.ID] = t.BootTime
+	}
+
+	slower := func(prev, cur int64) bool {
+		return prev > 0 && float64(cur) > float64(prev)*(1+percent/100)
+	}
+
+	var regs []Regression
+	if prev, cur := bootTime[prevID], bootTime[curID]; cur > 0 && slower(prev, cur) {
+		regs = append(regs, Regression{
+			Name:      "total boot time",
+			Kind:      RegressionSlower,
+			OldResult: formatMicroseconds(prev),
+			NewResult: formatMicroseconds(cur),
+		})
+	}
+
+	prevStages, _, err := stageDurations(tx, prevID)
+	if err != nil {
+		return nil, err
+	}
+	curStages, names, err := stageDurations(tx, curID)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		prev, ok := prevStages[name]
+		cur := curStages[name]
+		if !ok || prev < minComparedStageDuration || !slower(prev, cur) {
+			continue
+		}
+		regs = append(regs, Regression{
+			Name:      "boot stage " + name,
+			Kind:      RegressionSlower,
+			OldResult: formatMicroseconds(prev),
+			NewResult: formatMicroseconds(cur),
+		})
+	}
+	return regs, nil
+}
+
+// The boot time chart is only shown if any test of the board has a boot time
+func (s *Store) bootTimeChartURL(boardID uint) string {
+	var n int
+	s.db.Model(&Test{}).Where("board_id = ? AND boot_time > 0", boardID).Count(&n)
+	if n == 0 {
+		return ""
+	}
+	return fmt.Sprintf("/board/boottime/%d", boardID)
+}
+
+// BootTimePoint is the boot time of a test of a board
+type BootTimePoint struct {
+	TestID uint   `json:"test_id"`
+	Label  string `json:"label"`
+	// Total boot time, or the duration of the requested stage
+	Value int64 `json:"value_us"`
+}
+
+// GetBootTimeHistory returns the boot time of the newest tests of the board,
+// oldest first. If stage is given, its duration instead of the total boot
+// time.
+func (s *Store) GetBootTimeHistory(boardID uint, stage string, limit int) ([]BootTimePoint, error) {
+	history, err := testHistory(s.db, boardID)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]uint, len(history))
+	for i, h := range history {
+		ids[i] = h.ID
+	}
+	values, err := bootTimes(s.db, ids, stage)
+	if err != nil {
+		return nil, err
+	}
+
+	var points []BootTimePoint
+	for _, h := range history {
+		if limit > 0 && len(points) >= limit {
+			break
+		}
+		value := values[h.ID]
+		if value <= 0 {
+			continue
+		}
+
+		label := h.Describe
+		if label == "" {
+			label = h.NameOfTestedCommit
+		}
+		if label == "" {
+			label = h.Name
+		}
+		points = append(points, BootTimePoint{TestID: h.ID, Label: label, Value: value})
+	}
+
+	// Oldest first
+	for i, j := 0, len(points)-1; i < j; i, j = i+1, j-1 {
+		points[i], points[j] = points[j], points[i]
+	}
+	return points, nil
+}
+
+// ParseStoredTimestamps parses the cbmem timestamps of all tests again, e.g.
+// for tests stored before they were parsed, and rebuilds the regressions.
+func (s *Store) ParseStoredTimestamps() (int, error) {
+	var ids []uint
+
+	if err := s.db.Model(&Test{}).Where("file_timestamps IS NOT NULL").Pluck("id", &ids).Error; err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, id := range ids {
+		var t Test
+		if err := s.db.Select("id, file_timestamps").Where("id = ?", id).First(&t).Error; err != nil {
+			return n, err
+		}
+		t.prepareBootStages()
+
+		err := s.transaction(func(tx *gorm.DB) error {
+			if err := tx.Unscoped().Where("test_id = ?", id).Delete(&BootStage{}).Error; err != nil {
+				return err
+			}
+			for i := range t.BootStages {
+				t.BootStages[i].TestID = id
+				if err := tx.Create(&t.BootStages[i]).Error; err != nil {
+					return err
+				}
+			}
+			return tx.Model(&Test{}).Where("id = ?", id).UpdateColumn("boot_time", t.BootTime).Error
+		})
+		if err != nil {
+			return n, err
+		}
+		if len(t.BootStages) > 0 {
+			n++
+		}
+	}
+	return n, s.RebuildRegressions()
+}
@@ -0,0 +1,77 @@
+// models.bootstage_test.go
+
+package model
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// cbmem -t output with durations and the total boot time scaled by k
+func cbmemTimestamps(k int64) string {
+	return fmt.Sprintf(`4 entries total:
+
+   0:1st timestamp                                     0
+  11:start of bootblock                                %d
+  90:finished loading                                  %d
+  90:finished loading                                  %d
+
+Total Time: %d
+`, 1000*k, 3000*k, 6000*k, 10000*k)
+}
+
+func TestGetBootTimeHistory(t *testing.T) {
+	s := newTestStore(t)
+	b := createBoard(t, s, "qemu-x86")
+	start := time.Date(2020, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	// Tests of the days 1 to 4, the second one without timestamps
+	var ids []uint
+	for day, k := range []int64{1, 0, 2, 3} {
+		test := Test{Name: "boot", BoardID: b.ID, Status: "PASS", Time: start.AddDate(0, 0, day)}
+		if k > 0 {
+			test.FileTimestamps = []byte(cbmemTimestamps(k))
+		}
+		if err := s.CreateTest(&test); err != nil {
+			t.Fatalf("CreateTest: %v", err)
+		}
+		if k > 0 {
+			ids = append(ids, test.ID)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		stage  string
+		limit  int
+		values []int64
+	}{
+		{name: "total", values: []int64{10000, 20000, 30000}},
+		{name: "limit", limit: 2, values: []int64{20000, 30000}},
+		{name: "limit of all", limit: 3, values: []int64{10000, 20000, 30000}},
+		{name: "stage", stage: "start of bootblock", values: []int64{1000, 2000, 3000}},
+		{name: "stage reached twice", stage: "finished loading", limit: 1, values: []int64{6000}},
+		{name: "stage reached the second time", stage: "finished loading #2", values: []int64{3000, 6000, 9000}},
+		{name: "unknown stage", stage: "finished loading #3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			points, err := s.GetBootTimeHistory(b.ID, tt.stage, tt.limit)
+			if err != nil {
+				t.Fatalf("GetBootTimeHistory: %v", err)
+			}
+			var values []int64
+			for i, p := range points {
+				values = append(values, p.Value)
+				if want := ids[len(ids)-len(points)+i]; p.TestID != want || p.Label != "boot" {
+					t.Errorf("Point %d of test %d labeled %q, want test %d", i, p.TestID, p.Label, want)
+				}
+			}
+			if !reflect.DeepEqual(values, tt.values) {
+				t.Errorf("GetBootTimeHistory() = %v, want %v", values, tt.values)
+			}
+		})
+	}
+}
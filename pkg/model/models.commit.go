@@ -0,0 +1,175 @@
+// models.commit.go
+
+package model
+
+import (
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Commit is a commit of the firmware repository as resolved from the
+// configured git clone
+type Commit struct {
+	gorm.Model
+	Hash       string    `json:"hash" yaml:"hash" gorm:"size:40;unique_index"`
+	Subject    string    `json:"subject" yaml:"subject" gorm:"size:65536"`
+	Author     string    `json:"author" yaml:"author" gorm:"size:255"`
+	AuthorDate time.Time `json:"author_date" yaml:"author_date"`
+	CommitDate time.Time `json:"commit_date" yaml:"commit_date"`
+	Describe   string    `json:"describe" yaml:"describe" gorm:"size:255"` // e.g. 4.12-123-gabcdef0
+	OnMaster   bool      `json:"on_master" yaml:"on_master"`
+	Position   int       `json:"position" yaml:"position"` // number of ancestors, orders commits on master, 0 if not on master
+}
+
+// CommitResolver looks up commits in the firmware repository
+type CommitResolver interface {
+	ResolveCommit(rev string) (*Commit, error)
+}
+
+// SetCommitResolver makes the store resolve the commits of new tests
+func (s *Store) SetCommitResolver(r CommitResolver) {
+	s.commits = r
+}
+
+// SourceReader reads files of the firmware source tree at a commit
+type SourceReader interface {
+	ReadFile(rev, path string) ([]byte, error)
+}
+
+// SetSourceReader makes the store read files like cmos.layout from the
+// source tree a test was built from
+func (s *Store) SetSourceReader(r SourceReader) {
+	s.source = r
+}
+
+// GetCommitByHash returns the stored commit, hash can be abbreviated
+func (s *Store) GetCommitByHash(hash string) (*Commit, error) {
+	var c Commit
+
+	hash = strings.ToLower(strings.TrimSpace(hash))
+	if len(hash) < 7 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	if err := s.db.Where("hash LIKE ?", hash+"%").First(&c).Error; err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// Insert the commit or update the stored one with the same hash
+func saveCommit(tx *gorm.DB, c *Commit) error {
+	var old Commit
+
+	err := tx.Unscoped().Where("hash = ?", c.Hash).First(&old).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return tx.Create(c).Error
+	}
+	if err != nil {
+		return err
+	}
+	c.Model = old.Model
+	c.DeletedAt = nil
+	return tx.Unscoped().Save(c).Error
+}
+
+// Resolve rev with the configured repository and store the result. Returns
+// nil without a repository or if the commit isn't known to it, e.g. local
+// changes that were never pushed.
+func (s *Store) resolveCommit(rev string) *Commit {
+	if s.commits == nil || rev == "" {
+		return nil
+	}
+	c, err := s.commits.ResolveCommit(rev)
+	if err != nil {
+		return nil
+	}
+	if err := saveCommit(s.db, c); err != nil {
+		return nil
+	}
+	return c
+}
+
+// Fill in the commit fields of the test from the repository. The commit
+// date replaces the given time, so tests are ordered by history.
+func (s *Store) resolveTestedCommit(t *Test) {
+	c := s.resolveCommit(t.TestedCommit)
+	if c == nil {
+		return
+	}
+	t.TestedCommit = c.Hash
+	if t.NameOfTestedCommit == "" {
+		t.NameOfTestedCommit = c.Describe
+	}
+	t.TestedCommitTime = c.CommitDate
+}
+
+// SyncCommits resolves all commits referenced by tests and boards again,
+// e.g. after the branch moved on, and recomputes the board status and
+// regressions. Returns the number of commits resolved.
+func (s *Store) SyncCommits() (int, error) {
+	var revs []string
+
+	err := s.db.Raw(`SELECT rev FROM (
+		SELECT tested_commit AS rev FROM tests WHERE deleted_at IS NULL
+		UNION SELECT first_commit FROM boards WHERE deleted_at IS NULL
+		UNION SELECT last_commit FROM boards WHERE deleted_at IS NULL)
+		WHERE rev IS NOT NULL AND rev <> ''`).Pluck("rev", &revs).Error
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, rev := range revs {
+		c := s.resolveCommit(rev)
+		if c == nil {
+			continue
+		}
+		n++
+		err := s.db.Model(&Test{}).Where("tested_commit = ?", rev).UpdateColumns(map[string]interface{}{
+			"tested_commit":      c.Hash,
+			"tested_commit_time": c.CommitDate,
+		}).Error
+		if err != nil {
+			return n, err
+		}
+	}
+
+	boards, err := s.GetAllBoards()
+	if err != nil {
+		return n, err
+	}
+	for _, b := range boards {
+		if err := s.RecomputeBoardStatus(b.ID); err != nil {
+			return n, err
+		}
+	}
+	// The order of the tests can have changed
+	return n, s.RebuildRegressions()
+}
+
+// CommitRef is a commit named by one of the commit fields, with the
+// metadata from the repository if it's known
+type CommitRef struct {
+	Label  string
+	Rev    string
+	Commit *Commit
+}
+
+// Look up the given label, revision pairs, empty revisions are left out
+func (s *Store) commitRefs(pairs ...string) []CommitRef {
+	var refs []CommitRef
+
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if pairs[i+1] == "" {
+			continue
+		}
+		ref := CommitRef{Label: pairs[i], Rev: pairs[i+1]}
+		if c, err := s.GetCommitByHash(ref.Rev); err == nil {
+			ref.Commit = c
+		}
+		refs = append(refs, ref)
+	}
+	return refs
+}
@@ -0,0 +1,227 @@
+// models.configoption.go
+
+package model
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+	"github.com/siro20/boardstatus/pkg/parser"
+)
+
+// ConfigOption is a Kconfig option of the coreboot .config of a test
+type ConfigOption struct {
+	gorm.Model
+	TestID uint   `json:"test_id" yaml:"test_id"`
+	Name   string `json:"name" yaml:"name" gorm:"size:255"`
+	Value  string `json:"value" yaml:"value" gorm:"size:65536"` // "n" if not set
+}
+
+// Parse the .config of the test into ConfigOptions. Files that can't be
+// parsed are kept as they are.
+func (t *Test) prepareConfigOptions() {
+	t.ConfigOptions = nil
+	if len(t.FileConfig) == 0 {
+		return
+	}
+
+	opts, err := parser.ParseConfig(bytes.NewReader(t.FileConfig))
+	if err != nil {
+		return
+	}
+	for _, o := range opts {
+		t.ConfigOptions = append(t.ConfigOptions, ConfigOption{Name: o.Name, Value: o.Value})
+	}
+}
+
+// Load the config options of the test by name
+func configOptionsOf(tx *gorm.DB, testID uint) (map[string]string, error) {
+	var opts []ConfigOption
+
+	if err := tx.Select("name, value").Where("test_id = ?", testID).Find(&opts).Error; err != nil {
+		return nil, err
+	}
+	values := map[string]string{}
+	for _, o := range opts {
+		values[o.Name] = o.Value
+	}
+	return values, nil
+}
+
+// ConfigChange is an option that differs between the configs of two tests.
+// Empty values mean the option isn't in the config at all.
+type ConfigChange struct {
+	Name     string `json:"name"`
+	OldValue string `json:"old_value"`
+	NewValue string `json:"new_value"`
+}
+
+// Compare two configs, sorted by option name
+func compareConfigs(prev, cur map[string]string) []ConfigChange {
+	var changes []ConfigChange
+
+	for name, value := range cur {
+		if old, ok := prev[name]; !ok || old != value {
+			changes = append(changes, ConfigChange{Name: name, OldValue: old, NewValue: value})
+		}
+	}
+	for name, old := range prev {
+		if _, ok := cur[name]; !ok {
+			changes = append(changes, ConfigChange{Name: name, OldValue: old})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Name < changes[j].Name })
+	return changes
+}
+
+// ConfigDiff returns the options that differ between the configs of two
+// tests. Returns nil if either test has no parsed config.
+func (s *Store) ConfigDiff(oldID, newID uint) ([]ConfigChange, error) {
+	prev, err := configOptionsOf(s.db, oldID)
+	if err != nil {
+		return nil, err
+	}
+	cur, err := configOptionsOf(s.db, newID)
+	if err != nil {
+		return nil, err
+	}
+	if len(prev) == 0 || len(cur) == 0 {
+		return nil, nil
+	}
+	return compareConfigs(prev, cur), nil
+}
+
+// ConfigSearchResult is a board along with the test it was last tested with
+// and the value of the searched option in it
+type ConfigSearchResult struct {
+	BoardID  uint   `json:"board_id"`
+	Board    string `json:"board"`
+	TestID   uint   `json:"test_id"`
+	TestName string `json:"test_name"`
+	Status   string `json:"status"`
+	Value    string `json:"value"`
+}
+
+// Options are given with or without prefix
+func configOptionName(name string) string {
+	name = strings.TrimSpace(name)
+	if !strings.HasPrefix(name, "CONFIG_") {
+		name = "CONFIG_" + name
+	}
+	return name
+}
+
+// FindBoardsByConfig returns the boards whose newest test with a config has
+// the option set to value. Without value all boards are returned along with
+// their value of the option. Options missing in a config count as "n".
+func (s *Store) FindBoardsByConfig(name, value string) ([]ConfigSearchResult, error) {
+	name = configOptionName(name)
+
+	boards, err := s.GetAllBoards()
+	if err != nil {
+		return nil, err
+	}
+
+	var results []ConfigSearchResult
+	for _, b := range boards {
+		history, err := s.statusHistory(s.db, b.ID)
+		if err != nil {
+			return nil, err
+		}
+		if len(history) == 0 {
+			continue
+		}
+
+		ids := make([]uint, len(history))
+		for i, h := range history {
+			ids[i] = h.ID
+		}
+		var withConfig []uint
+		err = s.db.Model(&ConfigOption{}).Where("test_id IN (?)", ids).Pluck("DISTINCT test_id", &withConfig).Error
+		if err != nil {
+			return nil, err
+		}
+		hasConfig := map[uint]bool{}
+		for _, id := range withConfig {
+			hasConfig[id] = true
+		}
+
+		for _, h := range history {
+			if !hasConfig[h.ID] {
+				continue
+			}
+			var opt ConfigOption
+			err := s.db.Where("test_id = ? AND name = ?", h.ID, name).First(&opt).Error
+			if err != nil && !gorm.IsRecordNotFoundError(err) {
+				return nil, err
+			}
+			v := opt.Value
+			if v == "" {
+				v = "n"
+			}
+			if value == "" || v == value {
+				results = append(results, ConfigSearchResult{
+					BoardID:  b.ID,
+					Board:    b.Name,
+					TestID:   h.ID,
+					TestName: h.Name,
+					Status:   h.Status,
+					Value:    v,
+				})
+			}
+			break
+		}
+	}
+	return results, nil
+}
+
+// ParseStoredConfigs parses the .config of all tests again, e.g. for tests
+// stored before they were parsed
+func (s *Store) ParseStoredConfigs() (int, error) {
+	var ids []uint
+
+	if err := s.db.Model(&Test{}).Where("file_config IS NOT NULL").Pluck("id", &ids).Error; err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, id := range ids {
+		var t Test
+		if err := s.db.Select("id, file_config").Where("id = ?", id).First(&t).Error; err != nil {
+			return n, err
+		}
+		t.prepareConfigOptions()
+
+		err := s.transaction(func(tx *gorm.DB) error {
+			if err := tx.Unscoped().Where("test_id = ?", id).Delete(&ConfigOption{}).Error; err != nil {
+				return err
+			}
+			for i := range t.ConfigOptions {
+				t.ConfigOptions[i].TestID = id
+				if err := tx.Create(&t.ConfigOptions[i]).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return n, err
+		}
+		if len(t.ConfigOptions) > 0 {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// Options changed since the previous test of the board
+func (s *Store) configChanges(t *Test) ([]ConfigChange, error) {
+	prev, err := s.PreviousTestID(t)
+	if err != nil || prev == 0 {
+		return nil, err
+	}
+	return s.ConfigDiff(prev, t.ID)
+}
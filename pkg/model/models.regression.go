@@ -0,0 +1,218 @@
+// models.regression.go
+
+package model
+
+import (
+	"sort"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Kinds of changes between a test and the previous one of the board
+const (
+	RegressionNewFailure  = "new_failure" // failed, passed or was skipped before
+	RegressionFixed       = "fixed"       // passes, failed before
+	RegressionDisappeared = "disappeared" // only in the previous test
+	RegressionAdded       = "added"       // only in this test
+	RegressionSlower      = "slower"      // boot time or a boot stage took longer
+)
+
+// Regression is a test case that changed compared to the previous test of
+// the same board, matched by the case name, or a boot time that grew
+type Regression struct {
+	gorm.Model
+	TestID         uint   `json:"test_id" yaml:"test_id"`
+	PreviousTestID uint   `json:"previous_test_id" yaml:"previous_test_id"`
+	BoardID        uint   `json:"board_id" yaml:"board_id"`
+	Name           string `json:"name" yaml:"name" gorm:"size:65536"`
+	Kind           string `json:"kind" yaml:"kind" gorm:"size:255"`
+	OldResult      string `json:"old_result,omitempty" yaml:"old_result,omitempty" gorm:"size:255"`
+	NewResult      string `json:"new_result,omitempty" yaml:"new_result,omitempty" gorm:"size:255"`
+}
+
+func isFailing(result string) bool {
+	return result == ResultFail || result == ResultError
+}
+
+// Return the results of the test's cases by name. If a name is used more
+// than once a failure wins.
+func caseResults(tx *gorm.DB, testID uint) (map[string]string, error) {
+	var cases []TestCase
+
+	if err := tx.Select("name, result").Where("test_id = ?", testID).Find(&cases).Error; err != nil {
+		return nil, err
+	}
+	results := map[string]string{}
+	for _, tc := range cases {
+		if old, ok := results[tc.Name]; ok && isFailing(old) {
+			continue
+		}
+		results[tc.Name] = tc.Result
+	}
+	return results, nil
+}
+
+// Compare the case results of two tests, sorted by name
+func compareCases(prev, cur map[string]string) []Regression {
+	var regs []Regression
+
+	for name, res := range cur {
+		old, ok := prev[name]
+		switch {
+		case !ok:
+			regs = append(regs, Regression{Name: name, Kind: RegressionAdded, NewResult: res})
+		case isFailing(res) && !isFailing(old):
+			regs = append(regs, Regression{Name: name, Kind: RegressionNewFailure, OldResult: old, NewResult: res})
+		case res == ResultPass && isFailing(old):
+			regs = append(regs, Regression{Name: name, Kind: RegressionFixed, OldResult: old, NewResult: res})
+		}
+	}
+	for name, old := range prev {
+		if _, ok := cur[name]; !ok {
+			regs = append(regs, Regression{Name: name, Kind: RegressionDisappeared, OldResult: old})
+		}
+	}
+
+	sort.Slice(regs, func(i, j int) bool { return regs[i].Name < regs[j].Name })
+	return regs
+}
+
+// Store the regressions of history[i] against the test before it
+func (s *Store) regressionsOf(tx *gorm.DB, boardID uint, history []TestHistory, i int) error {
+	cur := history[i]
+
+	if err := tx.Unscoped().Where("test_id = ?", cur.ID).Delete(&Regression{}).Error; err != nil {
+		return err
+	}
+	// The oldest test has nothing to compare with
+	if i+1 >= len(history) {
+		return nil
+	}
+	prev := history[i+1]
+
+	prevResults, err := caseResults(tx, prev.ID)
+	if err != nil {
+		return err
+	}
+	curResults, err := caseResults(tx, cur.ID)
+	if err != nil {
+		return err
+	}
+
+	slower, err := compareBootTimes(tx, prev.ID, cur.ID, s.bootTimeThreshold)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range append(compareCases(prevResults, curResults), slower...) {
+		r.TestID = cur.ID
+		r.PreviousTestID = prev.ID
+		r.BoardID = boardID
+		if err := tx.Create(&r).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Compute the regressions of the test. The next newer test is compared
+// again too, as the test can have been inserted before it in history.
+func (s *Store) updateRegressions(tx *gorm.DB, boardID, testID uint) error {
+	history, err := testHistory(tx, boardID)
+	if err != nil {
+		return err
+	}
+
+	for i, t := range history {
+		if t.ID != testID {
+			continue
+		}
+		if err := s.regressionsOf(tx, boardID, history, i); err != nil {
+			return err
+		}
+		if i > 0 {
+			return s.regressionsOf(tx, boardID, history, i-1)
+		}
+		return nil
+	}
+	return nil
+}
+
+// Compute the regressions of all tests of the board again
+func (s *Store) rebuildRegressions(tx *gorm.DB, boardID uint) error {
+	history, err := testHistory(tx, boardID)
+	if err != nil {
+		return err
+	}
+
+	for i := range history {
+		if err := s.regressionsOf(tx, boardID, history, i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RebuildRegressions computes the regressions of all tests of all boards
+func (s *Store) RebuildRegressions() error {
+	boards, err := s.GetAllBoards()
+	if err != nil {
+		return err
+	}
+	for _, b := range boards {
+		err := s.transaction(func(tx *gorm.DB) error {
+			return s.rebuildRegressions(tx, b.ID)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RegressionResult is a regression together with the test it belongs to
+type RegressionResult struct {
+	Regression
+	TestName     string `json:"test_name"`
+	TestedCommit string `json:"tested_commit"`
+}
+
+// RegressionQuery selects regressions. Empty fields match everything.
+type RegressionQuery struct {
+	BoardID uint
+	TestID  uint
+	Kind    string
+	Limit   int
+	Offset  int
+}
+
+// FindRegressions returns matching regressions, newest test first
+func (s *Store) FindRegressions(q RegressionQuery) ([]RegressionResult, error) {
+	db := s.db.Table("regressions").
+		Select("regressions.*, tests.name AS test_name, tests.tested_commit").
+		Joins("JOIN tests ON tests.id = regressions.test_id").
+		Where("regressions.deleted_at IS NULL AND tests.deleted_at IS NULL")
+
+	if q.BoardID != 0 {
+		db = db.Where("regressions.board_id = ?", q.BoardID)
+	}
+	if q.TestID != 0 {
+		db = db.Where("regressions.test_id = ?", q.TestID)
+	}
+	if q.Kind != "" {
+		db = db.Where("regressions.kind = ?", q.Kind)
+	}
+	if q.Limit <= 0 || q.Limit > 1000 {
+		q.Limit = 100
+	}
+
+	var regs []RegressionResult
+	err := db.Order("tests.time DESC, regressions.test_id DESC, regressions.name").
+		Limit(q.Limit).
+		Offset(q.Offset).
+		Scan(&regs).Error
+	if err != nil {
+		return nil, err
+	}
+	return regs, nil
+}
@@ -0,0 +1,125 @@
+// models.regression_test.go
+
+package model
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCompareCases(t *testing.T) {
+	tests := []struct {
+		name string
+		prev map[string]string
+		cur  map[string]string
+		want []Regression
+	}{
+		{
+			name: "unchanged",
+			prev: map[string]string{"boot": ResultPass, "usb": ResultFail},
+			cur:  map[string]string{"boot": ResultPass, "usb": ResultFail},
+		},
+		{
+			name: "new failures",
+			prev: map[string]string{"boot": ResultPass, "usb": ResultSkip, "sata": ResultFail},
+			cur:  map[string]string{"boot": ResultFail, "usb": ResultError, "sata": ResultError},
+			want: []Regression{
+				{Name: "boot", Kind: RegressionNewFailure, OldResult: ResultPass, NewResult: ResultFail},
+				{Name: "usb", Kind: RegressionNewFailure, OldResult: ResultSkip, NewResult: ResultError},
+			},
+		},
+		{
+			name: "fixed",
+			prev: map[string]string{"boot": ResultError, "usb": ResultFail},
+			cur:  map[string]string{"boot": ResultPass, "usb": ResultSkip},
+			want: []Regression{
+				{Name: "boot", Kind: RegressionFixed, OldResult: ResultError, NewResult: ResultPass},
+			},
+		},
+		{
+			name: "added and disappeared",
+			prev: map[string]string{"boot": ResultPass, "usb": ResultFail},
+			cur:  map[string]string{"boot": ResultPass, "audio": ResultSkip},
+			want: []Regression{
+				{Name: "audio", Kind: RegressionAdded, NewResult: ResultSkip},
+				{Name: "usb", Kind: RegressionDisappeared, OldResult: ResultFail},
+			},
+		},
+		{
+			name: "first cases",
+			cur:  map[string]string{"boot": ResultPass},
+			want: []Regression{{Name: "boot", Kind: RegressionAdded, NewResult: ResultPass}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := compareCases(tt.prev, tt.cur)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("compareCases() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateRegressions(t *testing.T) {
+	s := newTestStore(t)
+	b := createBoard(t, s, "qemu-x86")
+	start := time.Date(2020, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	upload := func(commit string, day int, cases ...TestCase) *Test {
+		t.Helper()
+		test := Test{Name: "boot", BoardID: b.ID, TestedCommit: commit, Time: start.AddDate(0, 0, day), Cases: cases}
+		if err := s.CreateTest(&test); err != nil {
+			t.Fatalf("CreateTest: %v", err)
+		}
+		return &test
+	}
+	regressions := func(test *Test) []string {
+		t.Helper()
+		regs, err := s.FindRegressions(RegressionQuery{TestID: test.ID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, r := range regs {
+			if r.BoardID != b.ID || r.TestedCommit != test.TestedCommit {
+				t.Errorf("Regression %+v of the wrong board or test", r)
+			}
+			got = append(got, r.Name+" "+r.Kind)
+		}
+		return got
+	}
+
+	first := upload("a", 1, TestCase{Name: "boot", Result: "pass"}, TestCase{Name: "usb", Result: "fail"})
+	if got := regressions(first); got != nil {
+		t.Errorf("Regressions of the first test = %q", got)
+	}
+
+	third := upload("c", 3, TestCase{Name: "boot", Result: "fail"}, TestCase{Name: "usb", Result: "pass"},
+		TestCase{Name: "sata", Result: "pass"})
+	want := []string{"boot new_failure", "sata added", "usb fixed"}
+	if got := regressions(third); !reflect.DeepEqual(got, want) {
+		t.Errorf("Regressions = %q, want %q", got, want)
+	}
+
+	// A commit in between uploaded later is compared to both neighbours
+	second := upload("b", 2, TestCase{Name: "boot", Result: "fail"}, TestCase{Name: "usb", Result: "fail"},
+		TestCase{Name: "usb", Result: "pass"})
+	want = []string{"boot new_failure"}
+	if got := regressions(second); !reflect.DeepEqual(got, want) {
+		t.Errorf("Regressions of the test inserted = %q, want %q", got, want)
+	}
+	want = []string{"sata added", "usb fixed"}
+	if got := regressions(third); !reflect.DeepEqual(got, want) {
+		t.Errorf("Regressions of the next test = %q, want %q", got, want)
+	}
+
+	regs, err := s.FindRegressions(RegressionQuery{BoardID: b.ID, Kind: RegressionNewFailure})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(regs) != 1 || regs[0].TestID != second.ID || regs[0].PreviousTestID != first.ID {
+		t.Errorf("FindRegressions of new failures = %+v", regs)
+	}
+}
@@ -11,133 +11,214 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/jinzhu/gorm"
-	_ "github.com/jinzhu/gorm/dialects/sqlite"
 	helper "github.com/siro20/boardstatus/pkg/helper"
-	"gopkg.in/yaml.v2"
 )
 
+// ExternalRefField names ReferenceExternalValidation in uploads and forms,
+// as its json tag does
+const ExternalRefField = "exeternal_ref"
+
 type Test struct {
 	gorm.Model
-	Name string    `json:"name" yaml:"name" gorm:"size:255" table_list:"Name"`
-	Time time.Time `json:"time" yaml:"time" table_list:"Tested"`
-
-	Checksum string `json:"checksum" yaml:"checksum" gorm:"size:255"`
-
-	ReferenceExternalValidation string `json:"exeternal_ref" yaml:"exeternal_ref"` // e.g http://lava.test.invalid/test5
-
-	// Test results in key value format
-	FailedTest        []TestCase `json:"failed_tests" yaml:"failed_tests"`
-	PassedTest        []TestCase `json:"passed_tests" yaml:"passed_tests"`
-	SkippedTest       []TestCase `json:"skipped_tests" yaml:"skipped_tests"`
-	FailedTestsCount  int        `json:"failed_tests_count" yaml:"failed_tests_count" table_list:"Failed tests #"`
-	PassedTestsCount  int        `json:"passed_tests_count" yaml:"passed_tests_count" table_list:"Passed tests #"`
-	SkippedTestsCount int        `json:"skipped_tests_count" yaml:"skipped_tests_count" table_list:"Skipped tests #"`
+	Name string    `json:"name" yaml:"name" gorm:"size:255" table_default:"" table_descr:"Name of the test run" table_list:"Name" validate:"required"`
+	Time time.Time `json:"time" yaml:"time" table_default:"" table_descr:"When the test ran" table_list:"Tested"`
+
+	Checksum string `json:"checksum" yaml:"checksum" gorm:"size:255" table_default:"" table_descr:"Checksum of the tested image"`
+
+	// The tested firmware revision
+	TestedCommit       string    `json:"tested_commit" yaml:"tested_commit" gorm:"size:255" table_title:"Software" table_default:"" table_descr:"The tested commit"`
+	NameOfTestedCommit string    `json:"name_of_commit" yaml:"name_of_commit" gorm:"size:255" table_default:"" table_descr:"e.g. coreboot-4.12-123-dirty" table_edit:"-"`
+	TestedCommitTime   time.Time `json:"tested_commit_time" yaml:"tested_commit_time" table_default:"" table_descr:"When the tested commit was made, orders the tests of a board" table_edit:"-"`
+
+	ReferenceExternalValidation string `json:"exeternal_ref" yaml:"exeternal_ref" table_default:"" table_descr:"Reference to an external validation system"` // e.g http://lava.test.invalid/test5
+
+	// Test results, stored in their own table
+	Cases []TestCase `json:"test_cases" yaml:"test_cases" gorm:"foreignkey:TestID" table_title:"Results" table_default:"" table_descr:"Results of the single test cases"`
+	// Deprecated input format, merged into Cases with the result set
+	FailedTest  []TestCase `json:"failed_tests,omitempty" yaml:"failed_tests,omitempty" gorm:"-" table:"-"`
+	PassedTest  []TestCase `json:"passed_tests,omitempty" yaml:"passed_tests,omitempty" gorm:"-" table:"-"`
+	SkippedTest []TestCase `json:"skipped_tests,omitempty" yaml:"skipped_tests,omitempty" gorm:"-" table:"-"`
+	// Computed from Cases on write
+	FailedTestsCount  int `json:"failed_tests_count" yaml:"failed_tests_count" table_default:"0" table_descr:"Number of failed test cases" table_list:"Failed tests #" table_edit:"-"`
+	PassedTestsCount  int `json:"passed_tests_count" yaml:"passed_tests_count" table_default:"0" table_descr:"Number of passed test cases" table_list:"Passed tests #" table_edit:"-"`
+	SkippedTestsCount int `json:"skipped_tests_count" yaml:"skipped_tests_count" table_default:"0" table_descr:"Number of skipped test cases" table_list:"Skipped tests #" table_edit:"-"`
+	ErrorTestsCount   int `json:"error_tests_count" yaml:"error_tests_count" table_default:"0" table_descr:"Number of test cases that couldn't run" table_edit:"-"`
 
 	// Collected data, raw ASCII, compressed
-	FileKernelLog     []byte `json:"file_kernel_log" yaml:"file_kernel_log"`
-	FileCMOS          []byte `json:"file_cmos" yaml:"file_cmos"`
-	FileConfig        []byte `json:"file_config" yaml:"file_config"`
-	FileBootlog       []byte `json:"file_bootlog" yaml:"file_bootlog"`
-	FileTimestamps    []byte `json:"file_timestamps" yaml:"file_timestamps"`
-	FilePayloadconfig []byte `json:"file_payload_config" yaml:"file_payload_config"`
+	FileKernelLog     Blob `json:"file_kernel_log" yaml:"file_kernel_log" table_title:"Collected data" table_default:"" table_descr:"Kernel log"`
+	FileCMOS          Blob `json:"file_cmos" yaml:"file_cmos" table_default:"" table_descr:"CMOS dump"`
+	FileCMOSLayout    Blob `json:"file_cmos_layout" yaml:"file_cmos_layout" table_default:"" table_descr:"cmos.layout to decode the CMOS dump, taken from the source tree if empty"`
+	FileSMBIOS        Blob `json:"file_smbios" yaml:"file_smbios" table_default:"" table_descr:"dmidecode output or raw SMBIOS tables, identify the board if board_id is not given"`
+	FileConfig        Blob `json:"file_config" yaml:"file_config" table_default:"" table_descr:"coreboot .config"`
+	FileBootlog       Blob `json:"file_bootlog" yaml:"file_bootlog" table_default:"" table_descr:"coreboot console log"`
+	FileTimestamps    Blob `json:"file_timestamps" yaml:"file_timestamps" table_default:"" table_descr:"cbmem timestamps"`
+	FilePayloadconfig Blob `json:"file_payload_config" yaml:"file_payload_config" table_default:"" table_descr:"Payload config"`
+
+	// Parsed from FileTimestamps on write
+	BootStages []BootStage `json:"boot_stages,omitempty" yaml:"boot_stages,omitempty" gorm:"foreignkey:TestID" table:"-"`
+	BootTime   int64       `json:"boot_time_us" yaml:"boot_time_us" table_default:"0" table_descr:"Total boot time in microseconds, from the cbmem timestamps" table_edit:"-"`
+
+	// Parsed from FileConfig on write, not loaded with the test
+	ConfigOptions []ConfigOption `json:"config_options,omitempty" yaml:"config_options,omitempty" gorm:"foreignkey:TestID" table:"-"`
 
 	// Status
-	Status        string `json:"status" yaml:"status" gorm:"size:255" table_list:"Status"`                         // one of PASS, FAIL, UNKN
-	StatusComment string `json:"status_comment" yaml:"status_comment" gorm:"size:255" table_list:"Status comment"` // e.g. doesn't boot into OS
-	Comment       string `json:"comment" yaml:"comment" gorm:"size:65536"`
-	BoardID       uint   `json:"board_id" yaml:"board_id"`
-}
-
-type TestCase struct {
-	gorm.Model
-	Name   string `json:"name" yaml:"name" gorm:"size:65536"`
-	Result string `json:"result" yaml:"result" gorm:"size:65536"`
-	TestID uint   `json:"test_id" yaml:"test_id"`
+	Status        string `json:"status" yaml:"status" gorm:"size:255" table_title:"Status" table_default:"UNKN" table_descr:"One of PASS, FAIL, UNKN" table_list:"Status" validate:"oneof=PASS FAIL UNKN"` // one of PASS, FAIL, UNKN
+	StatusComment string `json:"status_comment" yaml:"status_comment" gorm:"size:255" table_default:"" table_descr:"Reason for the status" table_list:"Status comment"`                                    // e.g. doesn't boot into OS
+	Comment       string `json:"comment" yaml:"comment" gorm:"size:65536" table_default:"" table_descr:""`
+	BoardID       uint   `json:"board_id" yaml:"board_id" table_default:"" table_descr:"ID of the tested board" validate:"required"`
 }
 
 // Return a list of all the boards
-func getAllTests() ([]Test, error) {
-
-	db, err := gorm.Open("sqlite3", "test.db")
-	if err != nil {
-		return nil, err
-	}
-	defer db.Close()
-
-	// Migrate the schema
-	db.AutoMigrate(&Test{})
+func (s *Store) getAllTests() ([]Test, error) {
+	db := s.db
 
 	// Read
 	var testList []Test
-	db.Find(&testList)
+	if err := db.Find(&testList).Error; err != nil {
+		return nil, err
+	}
 
 	return testList, nil
 }
 
 // Fetch an test based on the ID supplied
-func getTestByID(id int) (*Test, error) {
+func (s *Store) GetTestByID(id int) (*Test, error) {
 	var t Test
 
-	db, err := gorm.Open("sqlite3", "test.db")
+	err := s.db.Preload("Cases", func(db *gorm.DB) *gorm.DB {
+		return db.Order("test_cases.id")
+	}).Preload("BootStages", func(db *gorm.DB) *gorm.DB {
+		return db.Order("boot_stages.seq")
+	}).First(&t, id).Error
 	if err != nil {
 		return nil, err
 	}
-	defer db.Close()
-
-	db.First(&t, id)
 	return &t, nil
 }
 
-// Create a new board with the title and content provided
-func createNewTest(data string) (*Test, error) {
-
+// GetTestByExternalRef returns the test linked to the given external
+// validation, e.g. a LAVA job
+func (s *Store) GetTestByExternalRef(boardID uint, ref string) (*Test, error) {
 	var t Test
 
-	err := yaml.Unmarshal([]byte(data), &t)
+	err := s.db.Where("board_id = ? AND reference_external_validation = ?", boardID, ref).First(&t).Error
 	if err != nil {
-		fmt.Printf("Failed to unmarshal %v\n", err)
 		return nil, err
 	}
+	return &t, nil
+}
 
-	db, err := gorm.Open("sqlite3", "test.db")
-	if err != nil {
-		return nil, err
+// Check that the test can be stored, fills in defaults
+func (s *Store) validateTest(t *Test) error {
+	if t.BoardID == 0 && len(t.FileSMBIOS) > 0 {
+		if err := s.matchTestBoard(t); err != nil {
+			return err
+		}
 	}
-	defer db.Close()
+	if err := s.validate(s.db, t); err != nil {
+		return err
+	}
+	if _, err := s.GetBoardByID(int(t.BoardID)); err != nil {
+		return &ValidationError{"board_id", fmt.Sprintf("refers to unknown board %d", t.BoardID)}
+	}
+	if t.Time.IsZero() {
+		t.Time = time.Now()
+	}
+	if err := t.prepareCases(); err != nil {
+		return err
+	}
+	t.prepareBootStages()
+	t.prepareConfigOptions()
+	// Without explicit status the test cases decide
+	if t.Status == "" {
+		t.deriveStatus()
+	}
+	return nil
+}
 
-	if !db.HasTable(&Test{}) {
-		db.CreateTable(&Test{})
+// Store a new test, attached to the board given by its BoardID
+func (s *Store) CreateTest(t *Test) error {
+	// The ID and timestamps are assigned by the database
+	t.Model = gorm.Model{}
+
+	s.resolveTestedCommit(t)
+	if err := s.validateTest(t); err != nil {
+		return err
+	}
+	// The board can be matched only now
+	if err := s.authorizeActor(PermUpload, t.BoardID); err != nil {
+		return err
 	}
-	db.Create(&t)
 
-	return &t, nil
+	return s.transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(t).Error; err != nil {
+			return err
+		}
+		if err := s.audit(tx, t, t.ID, ActionCreate, diffFields(nil, t)); err != nil {
+			return err
+		}
+		if err := s.updateRegressions(tx, t.BoardID, t.ID); err != nil {
+			return err
+		}
+		return s.updateBoardStatus(tx, t.BoardID)
+	})
 }
 
-func (t Test) render(c *gin.Context, showOnly bool) {
+func (t Test) render(s *Store, c *gin.Context, showOnly bool, form *editForm) {
 	// Check if the item ID is valid
 	if ID, err := strconv.Atoi(c.Param("id")); err == nil {
 		var Item string
 
-		if !showOnly {
-			if strings.Contains(c.Request.RequestURI, "/") {
-				Item = strings.Split(c.Request.RequestURI, "/")[1]
-			} else {
-				Item = c.Request.RequestURI
-			}
+		if strings.Contains(c.Request.RequestURI, "/") {
+			Item = strings.Split(c.Request.RequestURI, "/")[1]
+		} else {
+			Item = c.Request.RequestURI
 		}
 
 		// Check if the board exists
-		if test, err := getTestByID(ID); err == nil {
+		if test, err := s.GetTestByID(ID); err == nil {
 			RenderItems, err := getRenderItem(test)
 			if err != nil {
 				c.AbortWithError(http.StatusInternalServerError, err)
-			} else {
-				helper.Render(c, gin.H{
-					"Name":        test.Name,
-					"PostURL":     Item,
-					"DisplayOnly": showOnly,
-					"payload":     RenderItems}, "listitem.html")
+				return
+			}
+			regressions, err := s.FindRegressions(RegressionQuery{TestID: test.ID, Limit: 1000})
+			if err != nil {
+				c.AbortWithError(http.StatusInternalServerError, err)
+				return
+			}
+			diffURL, err := s.kernelLogDiffURL(test)
+			if err != nil {
+				c.AbortWithError(http.StatusInternalServerError, err)
+				return
 			}
+			configChanges, err := s.configChanges(test)
+			if err != nil {
+				c.AbortWithError(http.StatusInternalServerError, err)
+				return
+			}
+			cmos, cmosChanges, cmosError := s.cmosOfTest(test)
+			data := gin.H{
+				"Name":        test.Name,
+				"PostURL":     Item,
+				"ID":          test.ID,
+				"Version":     formVersion(test.Model),
+				"DisplayOnly": showOnly,
+				"audit":       s.auditOf(TrashTests, test.ID),
+				"cases":       test.Cases,
+				"stages":      test.BootStages,
+				"commits":     s.commitRefs("Tested", test.TestedCommit),
+				"regressions": regressions,
+				"flaky":       s.flakyCaseNames(test.BoardID),
+				"kernel_diff": diffURL,
+				"config":      configChanges,
+				"cmos":        cmos,
+				"cmos_diff":   cmosChanges,
+				"cmos_error":  cmosError,
+				"payload":     RenderItems,
+			}
+			form.apply(data, RenderItems)
+			helper.RenderStatus(c, form.status(), data, "listitem.html")
 		} else {
 			// If the item is not found, abort with an error
 			c.AbortWithError(http.StatusNotFound, err)
@@ -145,15 +226,37 @@ func (t Test) render(c *gin.Context, showOnly bool) {
 	}
 }
 
-func (t Test) RenderShow(c *gin.Context) {
-	t.render(c, true)
+func (t Test) RenderShow(s *Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		t.render(s, c, true, nil)
+	}
 }
 
-func (t Test) RenderEdit(c *gin.Context) {
-	t.render(c, false)
+func (t Test) RenderEdit(s *Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		t.render(s, c, false, nil)
+	}
+}
+
+// Update stores the POSTed edit form
+func (t Test) Update(s *Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		handleEditForm(c, func(id uint, update Update) error {
+			_, err := s.ForRequest(c).UpdateTest(id, update)
+			return err
+		}, func(f *editForm) {
+			t.render(s, c, false, f)
+		})
+	}
+}
+
+func (t Test) RenderAll(s *Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		t.renderAll(s, c)
+	}
 }
 
-func (t Test) RenderAll(c *gin.Context) {
+func (t Test) renderAll(s *Store, c *gin.Context) {
 	var Item string
 
 	if strings.Contains(c.Request.RequestURI, "/") {
@@ -163,7 +266,7 @@ func (t Test) RenderAll(c *gin.Context) {
 	}
 
 	// Check if the board exists
-	if tests, err := getAllTests(); err == nil {
+	if tests, err := s.getAllTests(); err == nil {
 		Header, List, err := getRenderList(tests)
 		if err != nil {
 			c.AbortWithError(http.StatusInternalServerError, err)
@@ -0,0 +1,174 @@
+// models.testcase.go
+
+package model
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+	"github.com/siro20/boardstatus/pkg/parser"
+)
+
+// Results a test case can have
+const (
+	ResultPass  = "pass"
+	ResultFail  = "fail"
+	ResultSkip  = "skip"
+	ResultError = "error" // the case couldn't run, e.g. setup failed
+)
+
+// TestCase is the result of a single check within a Test
+type TestCase struct {
+	gorm.Model
+	Suite    string  `json:"suite,omitempty" yaml:"suite,omitempty" gorm:"size:255"`
+	Name     string  `json:"name" yaml:"name" gorm:"size:65536"`
+	Result   string  `json:"result" yaml:"result" gorm:"size:255"`                         // one of pass, fail, skip, error
+	Duration float64 `json:"duration,omitempty" yaml:"duration,omitempty"`                 // in seconds
+	Message  string  `json:"message,omitempty" yaml:"message,omitempty" gorm:"size:65536"` // e.g. the failure reason
+	TestID   uint    `json:"test_id" yaml:"test_id"`
+}
+
+// Check the test case and normalize its result
+func (tc *TestCase) validate() error {
+	if tc.Name == "" {
+		return &ValidationError{"test_cases.name", "is required"}
+	}
+	tc.Result = strings.ToLower(strings.TrimSpace(tc.Result))
+	switch tc.Result {
+	case ResultPass, ResultFail, ResultSkip, ResultError:
+	default:
+		return &ValidationError{"test_cases.result",
+			fmt.Sprintf("of %q must be one of pass, fail, skip, error", tc.Name)}
+	}
+	if tc.Duration < 0 {
+		return &ValidationError{"test_cases.duration", fmt.Sprintf("of %q must not be negative", tc.Name)}
+	}
+	return nil
+}
+
+// Move the cases given in the deprecated per result lists into Cases,
+// validate all of them and update the counters
+func (t *Test) prepareCases() error {
+	for _, l := range []struct {
+		cases  []TestCase
+		result string
+	}{
+		{t.FailedTest, ResultFail},
+		{t.PassedTest, ResultPass},
+		{t.SkippedTest, ResultSkip},
+	} {
+		for _, tc := range l.cases {
+			tc.Result = l.result
+			t.Cases = append(t.Cases, tc)
+		}
+	}
+	t.FailedTest, t.PassedTest, t.SkippedTest = nil, nil, nil
+
+	t.FailedTestsCount, t.PassedTestsCount, t.SkippedTestsCount, t.ErrorTestsCount = 0, 0, 0, 0
+	for i := range t.Cases {
+		tc := &t.Cases[i]
+		// Cases are always stored as new rows of this test
+		tc.Model = gorm.Model{}
+		tc.TestID = 0
+
+		if err := tc.validate(); err != nil {
+			return err
+		}
+		switch tc.Result {
+		case ResultPass:
+			t.PassedTestsCount++
+		case ResultFail:
+			t.FailedTestsCount++
+		case ResultSkip:
+			t.SkippedTestsCount++
+		case ResultError:
+			t.ErrorTestsCount++
+		}
+	}
+	return nil
+}
+
+// AddCases appends the cases read from a test report
+func (t *Test) AddCases(cases []parser.Case) {
+	for _, c := range cases {
+		t.Cases = append(t.Cases, TestCase{
+			Suite:    c.Suite,
+			Name:     c.Name,
+			Result:   c.Result,
+			Duration: c.Duration,
+			Message:  c.Message,
+		})
+	}
+}
+
+// Derive the status of the test from its counters. Must be called after
+// prepareCases.
+func (t *Test) deriveStatus() {
+	failed := t.FailedTestsCount + t.ErrorTestsCount
+	total := failed + t.PassedTestsCount + t.SkippedTestsCount
+
+	switch {
+	case failed > 0:
+		t.Status = "FAIL"
+		if t.StatusComment == "" {
+			t.StatusComment = fmt.Sprintf("%d of %d test cases failed", failed, total)
+		}
+	case t.PassedTestsCount > 0:
+		t.Status = "PASS"
+	default:
+		t.Status = "UNKN"
+	}
+}
+
+// TestCaseResult is a test case together with the test and board it belongs to
+type TestCaseResult struct {
+	TestCase
+	TestName     string `json:"test_name"`
+	TestedCommit string `json:"tested_commit"`
+	BoardID      uint   `json:"board_id"`
+}
+
+// TestCaseQuery selects test cases across tests. Empty fields match everything.
+type TestCaseQuery struct {
+	Name    string
+	Result  string
+	BoardID uint
+	TestID  uint
+	Limit   int
+	Offset  int
+}
+
+// FindTestCases returns matching test cases, newest first
+func (s *Store) FindTestCases(q TestCaseQuery) ([]TestCaseResult, error) {
+	db := s.db.Table("test_cases").
+		Select("test_cases.*, tests.name AS test_name, tests.tested_commit, tests.board_id").
+		Joins("JOIN tests ON tests.id = test_cases.test_id").
+		Where("test_cases.deleted_at IS NULL AND tests.deleted_at IS NULL")
+
+	if q.Name != "" {
+		db = db.Where("test_cases.name = ?", q.Name)
+	}
+	if q.Result != "" {
+		db = db.Where("test_cases.result = ?", strings.ToLower(q.Result))
+	}
+	if q.BoardID != 0 {
+		db = db.Where("tests.board_id = ?", q.BoardID)
+	}
+	if q.TestID != 0 {
+		db = db.Where("test_cases.test_id = ?", q.TestID)
+	}
+	if q.Limit <= 0 || q.Limit > 1000 {
+		q.Limit = 100
+	}
+
+	var cases []TestCaseResult
+	err := db.Order("tests.time DESC, test_cases.id").
+		Limit(q.Limit).
+		Offset(q.Offset).
+		Scan(&cases).Error
+	if err != nil {
+		return nil, err
+	}
+	return cases, nil
+}
@@ -0,0 +1,155 @@
+// models.testcase_test.go
+
+package model
+
+import (
+	"testing"
+)
+
+func TestTestCaseValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		tc     TestCase
+		result string
+		field  string
+	}{
+		{name: "pass", tc: TestCase{Name: "boot", Result: "pass"}, result: ResultPass},
+		{name: "normalized", tc: TestCase{Name: "boot", Result: " FAIL\n"}, result: ResultFail},
+		{name: "skip", tc: TestCase{Name: "boot", Result: "Skip"}, result: ResultSkip},
+		{name: "error", tc: TestCase{Name: "boot", Result: "error", Duration: 1.5}, result: ResultError},
+		{name: "without name", tc: TestCase{Result: "pass"}, field: "test_cases.name"},
+		{name: "without result", tc: TestCase{Name: "boot"}, field: "test_cases.result"},
+		{name: "unknown result", tc: TestCase{Name: "boot", Result: "passed"}, field: "test_cases.result"},
+		{name: "status instead of result", tc: TestCase{Name: "boot", Result: "PASS!"}, field: "test_cases.result"},
+		{name: "negative duration", tc: TestCase{Name: "boot", Result: "pass", Duration: -1}, field: "test_cases.duration"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.tc.validate()
+			if tt.field != "" {
+				if e, ok := err.(*ValidationError); !ok || e.Field != tt.field {
+					t.Fatalf("validate() = %v, want a validation error of %s", err, tt.field)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("validate(): %v", err)
+			}
+			if tt.tc.Result != tt.result {
+				t.Errorf("Result = %q, want %q", tt.tc.Result, tt.result)
+			}
+		})
+	}
+}
+
+func TestPrepareCases(t *testing.T) {
+	tests := []struct {
+		name string
+		test Test
+		// Passed, failed, skipped and error counts
+		counts  [4]int
+		status  string
+		comment string
+		err     bool
+	}{
+		{
+			name: "cases",
+			test: Test{Cases: []TestCase{
+				{Name: "a", Result: "pass"}, {Name: "b", Result: "fail"},
+				{Name: "c", Result: "skip"}, {Name: "d", Result: "error"},
+			}},
+			counts:  [4]int{1, 1, 1, 1},
+			status:  "FAIL",
+			comment: "2 of 4 test cases failed",
+		},
+		{
+			name: "deprecated lists",
+			test: Test{
+				Cases:       []TestCase{{Name: "a", Result: "pass"}},
+				PassedTest:  []TestCase{{Name: "b"}},
+				SkippedTest: []TestCase{{Name: "c", Result: "fail"}},
+			},
+			counts: [4]int{2, 0, 1, 0},
+			status: "PASS",
+		},
+		{
+			name:    "failed with comment",
+			test:    Test{FailedTest: []TestCase{{Name: "a"}}, StatusComment: "no display"},
+			counts:  [4]int{0, 1, 0, 0},
+			status:  "FAIL",
+			comment: "no display",
+		},
+		{
+			name:   "only skipped",
+			test:   Test{Cases: []TestCase{{Name: "a", Result: "skip"}}},
+			counts: [4]int{0, 0, 1, 0},
+			status: "UNKN",
+		},
+		{
+			name:   "no cases",
+			status: "UNKN",
+		},
+		{
+			name: "invalid case",
+			test: Test{Cases: []TestCase{{Name: "a", Result: "pass"}, {Name: "b", Result: "maybe"}}},
+			err:  true,
+		},
+		{
+			name: "invalid deprecated case",
+			test: Test{FailedTest: []TestCase{{}}},
+			err:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			test := tt.test
+			err := test.prepareCases()
+			if tt.err {
+				if !IsValidationError(err) {
+					t.Fatalf("prepareCases() = %v, want a validation error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("prepareCases(): %v", err)
+			}
+			counts := [4]int{test.PassedTestsCount, test.FailedTestsCount, test.SkippedTestsCount, test.ErrorTestsCount}
+			if counts != tt.counts {
+				t.Errorf("Counts = %v, want %v", counts, tt.counts)
+			}
+			if test.FailedTest != nil || test.PassedTest != nil || test.SkippedTest != nil {
+				t.Errorf("The deprecated lists aren't merged into the cases")
+			}
+
+			test.deriveStatus()
+			if test.Status != tt.status || test.StatusComment != tt.comment {
+				t.Errorf("Status = %q, %q, want %q, %q", test.Status, test.StatusComment, tt.status, tt.comment)
+			}
+		})
+	}
+}
+
+func TestCreateTestCases(t *testing.T) {
+	s := newTestStore(t)
+	b := createBoard(t, s, "qemu-x86")
+
+	test := Test{Name: "boot", BoardID: b.ID, Cases: []TestCase{{Name: "usb", Result: "FAIL", Message: "no device"}}}
+	if err := s.CreateTest(&test); err != nil {
+		t.Fatalf("CreateTest: %v", err)
+	}
+	if test.Status != "FAIL" {
+		t.Errorf("Status = %q, want it derived from the cases", test.Status)
+	}
+	cases, err := s.FindTestCases(TestCaseQuery{Name: "usb", Result: "FAIL"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cases) != 1 || cases[0].Result != ResultFail || cases[0].TestID != test.ID || cases[0].BoardID != b.ID {
+		t.Errorf("FindTestCases = %+v", cases)
+	}
+
+	invalid := Test{Name: "boot", BoardID: b.ID, Cases: []TestCase{{Name: "usb", Result: "broken"}}}
+	if err := s.CreateTest(&invalid); !IsValidationError(err) {
+		t.Errorf("CreateTest with an invalid result = %v, want a validation error", err)
+	}
+}
@@ -3,7 +3,6 @@
 package model
 
 import (
-	"log"
 	"net/http"
 	"strconv"
 	"strings"
@@ -16,28 +15,28 @@ import (
 
 type User struct {
 	gorm.Model
-	Username string `json:"username" table_default:"" table_descr:"The username" table_list:"Username"`
+	Username string `json:"username" table_default:"" table_descr:"The username" table_list:"Username" validate:"required,unique"`
 	Name     string `json:"name" table_default:"" table_descr:"The real name"  table_list:"Real Name"`
 
-	Email             string `json:"email" table_default:"" table_descr:"The e-mail"  table_list:"E-Mail"`
+	Email             string `json:"email" table_default:"" table_descr:"The e-mail"  table_list:"E-Mail" validate:"unique"`
 	Hidden            bool   `json:"hidden" table_default:"" table_descr:"Is hidden user"  table_list:"Is Hidden"` // User is invisible to public and other users
 	IsAdmin           bool   `json:"is_admin" table_default:"" table_descr:"Is Admin user"  table_list:"Is Admin"` // Admins can delete, add, modify users, boards and tests
-	ProfilePictureURL string `json:"profile_picture_url" table_default:"" table_descr:"Profile picture URL"`       // Admins can delete, add, modify users, boards and tests
+	Role              string `json:"role" gorm:"size:255" table_default:"viewer" table_descr:"Uploaders can add boards and upload tests, viewers can only look" table_list:"Role" validate:"oneof=viewer uploader"`
+	ProfilePictureURL string `json:"profile_picture_url" table_default:"" table_descr:"Profile picture URL"` // Admins can delete, add, modify users, boards and tests
 
-	OAuthProvider string `json:"oauth" gorm:"oauth_provider" table_default:"" table_descr:"OAuth Provider"  table_list:"OAuth Provider"` // Admins can delete, add, modify users, boards and tests
+	OAuthProvider string `json:"oauth" gorm:"oauth_provider" table_default:"" table_descr:"OAuth Provider"  table_list:"OAuth Provider" table_edit:"-"` // Admins can delete, add, modify users, boards and tests
 
-	// A user can have an API token
-	ApiToken           string `json:"api_token" gorm:"api_token" table_default:"" table_descr:"The API token"`
-	BasicAuthorization string `json:"basic_auth" gorm:"basic_auth" table_default:"" table_descr:"The Basic Auth String"` // as defined in RFC 2617
+	// API tokens are stored as APIToken
+	BasicAuthorization string `json:"-" gorm:"basic_auth" table_default:"" table_descr:"The Basic Auth String" table_edit:"-"` // as defined in RFC 2617
 
 	// Password isn't stored in DB
-	Password     string `json:"-" gorm:"-" table_default:"" table_descr:"The secret Password"`
-	PasswordHash string `json:"password_hash" gorm:"password_hash" table_default:"" table_descr:"Password hash"`
+	Password     string `json:"-" gorm:"-" table_default:"" table_descr:"The secret Password" table_input:"password"`
+	PasswordHash string `json:"-" gorm:"password_hash" table_default:"" table_descr:"Password hash" table_edit:"-"`
 }
 
 // Check if the supplied username is available
-func isUsernameAvailable(username string) bool {
-	user, err := GetUserByName(username)
+func (s *Store) isUsernameAvailable(username string) bool {
+	user, err := s.GetUserByName(username)
 	if user == nil || err != nil {
 		return true
 	}
@@ -45,17 +44,11 @@ func isUsernameAvailable(username string) bool {
 }
 
 // Return a list of all the users
-func getAllUser() ([]User, error) {
+func (s *Store) getAllUser() ([]User, error) {
 
 	var users []User
 
-	db, err := gorm.Open("sqlite3", "test.db")
-	if err != nil {
-		return nil, err
-	}
-	defer db.Close()
-
-	db.AutoMigrate(&User{})
+	db := s.db
 
 	if err := db.Find(&users).Error; err != nil {
 		return nil, err
@@ -63,16 +56,10 @@ func getAllUser() ([]User, error) {
 	return users, nil
 }
 
-func getUserByID(id int) (*User, error) {
+func (s *Store) GetUserByID(id int) (*User, error) {
 	var u User
 
-	db, err := gorm.Open("sqlite3", "test.db")
-	if err != nil {
-		return nil, err
-	}
-	defer db.Close()
-
-	db.AutoMigrate(&User{})
+	db := s.db
 
 	if err := db.First(&u, id).Error; err != nil {
 		return nil, err
@@ -80,16 +67,10 @@ func getUserByID(id int) (*User, error) {
 	return &u, nil
 }
 
-func GetUserByTag(id string, value string) (*User, error) {
+func (s *Store) GetUserByTag(id string, value string) (*User, error) {
 	var u User
 
-	db, err := gorm.Open("sqlite3", "test.db")
-	if err != nil {
-		return nil, err
-	}
-	defer db.Close()
-
-	db.AutoMigrate(&User{})
+	db := s.db
 
 	if err := db.Where(id+" = ?", value).First(&u).Error; err != nil {
 		return nil, err
@@ -97,27 +78,21 @@ func GetUserByTag(id string, value string) (*User, error) {
 	return &u, nil
 }
 
-func GetUserByBasicAuth(auth string) (*User, error) {
-	return GetUserByTag("basic_auth", auth)
+func (s *Store) GetUserByBasicAuth(auth string) (*User, error) {
+	return s.GetUserByTag("basic_authorization", auth)
 }
 
-func GetUserByName(name string) (*User, error) {
-	return GetUserByTag("username", name)
+func (s *Store) GetUserByName(name string) (*User, error) {
+	return s.GetUserByTag("username", name)
 }
 
-func GetUserByEmail(email string) (*User, error) {
-	return GetUserByTag("email", email)
+func (s *Store) GetUserByEmail(email string) (*User, error) {
+	return s.GetUserByTag("email", email)
 }
 
-func GetUserByOAuthLogin(login string, provider string) (*User, error) {
+func (s *Store) GetUserByOAuthLogin(login string, provider string) (*User, error) {
 	var u User
-	db, err := gorm.Open("sqlite3", "test.db")
-	if err != nil {
-		return nil, err
-	}
-	defer db.Close()
-
-	db.AutoMigrate(&User{})
+	db := s.db
 
 	if err := db.Where(&User{Name: login, OAuthProvider: provider}).First(&u).Error; err != nil {
 		return nil, err
@@ -126,7 +101,7 @@ func GetUserByOAuthLogin(login string, provider string) (*User, error) {
 }
 
 func UserIsPasswordValid(u *User, pass string) (bool, error) {
-	if u.Password == "" {
+	if u.PasswordHash == "" {
 		return false, nil
 	}
 	byteHash := []byte(u.PasswordHash)
@@ -138,77 +113,69 @@ func UserIsPasswordValid(u *User, pass string) (bool, error) {
 	return true, nil
 }
 
-func (u *User) DeleteFromDB() error {
-	db, err := gorm.Open("sqlite3", "test.db")
+func hashPassword(pass string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(pass), bcrypt.MinCost)
 	if err != nil {
-		return err
+		return "", err
 	}
-	defer db.Close()
-
-	if !db.HasTable(&User{}) {
-		db.CreateTable(&User{})
-	}
-
-	db.AutoMigrate(&User{})
-
-	if err := db.Delete(u).Error; err != nil {
-		return err
-	}
-	return nil
+	// GenerateFromPassword returns a byte slice so we need to
+	// convert the bytes to a string and return it
+	return string(hash), nil
 }
 
-func (u *User) InsertIntoDB() error {
-	db, err := gorm.Open("sqlite3", "test.db")
-	if err != nil {
-		return err
+func (u *User) InsertIntoDB(s *Store) error {
+	if u.Role == "" {
+		u.Role = RoleViewer
 	}
-	defer db.Close()
-
-	if !db.HasTable(&User{}) {
-		db.CreateTable(&User{})
+	if err := s.validate(s.db, u); err != nil {
+		return err
 	}
 
-	db.AutoMigrate(&User{})
-
 	// Update fields
 	if u.Password != "" {
-		hash, err := bcrypt.GenerateFromPassword([]byte(u.Password), bcrypt.MinCost)
+		hash, err := hashPassword(u.Password)
 		if err != nil {
-			log.Println(err)
-		} // GenerateFromPassword returns a byte slice so we need to
-		// convert the bytes to a string and return it
-		u.PasswordHash = string(hash)
-	}
-	if err := db.Create(u).Error; err != nil {
-		return err
+			return err
+		}
+		u.PasswordHash = hash
 	}
-	return nil
+	return s.transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(u).Error; err != nil {
+			return uniqueError(err)
+		}
+		return s.audit(tx, u, u.ID, ActionCreate, diffFields(nil, u))
+	})
 }
 
-func (u User) render(c *gin.Context, showOnly bool) {
+func (u User) render(s *Store, c *gin.Context, showOnly bool, form *editForm) {
 	// Check if the item ID is valid
 	if ID, err := strconv.Atoi(c.Param("id")); err == nil {
 		var Item string
 
-		if !showOnly {
-			if strings.Contains(c.Request.RequestURI, "/") {
-				Item = strings.Split(c.Request.RequestURI, "/")[1]
-			} else {
-				Item = c.Request.RequestURI
-			}
+		if strings.Contains(c.Request.RequestURI, "/") {
+			Item = strings.Split(c.Request.RequestURI, "/")[1]
+		} else {
+			Item = c.Request.RequestURI
 		}
 
 		// Check if the board exists
-		if user, err := getUserByID(ID); err == nil {
+		if user, err := s.GetUserByID(ID); err == nil {
 			RenderItems, err := getRenderItem(user)
 			if err != nil {
 				c.AbortWithError(http.StatusInternalServerError, err)
 			} else {
-				helper.Render(c, gin.H{
+				data := gin.H{
 					"Name":        user.Name,
 					"PostURL":     Item,
+					"ID":          user.ID,
+					"Version":     formVersion(user.Model),
 					"DisplayOnly": showOnly,
-					"payload":     RenderItems}, "listitem.html")
+					"audit":       s.auditOf(TrashUsers, user.ID),
+					"roles":       s.Roles(user),
+					"payload":     RenderItems,
+				}
+				form.apply(data, RenderItems)
+				helper.RenderStatus(c, form.status(), data, "listitem.html")
 			}
 		} else {
 			// If the item is not found, abort with an error
@@ -217,15 +184,37 @@ func (u User) render(c *gin.Context, showOnly bool) {
 	}
 }
 
-func (u User) RenderShow(c *gin.Context) {
-	u.render(c, true)
+func (u User) RenderShow(s *Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		u.render(s, c, true, nil)
+	}
+}
+
+func (u User) RenderEdit(s *Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		u.render(s, c, false, nil)
+	}
 }
 
-func (u User) RenderEdit(c *gin.Context) {
-	u.render(c, false)
+// Update stores the POSTed edit form
+func (u User) Update(s *Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		handleEditForm(c, func(id uint, update Update) error {
+			_, err := s.ForRequest(c).UpdateUser(id, update)
+			return err
+		}, func(f *editForm) {
+			u.render(s, c, false, f)
+		})
+	}
+}
+
+func (u User) RenderAll(s *Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		u.renderAll(s, c)
+	}
 }
 
-func (u User) RenderAll(c *gin.Context) {
+func (u User) renderAll(s *Store, c *gin.Context) {
 	var Item string
 
 	if strings.Contains(c.Request.RequestURI, "/") {
@@ -235,7 +224,7 @@ func (u User) RenderAll(c *gin.Context) {
 	}
 
 	// Check if the board exists
-	if users, err := getAllUser(); err == nil {
+	if users, err := s.getAllUser(); err == nil {
 		Header, List, err := getRenderList(users)
 		if err != nil {
 			c.AbortWithError(http.StatusInternalServerError, err)
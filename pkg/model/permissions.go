@@ -0,0 +1,207 @@
+// permissions.go
+
+package model
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Users have one of the roles below. Admins are users with IsAdmin, anybody
+// can look at everything. Maintainers are given per board and can change
+// their boards and the tests of them, the other roles are set on the user.
+const (
+	RoleAdmin      = "admin"
+	RoleMaintainer = "maintainer"
+	RoleUploader   = "uploader"
+	RoleViewer     = "viewer"
+)
+
+// Permission is something a user can be allowed to do
+type Permission int
+
+const (
+	// Add boards, admins and uploaders
+	PermCreateBoard Permission = iota
+	// Upload tests to the board given by ID, admins, uploaders and the
+	// maintainers of the board. ID 0 is any board.
+	PermUpload
+	// Change the board given by ID, admins and its maintainers
+	PermEditBoard
+	// Change the test given by ID, admins and the maintainers of its board
+	PermEditTest
+	// Change the user given by ID, admins and the user itself
+	PermEditUser
+	// Everything else, e.g. deleting records, admins only
+	PermAdmin
+)
+
+// BoardMaintainer makes the user a maintainer of the board
+type BoardMaintainer struct {
+	BoardID uint `gorm:"primary_key;auto_increment:false"`
+	UserID  uint `gorm:"primary_key;auto_increment:false"`
+}
+
+// IsMaintainer tells if the user maintains the board
+func (s *Store) IsMaintainer(userID, boardID uint) bool {
+	var n int
+	s.db.Model(&BoardMaintainer{}).Where("user_id = ? AND board_id = ?", userID, boardID).Count(&n)
+	return n > 0
+}
+
+// Roles returns the roles of the user, the first is the one that allows most
+func (s *Store) Roles(u *User) []string {
+	var roles []string
+	if u.IsAdmin {
+		roles = append(roles, RoleAdmin)
+	}
+	var n int
+	s.db.Model(&BoardMaintainer{}).Where("user_id = ?", u.ID).Count(&n)
+	if n > 0 {
+		roles = append(roles, RoleMaintainer)
+	}
+	if u.Role == RoleUploader {
+		roles = append(roles, RoleUploader)
+	}
+	return append(roles, RoleViewer)
+}
+
+// Authorize returns a ForbiddenError telling why the user isn't allowed to
+// do p on the record with the given ID, nil if it is
+func (s *Store) Authorize(u *User, p Permission, id uint) error {
+	if u == nil {
+		return &ForbiddenError{"You need to log in first"}
+	}
+	if u.IsAdmin {
+		return nil
+	}
+
+	switch p {
+	case PermCreateBoard:
+		if u.Role == RoleUploader {
+			return nil
+		}
+		return &ForbiddenError{"Only admins and uploaders can add boards"}
+	case PermUpload:
+		if u.Role == RoleUploader {
+			return nil
+		}
+		if id == 0 {
+			return &ForbiddenError{"Only admins and uploaders can upload tests without giving the board"}
+		}
+		if s.IsMaintainer(u.ID, id) {
+			return nil
+		}
+		return &ForbiddenError{fmt.Sprintf("Only admins, uploaders and maintainers of board %d can upload tests to it", id)}
+	case PermEditBoard:
+		if s.IsMaintainer(u.ID, id) {
+			return nil
+		}
+		return &ForbiddenError{fmt.Sprintf("Only admins and maintainers of board %d can change it", id)}
+	case PermEditTest:
+		var t Test
+		if err := s.db.Select("board_id").First(&t, id).Error; err != nil {
+			// Missing tests are reported by the handler
+			return nil
+		}
+		if s.IsMaintainer(u.ID, t.BoardID) {
+			return nil
+		}
+		return &ForbiddenError{fmt.Sprintf("Only admins and maintainers of board %d can change its tests", t.BoardID)}
+	case PermEditUser:
+		if u.ID == id {
+			return nil
+		}
+		return &ForbiddenError{"You can only change your own account"}
+	}
+	return &ForbiddenError{"Only admins can do this"}
+}
+
+// Authorize the actor of the store, for what is only known once the record
+// is read, like the board of an uploaded test. Stores without user, like the
+// ones of the commands, are allowed everything.
+func (s *Store) authorizeActor(p Permission, id uint) error {
+	if s.actor.UserID == 0 && (s.actor.Source == "" || s.actor.Source == SourceSystem) {
+		return nil
+	}
+	var u *User
+	if s.actor.UserID != 0 {
+		var err error
+		if u, err = s.GetUserByID(int(s.actor.UserID)); err != nil {
+			u = nil
+		}
+	}
+	return s.AuthorizeToken(u, s.actor.Token, p, id)
+}
+
+// BoardMaintainers returns the maintainers of the board, ordered by username
+func (s *Store) BoardMaintainers(boardID uint) ([]User, error) {
+	var users []User
+	err := s.db.Joins("JOIN board_maintainers ON board_maintainers.user_id = users.id").
+		Where("board_maintainers.board_id = ?", boardID).
+		Order("users.username").
+		Find(&users).Error
+	if err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// The usernames of the board's maintainers
+func (s *Store) maintainerNames(boardID uint) []string {
+	users, err := s.BoardMaintainers(boardID)
+	if err != nil {
+		return nil
+	}
+	names := make([]string, len(users))
+	for i := range users {
+		names[i] = users[i].Username
+	}
+	return names
+}
+
+// SetBoardMaintainers makes the users given by username the maintainers of
+// the board, replacing the previous ones
+func (s *Store) SetBoardMaintainers(boardID uint, usernames []string) error {
+	if _, err := s.GetBoardByID(int(boardID)); err != nil {
+		return err
+	}
+
+	var ids []uint
+	var names []string
+	seen := map[string]bool{}
+	for _, name := range usernames {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		u, err := s.GetUserByName(name)
+		if err != nil {
+			return &ValidationError{"maintainers", fmt.Sprintf("refers to unknown user %q", name)}
+		}
+		ids = append(ids, u.ID)
+		names = append(names, u.Username)
+	}
+	sort.Strings(names)
+	old := strings.Join(s.maintainerNames(boardID), ", ")
+
+	return s.transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("board_id = ?", boardID).Delete(&BoardMaintainer{}).Error; err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if err := tx.Create(&BoardMaintainer{BoardID: boardID, UserID: id}).Error; err != nil {
+				return err
+			}
+		}
+		cur := strings.Join(names, ", ")
+		if old == cur {
+			return nil
+		}
+		return s.audit(tx, &Board{}, boardID, ActionUpdate, FieldChanges{{"maintainers", old, cur}})
+	})
+}
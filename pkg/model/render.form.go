@@ -0,0 +1,88 @@
+// render.form.go
+
+package model
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+)
+
+// editForm is a submitted edit form that is shown again
+type editForm struct {
+	code    int
+	changes Changes
+	err     error
+}
+
+func (f *editForm) status() int {
+	if f == nil {
+		return http.StatusOK
+	}
+	return f.code
+}
+
+// Add the errors and submitted values to the render data of the edit page
+func (f *editForm) apply(data gin.H, items []RenderItem) {
+	if f == nil {
+		return
+	}
+	data["ErrorTitle"] = "Not saved"
+	data["ErrorMessage"] = f.err.Error()
+	if IsValidationError(f.err) {
+		data["ErrorMessage"] = "Please correct the marked fields"
+		data["errors"] = FieldErrorMap(f.err)
+	}
+	for i := range items {
+		if v, ok := f.changes[items[i].FormName]; ok && items[i].Input != "password" {
+			items[i].Value = fmt.Sprint(v)
+		}
+	}
+}
+
+// The version of the record, sent back with the edit form
+func formVersion(m gorm.Model) string {
+	return m.UpdatedAt.Format(time.RFC3339Nano)
+}
+
+// Store a POSTed edit form. Shows the record on success and the form again
+// with the errors, or the current values on a conflict, otherwise.
+func handleEditForm(c *gin.Context, update func(id uint, u Update) error, render func(f *editForm)) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+	if err := c.Request.ParseForm(); err != nil {
+		c.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+	version, err := time.Parse(time.RFC3339Nano, c.Request.PostForm.Get("updated_at"))
+	if err != nil {
+		c.AbortWithError(http.StatusBadRequest, fmt.Errorf("Invalid updated_at: %v", err))
+		return
+	}
+
+	u := Update{Changes: ChangesFromForm(c.Request.PostForm), Version: version}
+	err = update(uint(id), u)
+	switch {
+	case err == nil:
+		item := strings.Split(c.Request.URL.Path, "/")[1]
+		c.Redirect(http.StatusSeeOther, fmt.Sprintf("/%s/view/%d", item, id))
+	case gorm.IsRecordNotFoundError(err):
+		c.AbortWithError(http.StatusNotFound, err)
+	case err == ErrConflict:
+		render(&editForm{http.StatusConflict, nil, err})
+	case IsValidationError(err):
+		render(&editForm{http.StatusUnprocessableEntity, u.Changes, err})
+	case IsForbiddenError(err):
+		render(&editForm{http.StatusForbidden, u.Changes, err})
+	default:
+		c.AbortWithError(http.StatusInternalServerError, err)
+	}
+}
@@ -5,6 +5,7 @@ package model
 import (
 	"fmt"
 	"reflect"
+	"time"
 
 	"github.com/jinzhu/gorm"
 )
@@ -16,6 +17,42 @@ type RenderItem struct {
 	Description string
 	Title       string
 	FormName    string
+	// How the field is shown in edit forms, empty if it can't be edited
+	Input string
+}
+
+// The value of a field as shown on pages and in forms
+func renderValue(v reflect.Value) string {
+	switch x := v.Interface().(type) {
+	case string:
+		return x
+	case time.Time:
+		if x.IsZero() {
+			return ""
+		}
+		return x.Format(time.RFC3339Nano)
+	}
+	switch v.Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
+		return fmt.Sprint(v.Interface())
+	}
+	return ""
+}
+
+// The input of an edit form for the field
+func renderInput(f reflect.StructField) string {
+	switch {
+	case !editable(f):
+		return ""
+	case f.Tag.Get("table_input") != "":
+		return f.Tag.Get("table_input")
+	case f.Type.Kind() == reflect.Bool:
+		return "checkbox"
+	case columnSize(f) > 255:
+		return "textarea"
+	}
+	return "text"
 }
 
 // Convert the object to a renderable payload
@@ -31,6 +68,10 @@ func getRenderItem(r interface{}) ([]RenderItem, error) {
 			continue
 		}
 		tag := typeField.Tag
+		// Fields that aren't shown at all
+		if tag.Get("table") == "-" {
+			continue
+		}
 		if _, ok := tag.Lookup("table_default"); !ok {
 			return nil, fmt.Errorf("Field %s is missing tag table_default", typeField.Name)
 		}
@@ -38,8 +79,9 @@ func getRenderItem(r interface{}) ([]RenderItem, error) {
 			return nil, fmt.Errorf("Field %s is missing tag table_descr", typeField.Name)
 		}
 
-		ItemValue, ok := valueField.Interface().(string)
-		if !ok {
+		ItemValue := renderValue(valueField)
+		// Secrets are never sent back
+		if tag.Get("table_input") == "password" {
 			ItemValue = ""
 		}
 		m = append(m, RenderItem{
@@ -48,7 +90,8 @@ func getRenderItem(r interface{}) ([]RenderItem, error) {
 			Default:     tag.Get("table_default"),
 			Description: tag.Get("table_descr"),
 			Title:       tag.Get("table_title"),
-			FormName:    tag.Get("form"),
+			FormName:    fieldName(typeField),
+			Input:       renderInput(typeField),
 		})
 	}
 
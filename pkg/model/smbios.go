@@ -0,0 +1,163 @@
+// smbios.go
+
+package model
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/siro20/boardstatus/pkg/parser"
+)
+
+// Return the first of the strings that is set
+func firstOf(s ...string) string {
+	for _, v := range s {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// BoardFromSMBIOS returns a new board with the fields described by the
+// SMBIOS tables filled in. The system (Type 1) strings are preferred over
+// the baseboard (Type 2) ones.
+func BoardFromSMBIOS(sm *parser.SMBIOS) *Board {
+	b := &Board{
+		Manufacturer:           firstOf(sm.Manufacturer, sm.BoardManufacturer),
+		ProductName:            firstOf(sm.ProductName, sm.BoardProduct),
+		Version:                firstOf(sm.Version, sm.BoardVersion),
+		Sku:                    sm.SKU,
+		Family:                 sm.Family,
+		BoardType:              sm.BoardType,
+		Enclosure:              sm.ChassisType,
+		ProcessorSocketCount:   len(sm.Processors),
+		MaxMemorySlots:         sm.MemorySlots,
+		MaxSupportedMemoryInGB: int(sm.MaxMemoryCapacity >> 20),
+	}
+	b.Name = b.ProductName
+
+	if len(sm.Processors) > 0 {
+		p := sm.Processors[0]
+		b.ProcessorManufacturer = p.Manufacturer
+		b.ProcessorFamily = p.Family
+		b.ProcessorType = p.Version
+		b.ProcessorSocket = p.Socket
+	}
+
+	soldered := 0
+	for _, d := range sm.MemoryDevices {
+		if d.Soldered() {
+			soldered += d.SizeMB
+		}
+	}
+	b.SolderedDownMemoryInGB = soldered / 1024
+	return b
+}
+
+// BoardQuery identifies a board by its SMBIOS Type 1 strings
+type BoardQuery struct {
+	Manufacturer string `json:"manufacturer" form:"manufacturer"`
+	ProductName  string `json:"product_name" form:"product_name"`
+	Version      string `json:"version" form:"version"`
+	Sku          string `json:"sku" form:"sku"`
+}
+
+// BoardQueryFromSMBIOS returns the query for the board described by the
+// SMBIOS tables
+func BoardQueryFromSMBIOS(sm *parser.SMBIOS) BoardQuery {
+	b := BoardFromSMBIOS(sm)
+	return BoardQuery{
+		Manufacturer: b.Manufacturer,
+		ProductName:  b.ProductName,
+		Version:      b.Version,
+		Sku:          b.Sku,
+	}
+}
+
+// How well a stored value matches the queried one: 2 if equal, 1 if the
+// stored one is a prefix like pc-i440fx of pc-i440fx-8.2, 0 if either is
+// unset and tells nothing, -1 if they differ
+func matchScore(stored, queried string) int {
+	stored, queried = strings.ToLower(stored), strings.ToLower(queried)
+	switch {
+	case stored == "" || queried == "":
+		return 0
+	case stored == queried:
+		return 2
+	case strings.HasPrefix(queried, stored):
+		return 1
+	}
+	return -1
+}
+
+// Score of the version and SKU of the board, negative if either differs
+func boardScore(b *Board, q BoardQuery) int {
+	version, sku := matchScore(b.Version, q.Version), matchScore(b.Sku, q.Sku)
+	if version < 0 || sku < 0 {
+		return -1
+	}
+	return version + sku
+}
+
+// MatchBoards returns the boards with the manufacturer and product name of
+// the query, best match of version and SKU first. Boards whose version or
+// SKU differ from the query are left out.
+func (s *Store) MatchBoards(q BoardQuery) ([]Board, error) {
+	if q.Manufacturer == "" || q.ProductName == "" {
+		return nil, &ValidationError{"manufacturer", "and product_name are required"}
+	}
+
+	var boards []Board
+	err := s.db.Where("lower(manufacturer) = lower(?) AND lower(product_name) = lower(?)",
+		strings.TrimSpace(q.Manufacturer), strings.TrimSpace(q.ProductName)).
+		Order("id").Find(&boards).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []Board
+	for _, b := range boards {
+		if boardScore(&b, q) >= 0 {
+			matches = append(matches, b)
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return boardScore(&matches[i], q) > boardScore(&matches[j], q)
+	})
+	return matches, nil
+}
+
+// MatchBoard returns the board that matches the query best. It fails if no
+// board matches or several match equally well.
+func (s *Store) MatchBoard(q BoardQuery) (*Board, error) {
+	boards, err := s.MatchBoards(q)
+	if err != nil {
+		return nil, err
+	}
+	if len(boards) == 0 {
+		return nil, fmt.Errorf("No board matches %s %s", q.Manufacturer, q.ProductName)
+	}
+	if len(boards) > 1 {
+		best, next := &boards[0], &boards[1]
+		if boardScore(best, q) == boardScore(next, q) {
+			return nil, fmt.Errorf("Boards %s and %s match %s %s equally well", best.Name, next.Name, q.Manufacturer, q.ProductName)
+		}
+	}
+	return &boards[0], nil
+}
+
+// Find the board of a test without board_id by its SMBIOS tables
+func (s *Store) matchTestBoard(t *Test) error {
+	sm, err := parser.ParseSMBIOS(t.FileSMBIOS)
+	if err != nil {
+		return &ValidationError{"file_smbios", err.Error()}
+	}
+	b, err := s.MatchBoard(BoardQueryFromSMBIOS(sm))
+	if err != nil {
+		return &ValidationError{"board_id", fmt.Sprintf("is required, %v", err)}
+	}
+	t.BoardID = b.ID
+	return nil
+}
@@ -0,0 +1,55 @@
+// smbios_test.go
+
+package model
+
+import (
+	"testing"
+)
+
+func TestMatchScore(t *testing.T) {
+	tests := []struct {
+		stored, queried string
+		want            int
+	}{
+		{"pc-i440fx-8.2", "pc-i440fx-8.2", 2},
+		{"PC-i440FX-8.2", "pc-i440fx-8.2", 2},
+		{"pc-i440fx", "pc-i440fx-8.2", 1},
+		{"", "pc-i440fx-8.2", 0},
+		{"pc-i440fx-8.2", "", 0},
+		{"", "", 0},
+		{"pc-q35-8.2", "pc-i440fx-8.2", -1},
+		{"pc-i440fx-8.2", "pc-i440fx", -1},
+	}
+	for _, tt := range tests {
+		if got := matchScore(tt.stored, tt.queried); got != tt.want {
+			t.Errorf("matchScore(%q, %q) = %d, want %d", tt.stored, tt.queried, got, tt.want)
+		}
+	}
+}
+
+func TestMatchBoard(t *testing.T) {
+	s := newTestStore(t)
+	for _, b := range []Board{
+		{Name: "unknown version", Manufacturer: "QEMU", ProductName: "Standard PC"},
+		{Name: "i440fx", Manufacturer: "QEMU", ProductName: "Standard PC", Version: "pc-i440fx"},
+		{Name: "q35", Manufacturer: "QEMU", ProductName: "Standard PC", Version: "pc-q35"},
+	} {
+		if err := s.CreateBoard(&b); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b, err := s.MatchBoard(BoardQuery{Manufacturer: "qemu", ProductName: "Standard PC", Version: "pc-i440fx-8.2"})
+	if err != nil {
+		t.Fatalf("MatchBoard: %v", err)
+	}
+	if b.Name != "i440fx" {
+		t.Errorf("MatchBoard matched %q, want i440fx", b.Name)
+	}
+
+	// Nothing to tell the boards apart with
+	_, err = s.MatchBoard(BoardQuery{Manufacturer: "QEMU", ProductName: "Standard PC"})
+	if err == nil {
+		t.Errorf("MatchBoard without version matched one of several boards")
+	}
+}
@@ -0,0 +1,203 @@
+// status.go
+
+package model
+
+import (
+	"sort"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// TestHistory is a test of a board together with the commit it tested
+type TestHistory struct {
+	ID                 uint      `json:"id"`
+	Name               string    `json:"name"`
+	Time               time.Time `json:"time"`
+	TestedCommit       string    `json:"tested_commit"`
+	NameOfTestedCommit string    `json:"name_of_commit"`
+	TestedCommitTime   time.Time `json:"tested_commit_time"`
+	Status             string    `json:"status"`
+	StatusComment      string    `json:"status_comment"`
+
+	// Taken from the commits table, empty if the commit isn't resolved
+	Subject  string `json:"subject,omitempty"`
+	Describe string `json:"describe,omitempty"`
+	OnMaster bool   `json:"on_master"`
+	Position int    `json:"position,omitempty"`
+}
+
+// The point in history the test belongs to. Tests without a commit time
+// fall back to the time they ran.
+func (t TestHistory) commitTime() time.Time {
+	if !t.TestedCommitTime.IsZero() {
+		return t.TestedCommitTime
+	}
+	return t.Time
+}
+
+// Sort tests newest commit first. Commits on master are ordered by their
+// position on the branch, others by their time.
+type byCommitTime []TestHistory
+
+func (l byCommitTime) Len() int      { return len(l) }
+func (l byCommitTime) Swap(i, j int) { l[i], l[j] = l[j], l[i] }
+func (l byCommitTime) Less(i, j int) bool {
+	if pi, pj := l[i].Position, l[j].Position; pi > 0 && pj > 0 && pi != pj {
+		return pi > pj
+	}
+	ci, cj := l[i].commitTime(), l[j].commitTime()
+	if !ci.Equal(cj) {
+		return ci.After(cj)
+	}
+	// Same commit tested more than once, the latest run wins
+	if !l[i].Time.Equal(l[j].Time) {
+		return l[i].Time.After(l[j].Time)
+	}
+	return l[i].ID > l[j].ID
+}
+
+// Load the tests of the board, newest commit first
+func testHistory(tx *gorm.DB, boardID uint) ([]TestHistory, error) {
+	var tests []TestHistory
+
+	err := tx.Table("tests").
+		Select("tests.id, tests.name, tests.time, tests.tested_commit, tests.name_of_tested_commit, "+
+			"tests.tested_commit_time, tests.status, tests.status_comment, "+
+			"commits.subject, commits.describe, commits.on_master, commits.position").
+		Joins("LEFT JOIN commits ON commits.hash = tests.tested_commit AND commits.deleted_at IS NULL").
+		Where("tests.board_id = ? AND tests.deleted_at IS NULL", boardID).
+		Scan(&tests).Error
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(byCommitTime(tests))
+	return tests, nil
+}
+
+// GetTestHistory returns the tests of the board, newest commit first
+func (s *Store) GetTestHistory(boardID uint) ([]TestHistory, error) {
+	return testHistory(s.db, boardID)
+}
+
+// Load the history the board status is derived from. If configured, tests
+// that only failed because of flaky cases count as passed.
+func (s *Store) statusHistory(tx *gorm.DB, boardID uint) ([]TestHistory, error) {
+	tests, err := testHistory(tx, boardID)
+	if err != nil || !s.flaky.IgnoreInStatus {
+		return tests, err
+	}
+
+	flaky, err := onlyFlakyFailures(tx, boardID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range tests {
+		if tests[i].Status == "FAIL" && flaky[tests[i].ID] {
+			tests[i].Status = "PASS"
+			tests[i].StatusComment = "Only flaky test cases failed"
+		}
+	}
+	return tests, nil
+}
+
+// Recompute the status fields of the board from all its tests. The whole
+// history is looked at, so uploading an older commit later doesn't
+// overwrite the result of a newer one. Changes of the status are recorded
+// in the audit log of the board.
+func (s *Store) updateBoardStatus(tx *gorm.DB, boardID uint) error {
+	tests, err := s.statusHistory(tx, boardID)
+	if err != nil {
+		return err
+	}
+
+	fields := map[string]interface{}{
+		"status":                "UNKN",
+		"status_comment":        "Not tested yet",
+		"tested_commit":         "",
+		"name_of_tested_commit": "",
+		"tested_commit_time":    nil,
+		"last_good_commit":      "",
+		"last_failed_commit":    "",
+	}
+
+	// Inconclusive tests don't overwrite a known result, the board is
+	// unknown only if none of its tests passed or failed
+	if len(tests) > 0 {
+		newest := tests[0]
+		for _, t := range tests {
+			if t.Status == "PASS" || t.Status == "FAIL" {
+				newest = t
+				break
+			}
+		}
+		fields["status"] = newest.Status
+		fields["status_comment"] = newest.StatusComment
+		fields["tested_commit"] = newest.TestedCommit
+		fields["name_of_tested_commit"] = newest.NameOfTestedCommit
+		fields["tested_commit_time"] = newest.commitTime()
+	}
+
+	for _, t := range tests {
+		if t.Status == "PASS" {
+			fields["last_good_commit"] = t.TestedCommit
+			break
+		}
+	}
+	for _, t := range tests {
+		if t.Status == "FAIL" {
+			fields["last_failed_commit"] = t.TestedCommit
+			break
+		}
+	}
+
+	var old Board
+	if err := tx.Unscoped().Select("status, status_comment").First(&old, boardID).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&Board{}).Where("id = ?", boardID).UpdateColumns(fields).Error; err != nil {
+		return err
+	}
+
+	var changes FieldChanges
+	if status := fields["status"].(string); status != old.Status {
+		changes = append(changes, FieldChange{"status", old.Status, status})
+	}
+	if comment := fields["status_comment"].(string); comment != old.StatusComment {
+		changes = append(changes, FieldChange{"status_comment", old.StatusComment, comment})
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	return s.audit(tx, &Board{}, boardID, ActionUpdate, changes)
+}
+
+// RecomputeBoardStatus derives the status fields of the board from its tests
+func (s *Store) RecomputeBoardStatus(boardID uint) error {
+	return s.transaction(func(tx *gorm.DB) error {
+		return s.updateBoardStatus(tx, boardID)
+	})
+}
+
+// BisectBounds returns the newest passing commit of the board and the
+// oldest failing commit after it. Either is empty if there's no such test.
+func (s *Store) BisectBounds(boardID uint) (good, bad string, err error) {
+	tests, err := s.statusHistory(s.db, boardID)
+	if err != nil {
+		return "", "", err
+	}
+
+	for _, t := range tests {
+		if t.TestedCommit == "" {
+			continue
+		}
+		if t.Status == "PASS" {
+			good = t.TestedCommit
+			break
+		}
+		if t.Status == "FAIL" {
+			bad = t.TestedCommit
+		}
+	}
+	return good, bad, nil
+}
@@ -0,0 +1,193 @@
+// status_test.go
+
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+// A test of a board, in upload order
+type statusRun struct {
+	commit string
+	// Days after the first commit the tested commit was made
+	day    int
+	status string
+}
+
+// Store the tests as uploads to a new board
+func uploadRuns(t *testing.T, s *Store, runs []statusRun) *Board {
+	t.Helper()
+	b := createBoard(t, s, "qemu-x86")
+	start := time.Date(2020, 5, 1, 0, 0, 0, 0, time.UTC)
+	for _, r := range runs {
+		test := Test{
+			Name:          "boot",
+			BoardID:       b.ID,
+			Status:        r.status,
+			StatusComment: r.status + " at " + r.commit,
+			TestedCommit:  r.commit,
+			Time:          start.AddDate(0, 0, r.day),
+		}
+		if err := s.CreateTest(&test); err != nil {
+			t.Fatalf("CreateTest: %v", err)
+		}
+	}
+	b, err := s.GetBoardByID(int(b.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestUpdateBoardStatus(t *testing.T) {
+	tests := []struct {
+		name       string
+		runs       []statusRun
+		status     string
+		comment    string
+		commit     string
+		lastGood   string
+		lastFailed string
+	}{
+		{
+			name:    "not tested",
+			status:  "UNKN",
+			comment: "Not tested yet",
+		},
+		{
+			name:     "pass",
+			runs:     []statusRun{{"a", 1, "PASS"}},
+			status:   "PASS",
+			comment:  "PASS at a",
+			commit:   "a",
+			lastGood: "a",
+		},
+		{
+			name:       "fail after pass",
+			runs:       []statusRun{{"a", 1, "PASS"}, {"b", 2, "FAIL"}},
+			status:     "FAIL",
+			comment:    "FAIL at b",
+			commit:     "b",
+			lastGood:   "a",
+			lastFailed: "b",
+		},
+		{
+			name:     "unknown after pass",
+			runs:     []statusRun{{"a", 1, "PASS"}, {"b", 2, "UNKN"}},
+			status:   "PASS",
+			comment:  "PASS at a",
+			commit:   "a",
+			lastGood: "a",
+		},
+		{
+			name:       "unknown after fail",
+			runs:       []statusRun{{"a", 1, "PASS"}, {"b", 2, "FAIL"}, {"c", 3, "UNKN"}, {"d", 4, "UNKN"}},
+			status:     "FAIL",
+			comment:    "FAIL at b",
+			commit:     "b",
+			lastGood:   "a",
+			lastFailed: "b",
+		},
+		{
+			name:    "only unknown",
+			runs:    []statusRun{{"a", 1, "UNKN"}, {"b", 2, "UNKN"}},
+			status:  "UNKN",
+			comment: "UNKN at b",
+			commit:  "b",
+		},
+		{
+			name:       "older commit uploaded later",
+			runs:       []statusRun{{"b", 2, "PASS"}, {"a", 1, "FAIL"}},
+			status:     "PASS",
+			comment:    "PASS at b",
+			commit:     "b",
+			lastGood:   "b",
+			lastFailed: "a",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := uploadRuns(t, newTestStore(t), tt.runs)
+			if b.Status != tt.status || b.StatusComment != tt.comment || b.TestedCommit != tt.commit {
+				t.Errorf("Status = %q, %q of commit %q, want %q, %q of commit %q",
+					b.Status, b.StatusComment, b.TestedCommit, tt.status, tt.comment, tt.commit)
+			}
+			if b.LastGoodCommit != tt.lastGood || b.LastFailedCommit != tt.lastFailed {
+				t.Errorf("Last good and failed commit = %q, %q, want %q, %q",
+					b.LastGoodCommit, b.LastFailedCommit, tt.lastGood, tt.lastFailed)
+			}
+		})
+	}
+}
+
+func TestBisectBounds(t *testing.T) {
+	tests := []struct {
+		name string
+		runs []statusRun
+		good string
+		bad  string
+	}{
+		{
+			name: "not tested",
+		},
+		{
+			name: "only pass",
+			runs: []statusRun{{"a", 1, "PASS"}, {"b", 2, "PASS"}},
+			good: "b",
+		},
+		{
+			name: "only fail",
+			runs: []statusRun{{"a", 1, "FAIL"}, {"b", 2, "FAIL"}},
+			bad:  "a",
+		},
+		{
+			name: "fail after pass",
+			runs: []statusRun{{"a", 1, "PASS"}, {"b", 2, "FAIL"}},
+			good: "a",
+			bad:  "b",
+		},
+		{
+			name: "oldest failure after the pass",
+			runs: []statusRun{{"a", 1, "PASS"}, {"b", 2, "PASS"}, {"c", 3, "FAIL"}, {"d", 4, "FAIL"}},
+			good: "b",
+			bad:  "c",
+		},
+		{
+			name: "failed before",
+			runs: []statusRun{{"a", 1, "FAIL"}, {"b", 2, "PASS"}, {"c", 3, "FAIL"}},
+			good: "b",
+			bad:  "c",
+		},
+		{
+			name: "fixed",
+			runs: []statusRun{{"a", 1, "FAIL"}, {"b", 2, "PASS"}},
+			good: "b",
+		},
+		{
+			name: "unknown in between",
+			runs: []statusRun{{"a", 1, "PASS"}, {"b", 2, "UNKN"}, {"c", 3, "FAIL"}, {"d", 4, "UNKN"}},
+			good: "a",
+			bad:  "c",
+		},
+		{
+			name: "older commit uploaded later",
+			runs: []statusRun{{"c", 3, "FAIL"}, {"b", 2, "FAIL"}, {"a", 1, "PASS"}},
+			good: "a",
+			bad:  "b",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestStore(t)
+			b := uploadRuns(t, s, tt.runs)
+			good, bad, err := s.BisectBounds(b.ID)
+			if err != nil {
+				t.Fatalf("BisectBounds: %v", err)
+			}
+			if good != tt.good || bad != tt.bad {
+				t.Errorf("BisectBounds() = %q, %q, want %q, %q", good, bad, tt.good, tt.bad)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+// store.go
+
+package model
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+)
+
+// StoreConfig describes how the database backing a Store is opened
+type StoreConfig struct {
+	// Path of the SQLite database file. Use ":memory:" for a throw-away
+	// in-memory database.
+	Path string
+	// How long a connection waits for a lock held by another connection
+	// before failing with "database is locked"
+	BusyTimeout time.Duration
+	// Maximum number of open connections in the pool
+	MaxOpenConns int
+}
+
+// DefaultStoreConfig returns the configuration used when nothing else is given
+func DefaultStoreConfig() StoreConfig {
+	return StoreConfig{
+		Path:         "test.db",
+		BusyTimeout:  5 * time.Second,
+		MaxOpenConns: 8,
+	}
+}
+
+// Store holds the connection pool to the database. It is created once at
+// startup and shared by all handlers.
+type Store struct {
+	db *gorm.DB
+	// Resolves tested commits, nil if no repository is configured
+	commits CommitResolver
+	// Reads files of the firmware source tree, nil without repository
+	source SourceReader
+	flaky  FlakyConfig
+	// Percent the boot time may grow before it's a regression
+	bootTimeThreshold float64
+	// Who changes records, see WithActor
+	actor Actor
+}
+
+// Number of in-memory databases opened so far, to name the next one
+var memoryDBs uint64
+
+// Build the sqlite3 DSN for the given configuration. Every call for an
+// in-memory database names a new one.
+func (cfg StoreConfig) dsn() string {
+	q := url.Values{}
+	q.Set("_busy_timeout", fmt.Sprintf("%d", cfg.BusyTimeout.Milliseconds()))
+	q.Set("_foreign_keys", "1")
+
+	path := cfg.Path
+	if cfg.inMemory() {
+		// All connections of the pool have to share the same in-memory
+		// database, otherwise every connection would see an empty one.
+		// It gets a name of its own so that other stores don't see it.
+		path = fmt.Sprintf("file:memdb%d", atomic.AddUint64(&memoryDBs, 1))
+		q.Set("mode", "memory")
+		q.Set("cache", "shared")
+	} else {
+		q.Set("_journal_mode", "WAL")
+		q.Set("_synchronous", "NORMAL")
+	}
+
+	return path + "?" + q.Encode()
+}
+
+func (cfg StoreConfig) inMemory() bool {
+	return cfg.Path == ":memory:" || strings.HasPrefix(cfg.Path, "file::memory:")
+}
+
+// NewStore opens the database described by cfg
+func NewStore(cfg StoreConfig) (*Store, error) {
+	if cfg.Path == "" {
+		return nil, fmt.Errorf("No database path given")
+	}
+
+	db, err := gorm.Open("sqlite3", cfg.dsn())
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open database %s: %v", cfg.Path, err)
+	}
+
+	if cfg.inMemory() {
+		// Keep one connection around, the in-memory database is
+		// dropped as soon as the last connection is closed.
+		db.DB().SetMaxIdleConns(1)
+		db.DB().SetConnMaxLifetime(0)
+	}
+	if cfg.MaxOpenConns > 0 {
+		db.DB().SetMaxOpenConns(cfg.MaxOpenConns)
+	}
+
+	if err := db.DB().Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("Failed to open database %s: %v", cfg.Path, err)
+	}
+
+	return &Store{db: db, flaky: DefaultFlakyConfig(), bootTimeThreshold: 10}, nil
+}
+
+// A copy of the store that reads and writes in the transaction tx, for the
+// helpers that use the store's connection
+func (s *Store) inTransaction(tx *gorm.DB) *Store {
+	c := *s
+	c.db = tx
+	return &c
+}
+
+// Close releases all connections of the pool
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// DB returns the underlying gorm handle
+func (s *Store) DB() *gorm.DB {
+	return s.db
+}
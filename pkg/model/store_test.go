@@ -0,0 +1,288 @@
+// store_test.go
+
+package model
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Open an empty in-memory database, dropped when the test ends
+func openTestStore(t *testing.T) *Store {
+	t.Helper()
+	s, err := NewStore(StoreConfig{Path: ":memory:", BusyTimeout: time.Second, MaxOpenConns: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// Open a migrated in-memory database
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+	s := openTestStore(t)
+	if _, err := s.MigrateUp(); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func createBoard(t *testing.T, s *Store, name string) *Board {
+	t.Helper()
+	b := Board{Name: name}
+	if err := s.CreateBoard(&b); err != nil {
+		t.Fatalf("CreateBoard(%q): %v", name, err)
+	}
+	stored, err := s.GetBoardByID(int(b.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stored
+}
+
+func createUser(t *testing.T, s *Store, u User) *User {
+	t.Helper()
+	if err := u.InsertIntoDB(s); err != nil {
+		t.Fatalf("InsertIntoDB(%q): %v", u.Username, err)
+	}
+	stored, err := s.GetUserByID(int(u.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stored
+}
+
+func TestMemoryStores(t *testing.T) {
+	s := newTestStore(t)
+	other := newTestStore(t)
+	createBoard(t, s, "qemu-x86")
+
+	var n int
+	if err := other.db.Model(&Board{}).Count(&n).Error; err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Errorf("Another in-memory store sees %d boards, want its own database", n)
+	}
+}
+
+func TestCreateBoard(t *testing.T) {
+	s := newTestStore(t)
+	b := createBoard(t, s, "qemu-x86")
+	if b.Status != "UNKN" {
+		t.Errorf("Status = %q, want UNKN", b.Status)
+	}
+
+	err := s.CreateBoard(&Board{Name: "qemu-x86"})
+	if !IsValidationError(err) {
+		t.Errorf("CreateBoard with taken name = %v, want a validation error", err)
+	}
+	err = s.CreateBoard(&Board{})
+	if !IsValidationError(err) {
+		t.Errorf("CreateBoard without name = %v, want a validation error", err)
+	}
+}
+
+func TestUpdateBoard(t *testing.T) {
+	s := newTestStore(t)
+	b := createBoard(t, s, "qemu-x86")
+	createBoard(t, s, "qemu-arm")
+
+	updated, err := s.UpdateBoard(b.ID, Update{Changes: Changes{"enclosure": "Laptop"}, Version: b.UpdatedAt})
+	if err != nil {
+		t.Fatalf("UpdateBoard: %v", err)
+	}
+	if updated.Enclosure != "Laptop" {
+		t.Errorf("Enclosure = %q, want Laptop", updated.Enclosure)
+	}
+
+	// Based on the version before the update
+	_, err = s.UpdateBoard(b.ID, Update{Changes: Changes{"enclosure": "Desktop"}, Version: b.UpdatedAt})
+	if err != ErrConflict {
+		t.Errorf("UpdateBoard with old version = %v, want ErrConflict", err)
+	}
+
+	_, err = s.UpdateBoard(b.ID, Update{Changes: Changes{"name": "qemu-arm"}, Version: updated.UpdatedAt})
+	if !IsValidationError(err) {
+		t.Errorf("UpdateBoard to a taken name = %v, want a validation error", err)
+	}
+}
+
+func TestUpdateUserRole(t *testing.T) {
+	s := newTestStore(t)
+	admin := createUser(t, s, User{Username: "admin", IsAdmin: true})
+	alice := createUser(t, s, User{Username: "alice"})
+	if alice.Role != RoleViewer {
+		t.Errorf("Role of a new user = %q, want %q", alice.Role, RoleViewer)
+	}
+
+	// Not allowed for the user itself
+	self := s.WithActor(Actor{UserID: alice.ID, Name: alice.Username, Source: SourceAPI})
+	_, err := self.UpdateUser(alice.ID, Update{Changes: Changes{"role": RoleUploader}, Version: alice.UpdatedAt})
+	if !IsForbiddenError(err) {
+		t.Errorf("UpdateUser by the user = %v, want a forbidden error", err)
+	}
+
+	as := s.WithActor(Actor{UserID: admin.ID, Name: admin.Username, Source: SourceAPI})
+	u, err := as.UpdateUser(alice.ID, Update{Changes: Changes{"role": RoleUploader}, Version: alice.UpdatedAt})
+	if err != nil {
+		t.Fatalf("UpdateUser by an admin: %v", err)
+	}
+	if u.Role != RoleUploader {
+		t.Errorf("Role = %q, want %q", u.Role, RoleUploader)
+	}
+}
+
+func TestUpdateUsername(t *testing.T) {
+	s := newTestStore(t)
+	admin := createUser(t, s, User{Username: "admin", IsAdmin: true})
+	alice := createUser(t, s, User{Username: "alice"})
+
+	self := s.WithActor(Actor{UserID: alice.ID, Name: alice.Username, Source: SourceWeb})
+	_, err := self.UpdateUser(alice.ID, Update{Changes: Changes{"username": "admin2"}, Version: alice.UpdatedAt})
+	if !IsForbiddenError(err) {
+		t.Errorf("Renaming by the user = %v, want a forbidden error", err)
+	}
+	u, err := self.UpdateUser(alice.ID, Update{Changes: Changes{"username": "alice", "name": "Alice"}, Version: alice.UpdatedAt})
+	if err != nil {
+		t.Fatalf("UpdateUser with the same username: %v", err)
+	}
+
+	as := s.WithActor(Actor{UserID: admin.ID, Name: admin.Username, Source: SourceWeb})
+	if _, err := as.UpdateUser(alice.ID, Update{Changes: Changes{"username": "admin"}, Version: u.UpdatedAt}); !IsValidationError(err) {
+		t.Errorf("Renaming to a taken username = %v, want a validation error", err)
+	}
+	u, err = as.UpdateUser(alice.ID, Update{Changes: Changes{"username": "alice2"}, Version: u.UpdatedAt})
+	if err != nil {
+		t.Fatalf("Renaming by an admin: %v", err)
+	}
+	if u.Username != "alice2" {
+		t.Errorf("Username = %q, want alice2", u.Username)
+	}
+}
+
+func TestTrashBoard(t *testing.T) {
+	s := newTestStore(t)
+	b := createBoard(t, s, "qemu-x86")
+	test := Test{Name: "boot", BoardID: b.ID, Status: "PASS"}
+	if err := s.CreateTest(&test); err != nil {
+		t.Fatalf("CreateTest: %v", err)
+	}
+
+	if err := s.DeleteBoard(b.ID); err != nil {
+		t.Fatalf("DeleteBoard: %v", err)
+	}
+	if _, err := s.GetTestByID(int(test.ID)); err == nil {
+		t.Errorf("The test of a deleted board is still there")
+	}
+	if err := s.RestoreTest(test.ID); !IsValidationError(err) {
+		t.Errorf("RestoreTest of a deleted board = %v, want a validation error", err)
+	}
+
+	if err := s.RestoreBoard(b.ID); err != nil {
+		t.Fatalf("RestoreBoard: %v", err)
+	}
+	if _, err := s.GetTestByID(int(test.ID)); err != nil {
+		t.Errorf("The test wasn't restored with its board: %v", err)
+	}
+
+	// The name is taken by a new board in the meantime
+	if err := s.DeleteBoard(b.ID); err != nil {
+		t.Fatal(err)
+	}
+	createBoard(t, s, "qemu-x86")
+	if err := s.RestoreBoard(b.ID); !IsValidationError(err) {
+		t.Errorf("RestoreBoard with taken name = %v, want a validation error", err)
+	}
+
+	if err := s.PurgeBoard(b.ID); err != nil {
+		t.Fatalf("PurgeBoard: %v", err)
+	}
+	items, err := s.Trash(TrashTests)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 0 {
+		t.Errorf("The tests of a purged board are still in the trash: %v", items)
+	}
+}
+
+func TestRestoreUser(t *testing.T) {
+	s := newTestStore(t)
+	alice := createUser(t, s, User{Username: "alice"})
+	if err := s.DeleteUser(alice.ID); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+	if err := s.RestoreUser(alice.ID); err != nil {
+		t.Fatalf("RestoreUser: %v", err)
+	}
+
+	if err := s.DeleteUser(alice.ID); err != nil {
+		t.Fatal(err)
+	}
+	createUser(t, s, User{Username: "alice"})
+	if err := s.RestoreUser(alice.ID); !IsValidationError(err) {
+		t.Errorf("RestoreUser with taken username = %v, want a validation error", err)
+	}
+}
+
+func TestUniqueIndexes(t *testing.T) {
+	s := newTestStore(t)
+	b := createBoard(t, s, "qemu-x86")
+
+	// Written without validation, as by a request racing the first one
+	err := s.transaction(func(tx *gorm.DB) error {
+		return uniqueError(tx.Create(&Board{Name: "qemu-x86"}).Error)
+	})
+	if e, ok := err.(*ValidationError); !ok || e.Field != "name" {
+		t.Errorf("Creating a board with taken name = %v, want a validation error of name", err)
+	}
+
+	// Deleted boards don't count
+	if err := s.DeleteBoard(b.ID); err != nil {
+		t.Fatal(err)
+	}
+	createBoard(t, s, "qemu-x86")
+}
+
+func TestAuditBoardStatus(t *testing.T) {
+	s := newTestStore(t)
+	b := createBoard(t, s, "qemu-x86")
+
+	lab := createUser(t, s, User{Username: "lab", Role: RoleUploader})
+	as := s.WithActor(Actor{UserID: lab.ID, Name: lab.Username, Source: SourceAPI})
+	for _, status := range []string{"PASS", "PASS", "FAIL"} {
+		test := Test{Name: "boot", BoardID: b.ID, Status: status}
+		if err := as.CreateTest(&test); err != nil {
+			t.Fatalf("CreateTest: %v", err)
+		}
+	}
+
+	entries, err := s.FindAuditEntries(AuditQuery{Kind: TrashBoards, RecordID: b.ID, Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var statuses []string
+	for _, e := range entries {
+		if e.Action != ActionUpdate {
+			continue
+		}
+		for _, c := range e.Changes {
+			if c.Field == "status" {
+				statuses = append(statuses, c.Old+" -> "+c.New)
+				if e.Actor != "lab" {
+					t.Errorf("Status change recorded as made by %q, want lab", e.Actor)
+				}
+			}
+		}
+	}
+	// Newest first, the second PASS doesn't change anything
+	want := []string{"PASS -> FAIL", "UNKN -> PASS"}
+	if strings.Join(statuses, ", ") != strings.Join(want, ", ") {
+		t.Errorf("Recorded status changes %q, want %q", statuses, want)
+	}
+}
@@ -0,0 +1,304 @@
+// trash.go
+
+package model
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Records are soft deleted into the trash first. Deleting a board deletes
+// its tests along, restoring the board brings back the tests deleted with it.
+// Only records in the trash can be purged.
+
+// The kinds of records in the trash
+const (
+	TrashBoards = "boards"
+	TrashTests  = "tests"
+	TrashUsers  = "users"
+)
+
+// TrashKinds lists the kinds of records in the trash
+var TrashKinds = []string{TrashBoards, TrashTests, TrashUsers}
+
+// TrashItem is a soft deleted record
+type TrashItem struct {
+	ID        uint      `json:"id"`
+	Name      string    `json:"name"`
+	DeletedAt time.Time `json:"deleted_at"`
+	// The board of a test, and whether it was deleted with the board
+	BoardID   uint `json:"board_id,omitempty"`
+	WithBoard bool `json:"with_board,omitempty"`
+}
+
+// Trash returns the deleted records of the kind, latest deleted first
+func (s *Store) Trash(kind string) ([]TrashItem, error) {
+	var items []TrashItem
+
+	db := s.db
+	switch kind {
+	case TrashBoards:
+		db = db.Table("boards").Select("id, name, deleted_at")
+	case TrashTests:
+		db = db.Table("tests").
+			Select("tests.id, tests.name, tests.deleted_at, tests.board_id, " +
+				"COALESCE(boards.deleted_at = tests.deleted_at, 0) AS with_board").
+			Joins("LEFT JOIN boards ON boards.id = tests.board_id")
+	case TrashUsers:
+		db = db.Table("users").Select("id, username AS name, deleted_at")
+	default:
+		return nil, fmt.Errorf("Unknown kind %q, one of %v", kind, TrashKinds)
+	}
+	err := db.Where(kind + ".deleted_at IS NOT NULL").
+		Order(kind + ".deleted_at DESC").
+		Scan(&items).Error
+	if err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// Load the record from the trash, ErrRecordNotFound if it isn't in there
+func inTrash(tx *gorm.DB, v interface{}, id uint) error {
+	return tx.Unscoped().Where("id = ? AND deleted_at IS NOT NULL", id).First(v).Error
+}
+
+// Recompute what depends on the tests of the board
+func (s *Store) refreshBoard(tx *gorm.DB, boardID uint) error {
+	if err := s.rebuildRegressions(tx, boardID); err != nil {
+		return err
+	}
+	return s.updateBoardStatus(tx, boardID)
+}
+
+// DeleteBoard moves the board and its tests to the trash
+func (s *Store) DeleteBoard(id uint) error {
+	return s.transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&Board{}, id).Error; err != nil {
+			return err
+		}
+		var ids []uint
+		if err := tx.Model(&Test{}).Where("board_id = ?", id).Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		// The same time marks the tests that go with the board
+		now := gorm.NowFunc()
+		if err := tx.Model(&Test{}).Where("board_id = ?", id).UpdateColumn("deleted_at", now).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&Board{}).Where("id = ?", id).UpdateColumn("deleted_at", now).Error; err != nil {
+			return err
+		}
+		return s.auditBoard(tx, id, ids, ActionDelete)
+	})
+}
+
+// DeleteTest moves the test to the trash
+func (s *Store) DeleteTest(id uint) error {
+	return s.transaction(func(tx *gorm.DB) error {
+		var t Test
+		if err := tx.First(&t, id).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&t).Error; err != nil {
+			return err
+		}
+		if err := s.audit(tx, &t, id, ActionDelete, nil); err != nil {
+			return err
+		}
+		return s.refreshBoard(tx, t.BoardID)
+	})
+}
+
+// DeleteUser moves the user to the trash
+func (s *Store) DeleteUser(id uint) error {
+	return s.transaction(func(tx *gorm.DB) error {
+		var u User
+		if err := tx.First(&u, id).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&u).Error; err != nil {
+			return err
+		}
+		return s.audit(tx, &u, id, ActionDelete, nil)
+	})
+}
+
+// RestoreBoard brings the board back with the tests deleted along with it
+func (s *Store) RestoreBoard(id uint) error {
+	return s.transaction(func(tx *gorm.DB) error {
+		var b Board
+		if err := inTrash(tx, &b, id); err != nil {
+			return err
+		}
+		// Its name can have been taken in the meantime
+		if err := s.validate(tx, &b); err != nil {
+			return err
+		}
+
+		withBoard := tx.Unscoped().Model(&Test{}).
+			Where("board_id = ? AND deleted_at = (SELECT deleted_at FROM boards WHERE id = ?)", id, id)
+		var ids []uint
+		if err := withBoard.Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		if err := withBoard.UpdateColumn("deleted_at", nil).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Model(&b).UpdateColumn("deleted_at", nil).Error; err != nil {
+			return uniqueError(err)
+		}
+		if err := s.auditBoard(tx, id, ids, ActionRestore); err != nil {
+			return err
+		}
+		return s.refreshBoard(tx, id)
+	})
+}
+
+// RestoreTest brings the test back, its board must not be in the trash
+func (s *Store) RestoreTest(id uint) error {
+	return s.transaction(func(tx *gorm.DB) error {
+		var t Test
+		if err := inTrash(tx, &t, id); err != nil {
+			return err
+		}
+		if err := tx.First(&Board{}, t.BoardID).Error; err != nil {
+			return &ValidationError{"board_id", fmt.Sprintf("refers to the deleted board %d, restore it first", t.BoardID)}
+		}
+
+		if err := tx.Unscoped().Model(&t).UpdateColumn("deleted_at", nil).Error; err != nil {
+			return err
+		}
+		if err := s.audit(tx, &t, id, ActionRestore, nil); err != nil {
+			return err
+		}
+		return s.refreshBoard(tx, t.BoardID)
+	})
+}
+
+// RestoreUser brings the user back
+func (s *Store) RestoreUser(id uint) error {
+	return s.transaction(func(tx *gorm.DB) error {
+		var u User
+		if err := inTrash(tx, &u, id); err != nil {
+			return err
+		}
+		// The username can have been taken in the meantime
+		if err := s.validate(tx, &u); err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Model(&u).UpdateColumn("deleted_at", nil).Error; err != nil {
+			return uniqueError(err)
+		}
+		return s.audit(tx, &u, id, ActionRestore, nil)
+	})
+}
+
+// Record the action on the board and the tests that went with it
+func (s *Store) auditBoard(tx *gorm.DB, id uint, testIDs []uint, action string) error {
+	if err := s.audit(tx, &Board{}, id, action, nil); err != nil {
+		return err
+	}
+	for _, testID := range testIDs {
+		if err := s.audit(tx, &Test{}, testID, action, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Remove the test and everything stored with it for good
+func purgeTest(tx *gorm.DB, id uint) error {
+	for _, v := range []interface{}{&TestCase{}, &BootStage{}, &ConfigOption{}} {
+		if err := tx.Unscoped().Where("test_id = ?", id).Delete(v).Error; err != nil {
+			return err
+		}
+	}
+	err := tx.Unscoped().Where("test_id = ? OR previous_test_id = ?", id, id).Delete(&Regression{}).Error
+	if err != nil {
+		return err
+	}
+	return tx.Unscoped().Where("id = ?", id).Delete(&Test{}).Error
+}
+
+// PurgeBoard removes the board and all its tests from the trash for good
+func (s *Store) PurgeBoard(id uint) error {
+	return s.transaction(func(tx *gorm.DB) error {
+		if err := inTrash(tx, &Board{}, id); err != nil {
+			return err
+		}
+		var ids []uint
+		if err := tx.Unscoped().Model(&Test{}).Where("board_id = ?", id).Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		for _, testID := range ids {
+			if err := purgeTest(tx, testID); err != nil {
+				return err
+			}
+		}
+		for _, v := range []interface{}{&FlakyCase{}, &Regression{}, &BoardMaintainer{}} {
+			if err := tx.Unscoped().Where("board_id = ?", id).Delete(v).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Unscoped().Where("id = ?", id).Delete(&Board{}).Error; err != nil {
+			return err
+		}
+		return s.auditBoard(tx, id, ids, ActionPurge)
+	})
+}
+
+// PurgeTest removes the test from the trash for good
+func (s *Store) PurgeTest(id uint) error {
+	return s.transaction(func(tx *gorm.DB) error {
+		if err := inTrash(tx, &Test{}, id); err != nil {
+			return err
+		}
+		if err := purgeTest(tx, id); err != nil {
+			return err
+		}
+		return s.audit(tx, &Test{}, id, ActionPurge, nil)
+	})
+}
+
+// PurgeUser removes the user from the trash for good
+func (s *Store) PurgeUser(id uint) error {
+	return s.transaction(func(tx *gorm.DB) error {
+		if err := inTrash(tx, &User{}, id); err != nil {
+			return err
+		}
+		for _, v := range []interface{}{&BoardMaintainer{}, &APIToken{}} {
+			if err := tx.Unscoped().Where("user_id = ?", id).Delete(v).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Unscoped().Where("id = ?", id).Delete(&User{}).Error; err != nil {
+			return err
+		}
+		return s.audit(tx, &User{}, id, ActionPurge, nil)
+	})
+}
+
+// TrashAction is one of Delete, Restore or Purge of a kind of records
+type TrashAction func(s *Store, id uint) error
+
+// Actions by kind of record, for handlers that take the kind as parameter
+var (
+	DeleteActions = map[string]TrashAction{
+		TrashBoards: (*Store).DeleteBoard,
+		TrashTests:  (*Store).DeleteTest,
+		TrashUsers:  (*Store).DeleteUser,
+	}
+	RestoreActions = map[string]TrashAction{
+		TrashBoards: (*Store).RestoreBoard,
+		TrashTests:  (*Store).RestoreTest,
+		TrashUsers:  (*Store).RestoreUser,
+	}
+	PurgeActions = map[string]TrashAction{
+		TrashBoards: (*Store).PurgeBoard,
+		TrashTests:  (*Store).PurgeTest,
+		TrashUsers:  (*Store).PurgeUser,
+	}
+)
@@ -0,0 +1,301 @@
+// update.go
+
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// ErrConflict is returned when a record was changed by someone else since
+// the version the update is based on
+var ErrConflict = errors.New("The record was changed in the meantime, reload it and apply your changes again")
+
+// Changes maps field names, as in uploads and forms, to their new values
+type Changes map[string]interface{}
+
+// Update describes the changes to a single record
+type Update struct {
+	Changes Changes
+	// UpdatedAt of the record the changes are based on
+	Version time.Time
+	// Reset the editable fields missing in Changes, as for PUT
+	Replace bool
+}
+
+// The fields of gorm.Model, they can be sent back unchanged
+var modelFields = map[string]bool{
+	"ID": true, "CreatedAt": true, "UpdatedAt": true, "DeletedAt": true,
+	"id": true, "created_at": true, "updated_at": true, "deleted_at": true,
+}
+
+// ChangesFromForm returns the POSTed form values as changes, the last value
+// wins if a field is given more than once
+func ChangesFromForm(form url.Values) Changes {
+	ch := Changes{}
+	for name, values := range form {
+		if len(values) > 0 && !modelFields[name] {
+			ch[name] = values[len(values)-1]
+		}
+	}
+	return ch
+}
+
+// Fields that are derived, uploaded as a file or list, or secret can't be
+// edited directly
+func editable(f reflect.StructField) bool {
+	if f.Anonymous || f.PkgPath != "" || f.Tag.Get("table") == "-" || f.Tag.Get("table_edit") == "-" {
+		return false
+	}
+	return f.Type.Kind() != reflect.Slice
+}
+
+// Convert value to the type of fv and store it, form values are strings
+func setField(fv reflect.Value, value interface{}) error {
+	if s, ok := value.(string); ok && fv.Kind() != reflect.String {
+		if strings.TrimSpace(s) == "" {
+			fv.Set(reflect.Zero(fv.Type()))
+			return nil
+		}
+		if _, isTime := fv.Interface().(time.Time); !isTime {
+			value = json.RawMessage(s)
+		}
+	}
+	if value == nil {
+		fv.Set(reflect.Zero(fv.Type()))
+		return nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	ptr := reflect.New(fv.Type())
+	if err := json.Unmarshal(data, ptr.Interface()); err != nil {
+		return err
+	}
+	fv.Set(ptr.Elem())
+	return nil
+}
+
+func sameValue(a, b reflect.Value) bool {
+	if t, ok := a.Interface().(time.Time); ok {
+		return t.Equal(b.Interface().(time.Time))
+	}
+	return reflect.DeepEqual(a.Interface(), b.Interface())
+}
+
+// Apply the changes to the model v points to. Returns the changed columns,
+// unknown fields and changes to read-only fields are ValidationErrors.
+func applyChanges(v interface{}, ch Changes, replace bool) (map[string]interface{}, error) {
+	var errs ValidationErrors
+	cols := map[string]interface{}{}
+
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	rt := rv.Type()
+	seen := map[string]bool{}
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		if f.Anonymous || f.PkgPath != "" {
+			continue
+		}
+		name := fieldName(f)
+		value, ok := ch[name]
+		seen[name] = ok
+		if !ok && !(replace && editable(f)) {
+			continue
+		}
+
+		fv := rv.Field(i)
+		nv := reflect.New(f.Type).Elem()
+		if ok {
+			if err := setField(nv, value); err != nil {
+				errs = append(errs, &ValidationError{name, "has an invalid value"})
+				continue
+			}
+		}
+		if sameValue(fv, nv) {
+			continue
+		}
+		if !editable(f) {
+			errs = append(errs, &ValidationError{name, "can't be changed"})
+			continue
+		}
+		fv.Set(nv)
+		if f.Tag.Get("gorm") != "-" {
+			cols[gorm.ToColumnName(f.Name)] = nv.Interface()
+		}
+	}
+	for name := range ch {
+		if _, ok := seen[name]; !ok && !modelFields[name] {
+			errs = append(errs, &ValidationError{name, "is unknown"})
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return cols, nil
+}
+
+// Load the record with the given ID into v, apply and validate the changes
+// and store them, unless the record was changed since u.Version. prepare
+// can fill in derived columns, after runs in the transaction of the update.
+func (s *Store) update(v interface{}, id uint, u Update,
+	prepare func(tx *gorm.DB, cols map[string]interface{}) error,
+	after func(tx *gorm.DB, cols map[string]interface{}) error) error {
+
+	return s.transaction(func(tx *gorm.DB) error {
+		// Take the write lock first, nobody can change the record between
+		// the check of the version and the update then
+		res := tx.Table(tx.NewScope(v).TableName()).Where("id = ? AND deleted_at IS NULL", id).
+			UpdateColumn("updated_at", gorm.Expr("updated_at"))
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		if err := tx.First(v, id).Error; err != nil {
+			return err
+		}
+		version := reflect.Indirect(reflect.ValueOf(v)).FieldByName("UpdatedAt").Interface().(time.Time)
+		if !version.Equal(u.Version) {
+			return ErrConflict
+		}
+		old := reflect.New(reflect.TypeOf(v).Elem())
+		old.Elem().Set(reflect.ValueOf(v).Elem())
+
+		cols, err := applyChanges(v, u.Changes, u.Replace)
+		if err != nil {
+			return err
+		}
+		if prepare != nil {
+			if err := prepare(tx, cols); err != nil {
+				return err
+			}
+		}
+		if err := s.validate(tx, v); err != nil {
+			return err
+		}
+		if len(cols) == 0 {
+			return nil
+		}
+
+		if err := tx.Model(v).Updates(cols).Error; err != nil {
+			return uniqueError(err)
+		}
+		if err := s.audit(tx, v, id, ActionUpdate, diffFields(old.Interface(), v)); err != nil {
+			return err
+		}
+		if after != nil {
+			return after(tx, cols)
+		}
+		return nil
+	})
+}
+
+// UpdateBoard applies the changes to the board with the given ID
+func (s *Store) UpdateBoard(id uint, u Update) (*Board, error) {
+	var b Board
+	if err := s.update(&b, id, u, nil, nil); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// UpdateTest applies the changes to the test with the given ID and
+// recomputes the regressions and status of the affected boards
+func (s *Store) UpdateTest(id uint, u Update) (*Test, error) {
+	var t Test
+	oldBoardID := uint(0)
+
+	prepare := func(tx *gorm.DB, cols map[string]interface{}) error {
+		if _, ok := cols["tested_commit"]; ok {
+			s.resolveTestedCommit(&t)
+			cols["tested_commit"] = t.TestedCommit
+			cols["name_of_tested_commit"] = t.NameOfTestedCommit
+			cols["tested_commit_time"] = t.TestedCommitTime
+		}
+		if _, ok := cols["board_id"]; ok {
+			if err := tx.First(&Board{}, t.BoardID).Error; err != nil {
+				return &ValidationError{"board_id", "refers to an unknown board"}
+			}
+			if err := s.inTransaction(tx).authorizeActor(PermEditBoard, t.BoardID); err != nil {
+				return err
+			}
+			// Not yet written, the old board loses the test
+			var old Test
+			if err := tx.Select("board_id").First(&old, id).Error; err != nil {
+				return err
+			}
+			oldBoardID = old.BoardID
+		}
+		// Without explicit status the test cases decide
+		if t.Status == "" {
+			t.deriveStatus()
+			cols["status"] = t.Status
+			cols["status_comment"] = t.StatusComment
+		}
+		return nil
+	}
+	after := func(tx *gorm.DB, cols map[string]interface{}) error {
+		boards := []uint{t.BoardID}
+		if oldBoardID != 0 {
+			boards = append(boards, oldBoardID)
+		}
+		for _, boardID := range boards {
+			if err := s.rebuildRegressions(tx, boardID); err != nil {
+				return err
+			}
+			if err := s.updateBoardStatus(tx, boardID); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := s.update(&t, id, u, prepare, after); err != nil {
+		return nil, err
+	}
+	return s.GetTestByID(int(id))
+}
+
+// UpdateUser applies the changes to the user with the given ID, a new
+// password is hashed. Only admins can change the username and the role.
+func (s *Store) UpdateUser(id uint, u Update) (*User, error) {
+	var user User
+
+	prepare := func(tx *gorm.DB, cols map[string]interface{}) error {
+		// Sessions refer to the user by name, users can't rename themselves
+		adminOnly := []struct{ col, what string }{{"is_admin", "roles"}, {"role", "roles"}, {"username", "usernames"}}
+		for _, f := range adminOnly {
+			if _, ok := cols[f.col]; !ok {
+				continue
+			}
+			if err := s.inTransaction(tx).authorizeActor(PermAdmin, 0); err != nil {
+				return &ForbiddenError{"Only admins can change " + f.what}
+			}
+		}
+		if user.Password == "" {
+			return nil
+		}
+		hash, err := hashPassword(user.Password)
+		if err != nil {
+			return err
+		}
+		user.PasswordHash = hash
+		cols["password_hash"] = hash
+		return nil
+	}
+
+	if err := s.update(&user, id, u, prepare, nil); err != nil {
+		return nil, err
+	}
+	user.Password = ""
+	return &user, nil
+}
@@ -0,0 +1,244 @@
+// validate.go
+
+package model
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Validate the fields of the model v points to against their validate
+// tags, e.g. `validate:"required,max=64,unique"`:
+//
+//	required     must not be empty or zero
+//	oneof=A B C  must be one of the values, if set
+//	min=N max=N  range of numbers, length of strings in characters
+//	unique       no other record has the same value, if set
+//
+// Strings are limited to the size of their column in addition. All invalid
+// fields are returned as ValidationErrors, failures of the database and
+// invalid tags as they are. Uniqueness is checked in db, the transaction the
+// record is written in if there is one.
+func (s *Store) validate(db *gorm.DB, v interface{}) error {
+	var errs ValidationErrors
+
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		if f.Anonymous || f.PkgPath != "" {
+			continue
+		}
+		msg, err := s.validateField(db, v, rv, f, rv.Field(i))
+		if err != nil {
+			return err
+		}
+		if msg != "" {
+			errs = append(errs, &ValidationError{fieldName(f), msg})
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// The name of the field in uploads and forms
+func fieldName(f reflect.StructField) string {
+	if name := strings.Split(f.Tag.Get("json"), ",")[0]; name != "" && name != "-" {
+		return name
+	}
+	return strings.ToLower(f.Name)
+}
+
+// Size of the column from the gorm tag, 0 if not given
+func columnSize(f reflect.StructField) int {
+	for _, opt := range strings.Split(f.Tag.Get("gorm"), ";") {
+		if strings.HasPrefix(opt, "size:") {
+			n, _ := strconv.Atoi(strings.TrimPrefix(opt, "size:"))
+			return n
+		}
+	}
+	return 0
+}
+
+// A rule of a validate tag
+type validateRule struct {
+	name string
+	arg  string
+	// The argument of min and max
+	limit float64
+}
+
+// Parse the validate tag of the field
+func validateRules(f reflect.StructField) ([]validateRule, error) {
+	var rules []validateRule
+
+	tag := f.Tag.Get("validate")
+	if tag == "" {
+		return nil, nil
+	}
+	for _, rule := range strings.Split(tag, ",") {
+		kv := strings.SplitN(rule, "=", 2)
+		r := validateRule{name: kv[0]}
+		if len(kv) == 2 {
+			r.arg = kv[1]
+		}
+
+		switch r.name {
+		case "required", "unique":
+			if len(kv) == 2 {
+				return nil, fmt.Errorf("Invalid validate rule %q of %s", rule, f.Name)
+			}
+		case "oneof":
+			if len(strings.Fields(r.arg)) == 0 {
+				return nil, fmt.Errorf("Invalid validate rule %q of %s", rule, f.Name)
+			}
+		case "min", "max":
+			limit, err := strconv.ParseFloat(r.arg, 64)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid validate rule %q of %s", rule, f.Name)
+			}
+			r.limit = limit
+		default:
+			return nil, fmt.Errorf("Unknown validate rule %q of %s", rule, f.Name)
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+// checkValidateTags parses the validate tags of all fields of the model v
+// points to and returns the first invalid one
+func checkValidateTags(v interface{}) error {
+	rt := reflect.Indirect(reflect.ValueOf(v)).Type()
+	for i := 0; i < rt.NumField(); i++ {
+		if _, err := validateRules(rt.Field(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Check a single field, returns the message if it's invalid
+func (s *Store) validateField(db *gorm.DB, v interface{}, rv reflect.Value, f reflect.StructField, fv reflect.Value) (string, error) {
+	var num float64
+	isNum, isString, isZero := false, false, false
+
+	switch fv.Kind() {
+	case reflect.String:
+		isString = true
+		num = float64(utf8.RuneCountInString(fv.String()))
+		isZero = strings.TrimSpace(fv.String()) == ""
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		isNum = true
+		num = float64(fv.Int())
+		isZero = fv.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		isNum = true
+		num = float64(fv.Uint())
+		isZero = fv.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		isNum = true
+		num = fv.Float()
+		isZero = num == 0
+	default:
+		return "", nil
+	}
+
+	if size := columnSize(f); isString && size > 0 && int(num) > size {
+		return fmt.Sprintf("must be at most %d characters long", size), nil
+	}
+
+	rules, err := validateRules(f)
+	if err != nil {
+		return "", err
+	}
+	for _, r := range rules {
+		switch r.name {
+		case "required":
+			if isZero {
+				return "is required", nil
+			}
+		case "oneof":
+			if isZero {
+				continue
+			}
+			allowed := strings.Fields(r.arg)
+			ok := false
+			for _, a := range allowed {
+				if fmt.Sprint(fv.Interface()) == a {
+					ok = true
+				}
+			}
+			if !ok {
+				return "must be one of " + strings.Join(allowed, ", "), nil
+			}
+		case "min":
+			if num < r.limit {
+				if isNum {
+					return fmt.Sprintf("must be at least %s", r.arg), nil
+				}
+				return fmt.Sprintf("must be at least %s characters long", r.arg), nil
+			}
+		case "max":
+			if num > r.limit {
+				if isNum {
+					return fmt.Sprintf("must be at most %s", r.arg), nil
+				}
+				return fmt.Sprintf("must be at most %s characters long", r.arg), nil
+			}
+		case "unique":
+			if isZero {
+				continue
+			}
+			taken, err := isTaken(db, v, rv, f.Name, fv.Interface())
+			if err != nil {
+				return "", err
+			}
+			if taken {
+				return fmt.Sprintf("%v is already taken", fv.Interface()), nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// Check if another record than rv has the value in the field
+func isTaken(db *gorm.DB, v interface{}, rv reflect.Value, name string, value interface{}) (bool, error) {
+	scope := db.NewScope(v)
+	field, ok := scope.FieldByName(name)
+	if !ok {
+		return false, fmt.Errorf("Unknown field %s", name)
+	}
+
+	db = db.Table(scope.TableName()).
+		Where("deleted_at IS NULL").
+		Where(fmt.Sprintf("%s = ?", scope.Quote(field.DBName)), value)
+	if id := rv.FieldByName("ID"); id.IsValid() && id.Uint() != 0 {
+		db = db.Where("id <> ?", id.Uint())
+	}
+
+	var n int
+	if err := db.Count(&n).Error; err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// The unique indexes catch records taken between the validation and writing
+// them, their failure is reported like the unique rule
+func uniqueError(err error) error {
+	const prefix = "UNIQUE constraint failed: "
+	if err == nil || !strings.HasPrefix(err.Error(), prefix) {
+		return err
+	}
+	column := strings.Split(strings.TrimPrefix(err.Error(), prefix), ",")[0]
+	column = column[strings.LastIndex(column, ".")+1:]
+	return &ValidationError{column, "is already taken"}
+}
@@ -0,0 +1,53 @@
+// validate_test.go
+
+package model
+
+import (
+	"testing"
+)
+
+func TestModelValidateTags(t *testing.T) {
+	for _, v := range []interface{}{&Board{}, &Test{}, &User{}, &APIToken{}} {
+		if err := checkValidateTags(v); err != nil {
+			t.Errorf("%T: %v", v, err)
+		}
+	}
+}
+
+func TestInvalidValidateTags(t *testing.T) {
+	tests := []struct {
+		name string
+		v    interface{}
+	}{
+		{name: "unknown rule", v: &struct {
+			Name string `validate:"requried"`
+		}{"a"}},
+		{name: "invalid max", v: &struct {
+			Name string `validate:"max=ten"`
+		}{"a"}},
+		{name: "min without value", v: &struct {
+			Size int `validate:"min"`
+		}{1}},
+		{name: "empty oneof", v: &struct {
+			Status string `validate:"oneof="`
+		}{"PASS"}},
+		{name: "required with value", v: &struct {
+			Name string `validate:"required=true"`
+		}{"a"}},
+		{name: "trailing comma", v: &struct {
+			Name string `validate:"required,"`
+		}{"a"}},
+	}
+	s := newTestStore(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkValidateTags(tt.v); err == nil {
+				t.Errorf("checkValidateTags() succeeded, want an error")
+			}
+			err := s.validate(s.db, tt.v)
+			if err == nil || IsValidationError(err) {
+				t.Errorf("validate() = %v, want an error of the tag", err)
+			}
+		})
+	}
+}
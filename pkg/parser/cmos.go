@@ -0,0 +1,343 @@
+// cmos.go
+
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Types of cmos.layout entries
+const (
+	CMOSEnum     = "e"
+	CMOSHex      = "h"
+	CMOSString   = "s"
+	CMOSReserved = "r"
+)
+
+// CMOSEntry is an option of the entries section of a cmos.layout
+type CMOSEntry struct {
+	StartBit int
+	Length   int // in bits
+	Config   string
+	ConfigID int
+	Name     string
+}
+
+// CMOSChecksum is the checksums section of a cmos.layout. The bytes from
+// start to end are summed up and stored big endian at location, all given
+// in bits.
+type CMOSChecksum struct {
+	StartBit    int `json:"start_bit"`
+	EndBit      int `json:"end_bit"`
+	LocationBit int `json:"location_bit"`
+}
+
+// CMOSLayout is a parsed cmos.layout
+type CMOSLayout struct {
+	Entries []CMOSEntry
+	// Texts of enum values by config ID and value
+	Enums     map[int]map[uint64]string
+	Checksums []CMOSChecksum
+}
+
+// ParseCMOSLayout reads a cmos.layout file as found in coreboot's mainboard
+// directories
+func ParseCMOSLayout(r io.Reader) (*CMOSLayout, error) {
+	l := &CMOSLayout{Enums: map[int]map[uint64]string{}}
+	section := ""
+
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := sc.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) == 1 {
+			switch fields[0] {
+			case "entries", "enumerations", "checksums":
+				section = fields[0]
+				continue
+			}
+		}
+
+		var err error
+		switch section {
+		case "entries":
+			err = l.parseEntry(fields)
+		case "enumerations":
+			err = l.parseEnum(fields)
+		case "checksums":
+			err = l.parseChecksum(fields)
+		default:
+			err = fmt.Errorf("outside of a section")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Invalid cmos.layout line %d: %v", n, err)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("Failed to read cmos.layout: %v", err)
+	}
+	if len(l.Entries) == 0 {
+		return nil, fmt.Errorf("No entries found in cmos.layout")
+	}
+	return l, nil
+}
+
+// Parse the integer fields, all decimal
+func atois(fields []string) ([]int, error) {
+	var n []int
+	for _, f := range fields {
+		v, err := strconv.Atoi(f)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a number", f)
+		}
+		n = append(n, v)
+	}
+	return n, nil
+}
+
+// e.g. "384 1 e 4 boot_option"
+func (l *CMOSLayout) parseEntry(fields []string) error {
+	if len(fields) != 5 {
+		return fmt.Errorf("entries need 5 fields")
+	}
+	n, err := atois([]string{fields[0], fields[1], fields[3]})
+	if err != nil {
+		return err
+	}
+	switch fields[2] {
+	case CMOSEnum, CMOSHex, CMOSString, CMOSReserved:
+	default:
+		return fmt.Errorf("unknown config %q", fields[2])
+	}
+	if n[1] <= 0 || ((fields[2] == CMOSEnum || fields[2] == CMOSHex) && n[1] > 64) {
+		return fmt.Errorf("invalid length %d", n[1])
+	}
+	l.Entries = append(l.Entries, CMOSEntry{
+		StartBit: n[0],
+		Length:   n[1],
+		Config:   fields[2],
+		ConfigID: n[2],
+		Name:     fields[4],
+	})
+	return nil
+}
+
+// e.g. "1 0 Disable"
+func (l *CMOSLayout) parseEnum(fields []string) error {
+	if len(fields) < 3 {
+		return fmt.Errorf("enumerations need 3 fields")
+	}
+	id, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return fmt.Errorf("%q is not a number", fields[0])
+	}
+	value, err := strconv.ParseUint(fields[1], 0, 64)
+	if err != nil {
+		return fmt.Errorf("%q is not a number", fields[1])
+	}
+	if l.Enums[id] == nil {
+		l.Enums[id] = map[uint64]string{}
+	}
+	l.Enums[id][value] = strings.Join(fields[2:], " ")
+	return nil
+}
+
+// e.g. "checksum 392 983 984"
+func (l *CMOSLayout) parseChecksum(fields []string) error {
+	if len(fields) != 4 || fields[0] != "checksum" {
+		return fmt.Errorf("expected checksum <start> <end> <location>")
+	}
+	n, err := atois(fields[1:])
+	if err != nil {
+		return err
+	}
+	l.Checksums = append(l.Checksums, CMOSChecksum{StartBit: n[0], EndBit: n[1], LocationBit: n[2]})
+	return nil
+}
+
+// CMOSValue is the value of an option in a CMOS dump
+type CMOSValue struct {
+	Name   string `json:"name"`
+	Config string `json:"config"`
+	Raw    uint64 `json:"raw"`
+	// Enum text, hex number or string
+	Value string `json:"value"`
+	// False for enum values without text and options outside of the dump
+	Valid bool `json:"valid"`
+}
+
+// CMOSChecksumResult tells if a checksum of the layout matches the dump
+type CMOSChecksumResult struct {
+	CMOSChecksum
+	Stored   uint16 `json:"stored"`
+	Computed uint16 `json:"computed"`
+	Valid    bool   `json:"valid"`
+}
+
+// Read length bits starting at bit start, least significant bit first like
+// coreboot does
+func readBits(data []byte, start, length int) (uint64, bool) {
+	if start < 0 || (start+length+7)/8 > len(data) {
+		return 0, false
+	}
+	var v uint64
+	for i := 0; i < length; i++ {
+		bit := start + i
+		if data[bit/8]&(1<<uint(bit%8)) != 0 {
+			v |= 1 << uint(i)
+		}
+	}
+	return v, true
+}
+
+// Decode returns the values of the options and the checksum results of the
+// CMOS dump. Reserved entries are left out.
+func (l *CMOSLayout) Decode(data []byte) ([]CMOSValue, []CMOSChecksumResult) {
+	var values []CMOSValue
+
+	for _, e := range l.Entries {
+		if e.Config == CMOSReserved {
+			continue
+		}
+		v := CMOSValue{Name: e.Name, Config: e.Config}
+
+		if e.Config == CMOSString {
+			start, end := e.StartBit/8, (e.StartBit+e.Length)/8
+			if e.StartBit%8 == 0 && end <= len(data) {
+				v.Value = string(bytes.TrimRight(data[start:end], "\x00"))
+				v.Valid = true
+			}
+			values = append(values, v)
+			continue
+		}
+
+		raw, ok := readBits(data, e.StartBit, e.Length)
+		if !ok {
+			values = append(values, v)
+			continue
+		}
+		v.Raw = raw
+		v.Valid = true
+		switch e.Config {
+		case CMOSEnum:
+			text, ok := l.Enums[e.ConfigID][raw]
+			if ok {
+				v.Value = text
+			} else {
+				v.Value = fmt.Sprintf("invalid value %d", raw)
+				v.Valid = false
+			}
+		case CMOSHex:
+			v.Value = fmt.Sprintf("0x%x", raw)
+		}
+		values = append(values, v)
+	}
+
+	var sums []CMOSChecksumResult
+	for _, cs := range l.Checksums {
+		r := CMOSChecksumResult{CMOSChecksum: cs}
+		start, end, loc := cs.StartBit/8, cs.EndBit/8, cs.LocationBit/8
+		if start <= end && end < len(data) && loc+1 < len(data) {
+			for i := start; i <= end; i++ {
+				r.Computed += uint16(data[i])
+			}
+			r.Stored = uint16(data[loc])<<8 | uint16(data[loc+1])
+			r.Valid = r.Stored == r.Computed
+		}
+		sums = append(sums, r)
+	}
+	return values, sums
+}
+
+var (
+	// e.g. "00000010  00 01 02 ...  |...|" or "10: 00 01 02 ..."
+	cmosDumpRe = regexp.MustCompile(`^([0-9a-fA-F]+):?((?:\s+[0-9a-fA-F]{2}\b)+)`)
+	// The last line of hexdump -C only has the size
+	cmosDumpEndRe = regexp.MustCompile(`^[0-9a-fA-F]+$`)
+)
+
+// Hex dumps with larger offsets aren't CMOS dumps
+const maxCMOSDumpSize = 64 << 10
+
+// ParseCMOSDump returns the bytes of a CMOS dump. Raw binary dumps are used
+// as they are, hex dumps with an offset and single bytes per line, like the
+// ones of hexdump -C, are decoded. The bytes of each line are placed at its
+// offset, a "*" line stands for repeats of the line before it up to the
+// next offset.
+func ParseCMOSDump(dump []byte) []byte {
+	var data, prev []byte
+	repeat := false
+
+	// Make data size bytes long, repeating prev after a "*"
+	grow := func(size int) {
+		for repeat && len(data) < size {
+			n := size - len(data)
+			if n > len(prev) {
+				n = len(prev)
+			}
+			data = append(data, prev[:n]...)
+		}
+		repeat = false
+		if len(data) < size {
+			data = append(data, make([]byte, size-len(data))...)
+		}
+	}
+
+	for _, line := range strings.Split(string(dump), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if line == "*" {
+			if len(prev) == 0 {
+				return dump
+			}
+			repeat = true
+			continue
+		}
+		if cmosDumpEndRe.MatchString(line) {
+			size, err := strconv.ParseUint(line, 16, 32)
+			if err != nil || size > maxCMOSDumpSize {
+				return dump
+			}
+			grow(int(size))
+			continue
+		}
+
+		m := cmosDumpRe.FindStringSubmatch(line)
+		if m == nil {
+			return dump
+		}
+		offset, err := strconv.ParseUint(m[1], 16, 32)
+		if err != nil {
+			return dump
+		}
+		b, err := hex.DecodeString(strings.Join(strings.Fields(m[2]), ""))
+		if err != nil || offset+uint64(len(b)) > maxCMOSDumpSize {
+			return dump
+		}
+		grow(int(offset))
+		if end := int(offset) + len(b); end > len(data) {
+			data = append(data, make([]byte, end-len(data))...)
+		}
+		copy(data[offset:], b)
+		prev = b
+	}
+	if len(data) == 0 {
+		return dump
+	}
+	return data
+}
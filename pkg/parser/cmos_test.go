@@ -0,0 +1,67 @@
+// cmos_test.go
+
+package parser
+
+import (
+	"bytes"
+	"testing"
+)
+
+// 128 bytes: 0 to 15, zeros and a line of 0xff
+func cmosTestData() []byte {
+	data := make([]byte, 128)
+	for i := 0; i < 16; i++ {
+		data[i] = byte(i)
+	}
+	for i := 112; i < 128; i++ {
+		data[i] = 0xff
+	}
+	return data
+}
+
+func TestParseCMOSDump(t *testing.T) {
+	data := cmosTestData()
+
+	tests := []struct {
+		name string
+		dump string
+		want []byte
+	}{
+		{"hexdump -C", `00000000  00 01 02 03 04 05 06 07  08 09 0a 0b 0c 0d 0e 0f  |................|
+00000010  00 00 00 00 00 00 00 00  00 00 00 00 00 00 00 00  |................|
+00000020  00 00 00 00 00 00 00 00  00 00 00 00 00 00 00 00  |................|
+00000030  00 00 00 00 00 00 00 00  00 00 00 00 00 00 00 00  |................|
+00000040  00 00 00 00 00 00 00 00  00 00 00 00 00 00 00 00  |................|
+00000050  00 00 00 00 00 00 00 00  00 00 00 00 00 00 00 00  |................|
+00000060  00 00 00 00 00 00 00 00  00 00 00 00 00 00 00 00  |................|
+00000070  ff ff ff ff ff ff ff ff  ff ff ff ff ff ff ff ff  |................|
+00000080
+`, data},
+		{"hexdump -C with repeats", `00000000  00 01 02 03 04 05 06 07  08 09 0a 0b 0c 0d 0e 0f  |................|
+00000010  00 00 00 00 00 00 00 00  00 00 00 00 00 00 00 00  |................|
+*
+00000070  ff ff ff ff ff ff ff ff  ff ff ff ff ff ff ff ff  |................|
+00000080
+`, data},
+		{"repeats up to the end", `00000000  00 01 02 03 04 05 06 07  08 09 0a 0b 0c 0d 0e 0f  |................|
+00000010  ff ff ff ff ff ff ff ff  ff ff ff ff ff ff ff ff  |................|
+*
+00000040
+`, append(append([]byte{}, data[:16]...), bytes.Repeat([]byte{0xff}, 48)...)},
+		{"offsets with colon", "00: 00 01 02 03\n04: 04 05 06 07\n", data[:8]},
+		{"placed at their offset", "00000000  00 01\n00000004  04 05\n", []byte{0, 1, 0, 0, 4, 5}},
+		{"raw", string(data), data},
+		{"text", "not a dump\n", []byte("not a dump\n")},
+		{"repeat without line", "*\n00000010\n", []byte("*\n00000010\n")},
+		{"words", "0000000 0100 0302\n", []byte("0000000 0100 0302\n")},
+		{"huge offset", "ffffff00  00 01\n", []byte("ffffff00  00 01\n")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ParseCMOSDump([]byte(tt.dump))
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("ParseCMOSDump() = %d bytes % x, want %d bytes % x", len(got), got, len(tt.want), tt.want)
+			}
+		})
+	}
+}
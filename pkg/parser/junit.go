@@ -0,0 +1,144 @@
+// junit.go
+
+package parser
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+type junitTestCase struct {
+	Name      string         `xml:"name,attr"`
+	ClassName string         `xml:"classname,attr"`
+	Time      string         `xml:"time,attr"`
+	Failures  []junitMessage `xml:"failure"`
+	Errors    []junitMessage `xml:"error"`
+	Skipped   *junitMessage  `xml:"skipped"`
+}
+
+type junitTestSuite struct {
+	Name       string           `xml:"name,attr"`
+	TestCases  []junitTestCase  `xml:"testcase"`
+	TestSuites []junitTestSuite `xml:"testsuite"`
+}
+
+// Combine the message attribute and the text of a failure element
+func (m junitMessage) String() string {
+	msg := strings.TrimSpace(m.Message)
+	text := strings.TrimSpace(m.Text)
+	switch {
+	case msg == "":
+		return text
+	case text == "" || text == msg:
+		return msg
+	}
+	return msg + "\n" + text
+}
+
+func joinMessages(msgs []junitMessage) string {
+	var l []string
+	for _, m := range msgs {
+		if s := m.String(); s != "" {
+			l = append(l, s)
+		}
+	}
+	return strings.Join(l, "\n")
+}
+
+// Seconds as float, some runners use a thousands separator
+func parseSeconds(s string) float64 {
+	f, err := strconv.ParseFloat(strings.Replace(strings.TrimSpace(s), ",", "", -1), 64)
+	if err != nil || f < 0 {
+		return 0
+	}
+	return f
+}
+
+func (tc junitTestCase) toCase(suite string) Case {
+	c := Case{
+		Suite:    suite,
+		Name:     tc.Name,
+		Result:   ResultPass,
+		Duration: parseSeconds(tc.Time),
+	}
+	if c.Suite == "" {
+		c.Suite = tc.ClassName
+	}
+
+	switch {
+	case len(tc.Errors) > 0:
+		c.Result = ResultError
+		c.Message = joinMessages(tc.Errors)
+	case len(tc.Failures) > 0:
+		c.Result = ResultFail
+		c.Message = joinMessages(tc.Failures)
+	case tc.Skipped != nil:
+		c.Result = ResultSkip
+		c.Message = tc.Skipped.String()
+	}
+	return c
+}
+
+// Walk nested suites, the innermost named suite wins
+func (ts junitTestSuite) cases(parent string) []Case {
+	var l []Case
+
+	suite := ts.Name
+	if suite == "" {
+		suite = parent
+	}
+	for _, tc := range ts.TestCases {
+		l = append(l, tc.toCase(suite))
+	}
+	for _, sub := range ts.TestSuites {
+		l = append(l, sub.cases(suite)...)
+	}
+	return l
+}
+
+// ParseJUnit reads a JUnit XML document. The root element can be
+// <testsuites>, <testsuite> or a single <testcase>.
+func ParseJUnit(r io.Reader) ([]Case, error) {
+	dec := xml.NewDecoder(r)
+
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return nil, fmt.Errorf("No JUnit testsuite found")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Invalid JUnit XML: %v", err)
+		}
+
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		switch start.Name.Local {
+		case "testsuites", "testsuite":
+			var ts junitTestSuite
+			if err := dec.DecodeElement(&ts, &start); err != nil {
+				return nil, fmt.Errorf("Invalid JUnit XML: %v", err)
+			}
+			return ts.cases(""), nil
+		case "testcase":
+			var tc junitTestCase
+			if err := dec.DecodeElement(&tc, &start); err != nil {
+				return nil, fmt.Errorf("Invalid JUnit XML: %v", err)
+			}
+			return []Case{tc.toCase("")}, nil
+		default:
+			return nil, fmt.Errorf("Unexpected root element <%s> in JUnit XML", start.Name.Local)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+// junit_test.go
+
+package parser
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseJUnit(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []Case
+		err   string
+	}{
+		{
+			name: "testsuites",
+			input: `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites>
+  <testsuite name="boot">
+    <testcase name="bootblock" time="0.5"/>
+    <testcase name="romstage" time="1,200.25">
+      <failure message="timeout" type="AssertionError">no output after 60s</failure>
+    </testcase>
+    <testcase name="payload"><skipped message="no payload"/></testcase>
+    <testcase name="s3"><error message="crashed"/><failure message="ignored"/></testcase>
+  </testsuite>
+</testsuites>`,
+			want: []Case{
+				{Suite: "boot", Name: "bootblock", Result: ResultPass, Duration: 0.5},
+				{Suite: "boot", Name: "romstage", Result: ResultFail, Duration: 1200.25, Message: "timeout\nno output after 60s"},
+				{Suite: "boot", Name: "payload", Result: ResultSkip, Message: "no payload"},
+				{Suite: "boot", Name: "s3", Result: ResultError, Message: "crashed"},
+			},
+		},
+		{
+			name: "nested suites",
+			input: `<testsuite name="outer">
+  <testcase name="a"/>
+  <testsuite name="inner"><testcase name="b"/></testsuite>
+  <testsuite><testcase name="c"/></testsuite>
+</testsuite>`,
+			want: []Case{
+				{Suite: "outer", Name: "a", Result: ResultPass},
+				{Suite: "inner", Name: "b", Result: ResultPass},
+				{Suite: "outer", Name: "c", Result: ResultPass},
+			},
+		},
+		{
+			name:  "class name as suite",
+			input: `<testsuites><testsuite><testcase classname="usb.Hub" name="enumerate" time="-1"/></testsuite></testsuites>`,
+			want:  []Case{{Suite: "usb.Hub", Name: "enumerate", Result: ResultPass}},
+		},
+		{
+			name:  "single testcase",
+			input: `<testcase name="memtest"><failure>bit flip at 0x1000</failure></testcase>`,
+			want:  []Case{{Name: "memtest", Result: ResultFail, Message: "bit flip at 0x1000"}},
+		},
+		{
+			name:  "same message and text",
+			input: `<testcase name="x"><failure message="boom">boom</failure><failure message="bang"/></testcase>`,
+			want:  []Case{{Name: "x", Result: ResultFail, Message: "boom\nbang"}},
+		},
+		{
+			name:  "empty suite",
+			input: `<testsuites/>`,
+		},
+		{
+			name:  "empty",
+			input: "",
+			err:   "No JUnit testsuite found",
+		},
+		{
+			name:  "other root",
+			input: `<html><body/></html>`,
+			err:   "Unexpected root element <html>",
+		},
+		{
+			name:  "unclosed",
+			input: `<testsuite name="boot"><testcase name="a">`,
+			err:   "Invalid JUnit XML",
+		},
+		{
+			name:  "not XML",
+			input: "ok 1 - boot\n<",
+			err:   "Invalid JUnit XML",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseJUnit(strings.NewReader(tt.input))
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("ParseJUnit() error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseJUnit(): %v", err)
+			}
+			checkCases(t, got, tt.want)
+		})
+	}
+}
@@ -0,0 +1,54 @@
+// kconfig.go
+
+package parser
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ConfigOption is a Kconfig symbol of a .config and its value, "n" if it's
+// not set
+type ConfigOption struct {
+	Name  string
+	Value string
+}
+
+var (
+	configSetRe   = regexp.MustCompile(`^(CONFIG_[A-Za-z0-9_]+)=(.*)$`)
+	configUnsetRe = regexp.MustCompile(`^# (CONFIG_[A-Za-z0-9_]+) is not set$`)
+)
+
+// ParseConfig reads a .config as written by Kconfig, sorted by name. If an
+// option is given more than once the last one wins, like in Kconfig.
+func ParseConfig(r io.Reader) ([]ConfigOption, error) {
+	values := map[string]string{}
+
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if m := configSetRe.FindStringSubmatch(line); m != nil {
+			values[m[1]] = m[2]
+		} else if m := configUnsetRe.FindStringSubmatch(line); m != nil {
+			values[m[1]] = "n"
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("Failed to read config: %v", err)
+	}
+	if len(values) == 0 {
+		return nil, fmt.Errorf("No config options found")
+	}
+
+	opts := make([]ConfigOption, 0, len(values))
+	for name, value := range values {
+		opts = append(opts, ConfigOption{Name: name, Value: value})
+	}
+	sort.Slice(opts, func(i, j int) bool { return opts[i].Name < opts[j].Name })
+	return opts, nil
+}
@@ -0,0 +1,92 @@
+// kconfig_test.go
+
+package parser
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseConfig(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []ConfigOption
+		err   bool
+	}{
+		{
+			name: "config",
+			input: `#
+# Automatically generated file; DO NOT EDIT.
+# coreboot configuration
+#
+CONFIG_VENDOR_EMULATION=y
+CONFIG_CBFS_SIZE=0x400000
+CONFIG_MAINBOARD_PART_NUMBER="QEMU x86 q35/ich9"
+# CONFIG_CONSOLE_SERIAL is not set
+CONFIG_PAYLOAD_FILE=""
+`,
+			want: []ConfigOption{
+				{"CONFIG_CBFS_SIZE", "0x400000"},
+				{"CONFIG_CONSOLE_SERIAL", "n"},
+				{"CONFIG_MAINBOARD_PART_NUMBER", `"QEMU x86 q35/ich9"`},
+				{"CONFIG_PAYLOAD_FILE", `""`},
+				{"CONFIG_VENDOR_EMULATION", "y"},
+			},
+		},
+		{
+			name:  "last one wins",
+			input: "CONFIG_USB=y\n# CONFIG_USB is not set\nCONFIG_SMP=y\r\nCONFIG_SMP=n\r\n",
+			want:  []ConfigOption{{"CONFIG_SMP", "n"}, {"CONFIG_USB", "n"}},
+		},
+		{
+			name:  "indented",
+			input: "  CONFIG_DEBUG=y  \n",
+			want:  []ConfigOption{{"CONFIG_DEBUG", "y"}},
+		},
+		{
+			name: "malformed lines",
+			input: `CONFIG_OK=y
+CONFIG_ BAD=y
+config_lower=y
+CONFIG_NOVALUE
+# CONFIG_UNSET is unset
+#CONFIG_NOSPACE is not set
+`,
+			want: []ConfigOption{{"CONFIG_OK", "y"}},
+		},
+		{
+			name:  "empty",
+			input: "",
+			err:   true,
+		},
+		{
+			name:  "no options",
+			input: "# coreboot configuration\nBOOT_OK\n",
+			err:   true,
+		},
+		{
+			name:  "line too long",
+			input: "CONFIG_OK=y\nCONFIG_LONG=\"" + strings.Repeat("x", 2*1024*1024) + "\"\n",
+			err:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseConfig(strings.NewReader(tt.input))
+			if tt.err {
+				if err == nil {
+					t.Fatalf("ParseConfig() = %v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseConfig(): %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseConfig() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
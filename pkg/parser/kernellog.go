@@ -0,0 +1,50 @@
+// kernellog.go
+
+package parser
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Volatile parts of kernel log lines and what they're replaced with. The
+// order matters, e.g. UUIDs and MACs have to go before plain hex numbers.
+var kernelLogVolatile = []struct {
+	re   *regexp.Regexp
+	repl string
+}{
+	// Syslog priority and the timestamp, e.g. "<6>[    0.123456] "
+	{regexp.MustCompile(`^(<\d+>)?\[\s*\d+\.\d+\]\s?`), ""},
+	{regexp.MustCompile(`(?i)\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b`), "<uuid>"},
+	{regexp.MustCompile(`(?i)\b[0-9a-f]{2}(:[0-9a-f]{2}){5}\b`), "<mac>"},
+	{regexp.MustCompile(`(?i)\b0x[0-9a-f]+\b`), "0x<hex>"},
+	// Pointers and addresses without 0x prefix
+	{regexp.MustCompile(`(?i)\b[0-9a-f]{8,16}\b`), "<hex>"},
+	// Measurements that differ on every boot
+	{regexp.MustCompile(`\b\d+\.\d+ BogoMIPS`), "<num> BogoMIPS"},
+	{regexp.MustCompile(`\b\d+(\.\d+)? (usecs|msecs|secs|ms|us)\b`), "<num> $2"},
+	{regexp.MustCompile(`\b\d+(\.\d+)? MHz\b`), "<num> MHz"},
+	{regexp.MustCompile(`\bMemory: \d+K/\d+K available.*`), "Memory: <num>K/<num>K available"},
+	// Random seeds, PIDs of usermode helpers
+	{regexp.MustCompile(`\bpid=\d+`), "pid=<num>"},
+	{regexp.MustCompile(`\[\d+\]:`), "[<num>]:"},
+}
+
+// NormalizeKernelLog splits a kernel log into lines with timestamps,
+// addresses and other values that change on every boot replaced, so that
+// logs of two boots can be compared
+func NormalizeKernelLog(log []byte) []string {
+	var lines []string
+
+	for _, line := range strings.Split(string(log), "\n") {
+		line = strings.TrimRight(line, "\r ")
+		for _, v := range kernelLogVolatile {
+			line = v.re.ReplaceAllString(line, v.repl)
+		}
+		if line == "" {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
@@ -0,0 +1,84 @@
+// kernellog_test.go
+
+package parser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeKernelLog(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{
+			name:  "timestamp",
+			input: "<6>[    0.000000] Linux version 5.4.0 (gcc 9.3)\n[   12.345678] ACPI: Added _OSI(Module Device)\n",
+			want:  []string{"Linux version 5.4.0 (gcc 9.3)", "ACPI: Added _OSI(Module Device)"},
+		},
+		{
+			name: "addresses",
+			input: `[    0.400000] pci 0000:00:02.0: reg 0x10: [mem 0xf7800000-0xf7bfffff 64bit]
+[    0.500000] RIP: 0010:ffffffff81000000
+[    0.600000] EXT4-fs (sda1): mounted filesystem with UUID 3f1b2c4d-1111-2222-3333-444455556666
+[    0.700000] eth0: link up, address 00:1B:21:AA:BB:CC
+`,
+			want: []string{
+				"pci 0000:00:02.0: reg 0x<hex>: [mem 0x<hex>-0x<hex> 64bit]",
+				"RIP: 0010:<hex>",
+				"EXT4-fs (sda1): mounted filesystem with UUID <uuid>",
+				"eth0: link up, address <mac>",
+			},
+		},
+		{
+			name: "measurements",
+			input: `[    0.100000] Calibrating delay loop... 4800.00 BogoMIPS (lpj=9600000)
+[    0.200000] tsc: Detected 2400.123 MHz processor
+[    0.300000] Memory: 8012345K/8388608K available (12291K kernel code)
+[    0.800000] initcall foo+0x0/0x20 returned 0 after 123 usecs
+[    0.900000] systemd[1]: Started Journal.
+[    1.000000] request_module: pid=123 failed
+`,
+			want: []string{
+				"Calibrating delay loop... <num> BogoMIPS (lpj=9600000)",
+				"tsc: Detected <num> MHz processor",
+				"Memory: <num>K/<num>K available",
+				"initcall foo+0x<hex>/0x<hex> returned 0 after <num> usecs",
+				"systemd[<num>]: Started Journal.",
+				"request_module: pid=<num> failed",
+			},
+		},
+		{
+			name:  "empty lines",
+			input: "\r\n[    1.100000] \r\n   \nUSB hub found  \r\n",
+			want:  []string{"USB hub found"},
+		},
+		{
+			name:  "empty",
+			input: "",
+		},
+		{
+			name:  "malformed timestamps",
+			input: "[ abc] no timestamp\n[    0.1 unclosed\n0.123456] unopened\n",
+			want:  []string{"[ abc] no timestamp", "[    0.1 unclosed", "0.123456] unopened"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NormalizeKernelLog([]byte(tt.input))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NormalizeKernelLog() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeKernelLogTwoBoots(t *testing.T) {
+	first := NormalizeKernelLog([]byte("[    0.512345] BUG: unable to handle page fault at ffff8880aabbccdd\n[    0.600000] tsc: Refined TSC clocksource calibration: 2399.998 MHz\n"))
+	second := NormalizeKernelLog([]byte("[    0.498765] BUG: unable to handle page fault at ffff888011223344\n[    0.610000] tsc: Refined TSC clocksource calibration: 2400.004 MHz\n"))
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("Logs of two boots differ after normalization: %q, %q", first, second)
+	}
+}
@@ -0,0 +1,103 @@
+// lava.go
+
+package parser
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// A single result as exported by LAVA's /results/<job>/yaml and the
+// /api/v0.2/jobs/<job>/tests/ endpoint
+type lavaResult struct {
+	Suite       string                 `yaml:"suite"`
+	Name        string                 `yaml:"name"`
+	Result      string                 `yaml:"result"`
+	Measurement interface{}            `yaml:"measurement"`
+	Unit        string                 `yaml:"unit"`
+	Metadata    map[string]interface{} `yaml:"metadata"`
+}
+
+// The paginated JSON of the REST API
+type lavaResultPage struct {
+	Results []lavaResult `yaml:"results"`
+}
+
+// LAVA uses pass, fail, skip and unknown
+func lavaResultToResult(r string) string {
+	switch strings.ToLower(r) {
+	case "pass":
+		return ResultPass
+	case "fail":
+		return ResultFail
+	case "skip":
+		return ResultSkip
+	}
+	return ResultError
+}
+
+func (r lavaResult) toCase() Case {
+	c := Case{
+		Suite:  r.Suite,
+		Name:   r.Name,
+		Result: lavaResultToResult(r.Result),
+	}
+
+	// Suites are prefixed with their position in the job, e.g. 1_smoke
+	if i := strings.Index(c.Suite, "_"); i > 0 {
+		if _, err := strconv.Atoi(c.Suite[:i]); err == nil {
+			c.Suite = c.Suite[i+1:]
+		}
+	}
+
+	if d, ok := r.Metadata["duration"]; ok {
+		c.Duration = parseSeconds(fmt.Sprint(d))
+	}
+
+	var msg []string
+	if m := fmt.Sprint(r.Measurement); r.Measurement != nil && m != "" && m != "None" {
+		msg = append(msg, strings.TrimSpace("measurement: "+m+" "+r.Unit))
+	}
+	for _, key := range []string{"error_type", "error_msg"} {
+		if v, ok := r.Metadata[key]; ok {
+			msg = append(msg, fmt.Sprintf("%s: %v", key, v))
+		}
+	}
+	c.Message = strings.Join(msg, "\n")
+	return c
+}
+
+// ParseLAVAResults reads the results of a LAVA job, either the YAML list
+// of /results/<job>/yaml or the JSON of /api/v0.2/jobs/<job>/tests/
+func ParseLAVAResults(r io.Reader) ([]Case, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []lavaResult
+	if err := yaml.Unmarshal(data, &results); err != nil {
+		var page lavaResultPage
+		if err := yaml.Unmarshal(data, &page); err != nil {
+			return nil, fmt.Errorf("Invalid LAVA results: %v", err)
+		}
+		results = page.Results
+	}
+
+	var cases []Case
+	for _, res := range results {
+		if res.Name == "" {
+			continue
+		}
+		cases = append(cases, res.toCase())
+	}
+	if len(cases) == 0 {
+		return nil, fmt.Errorf("No LAVA test results found")
+	}
+	return cases, nil
+}
@@ -0,0 +1,23 @@
+// parser.go
+
+// Package parser reads the result and log formats produced by test runners
+// and firmware tools. It doesn't know about the database, the model package
+// turns the parsed data into records.
+package parser
+
+// Results a Case can have
+const (
+	ResultPass  = "pass"
+	ResultFail  = "fail"
+	ResultSkip  = "skip"
+	ResultError = "error"
+)
+
+// Case is a single test result found in a report
+type Case struct {
+	Suite    string
+	Name     string
+	Result   string  // one of pass, fail, skip, error
+	Duration float64 // in seconds
+	Message  string
+}
@@ -0,0 +1,400 @@
+// smbios.go
+
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// SMBIOSProcessor is a Type 4 structure
+type SMBIOSProcessor struct {
+	Socket       string
+	Manufacturer string
+	Family       string
+	Version      string
+}
+
+// SMBIOSMemoryDevice is a Type 17 structure
+type SMBIOSMemoryDevice struct {
+	SizeMB     int
+	FormFactor string
+}
+
+// Soldered tells if the memory device is soldered down on the board
+func (d SMBIOSMemoryDevice) Soldered() bool {
+	switch d.FormFactor {
+	case "Chip", "Row Of Chips", "TSOP", "Die":
+		return true
+	}
+	return false
+}
+
+// SMBIOS holds the structures of an SMBIOS table that describe the board
+type SMBIOS struct {
+	// Type 1
+	Manufacturer string
+	ProductName  string
+	Version      string
+	SKU          string
+	Family       string
+	// Type 2
+	BoardManufacturer string
+	BoardProduct      string
+	BoardVersion      string
+	BoardType         string
+	// Type 3
+	ChassisType string
+	// Type 4
+	Processors []SMBIOSProcessor
+	// Type 16, summed up over all system memory arrays
+	MemorySlots       int
+	MaxMemoryCapacity uint64 // in KiB
+	// Type 17
+	MemoryDevices []SMBIOSMemoryDevice
+}
+
+// Values firmware vendors put in unused strings
+func smbiosPlaceholder(s string) bool {
+	switch strings.ToLower(s) {
+	case "", "to be filled by o.e.m.", "default string", "not specified", "not applicable", "none", "n/a":
+		return true
+	}
+	return false
+}
+
+// Return the string or empty for placeholders
+func smbiosString(s string) string {
+	s = strings.TrimSpace(s)
+	if smbiosPlaceholder(s) {
+		return ""
+	}
+	return s
+}
+
+// ParseSMBIOS reads the output of dmidecode or a raw SMBIOS table, e.g. of
+// dmidecode --dump-bin or /sys/firmware/dmi/tables/DMI
+func ParseSMBIOS(data []byte) (*SMBIOS, error) {
+	if bytes.Contains(data, []byte("DMI type")) {
+		return ParseDMIDecode(bytes.NewReader(data))
+	}
+	return ParseSMBIOSTable(data)
+}
+
+var (
+	// e.g. "Handle 0x0001, DMI type 1, 27 bytes"
+	dmiHandleRe = regexp.MustCompile(`^Handle 0x[0-9A-Fa-f]+, DMI type (\d+),`)
+	// e.g. "Maximum Capacity: 16 GB" or "Size: 8192 MB"
+	dmiSizeRe = regexp.MustCompile(`^(\d+)\s*(bytes|kB|KB|MB|GB|TB)$`)
+)
+
+// Convert a dmidecode size to KiB
+func dmiSizeKiB(s string) uint64 {
+	m := dmiSizeRe.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return 0
+	}
+	n, _ := strconv.ParseUint(m[1], 10, 64)
+	switch m[2] {
+	case "bytes":
+		return n / 1024
+	case "MB":
+		return n << 10
+	case "GB":
+		return n << 20
+	case "TB":
+		return n << 30
+	}
+	return n
+}
+
+// ParseDMIDecode reads the text output of dmidecode, which needs to have a
+// system (Type 1) or baseboard (Type 2) structure
+func ParseDMIDecode(r io.Reader) (*SMBIOS, error) {
+	s := &SMBIOS{}
+	dmiType := -1
+	found := false
+
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := sc.Text()
+		if m := dmiHandleRe.FindStringSubmatch(line); m != nil {
+			dmiType, _ = strconv.Atoi(m[1])
+			found = found || dmiType == 1 || dmiType == 2
+			switch dmiType {
+			case 4:
+				s.Processors = append(s.Processors, SMBIOSProcessor{})
+			case 17:
+				s.MemoryDevices = append(s.MemoryDevices, SMBIOSMemoryDevice{})
+			}
+			continue
+		}
+		// Only the "Key: Value" lines directly below a structure
+		if !strings.HasPrefix(line, "\t") || strings.HasPrefix(line, "\t\t") {
+			continue
+		}
+		kv := strings.SplitN(strings.TrimSpace(line), ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		key, value := kv[0], smbiosString(kv[1])
+
+		switch dmiType {
+		case 1:
+			switch key {
+			case "Manufacturer":
+				s.Manufacturer = value
+			case "Product Name":
+				s.ProductName = value
+			case "Version":
+				s.Version = value
+			case "SKU Number":
+				s.SKU = value
+			case "Family":
+				s.Family = value
+			}
+		case 2:
+			switch key {
+			case "Manufacturer":
+				s.BoardManufacturer = value
+			case "Product Name":
+				s.BoardProduct = value
+			case "Version":
+				s.BoardVersion = value
+			case "Type":
+				s.BoardType = value
+			}
+		case 3:
+			if key == "Type" {
+				s.ChassisType = value
+			}
+		case 4:
+			p := &s.Processors[len(s.Processors)-1]
+			switch key {
+			case "Socket Designation":
+				p.Socket = value
+			case "Manufacturer":
+				p.Manufacturer = value
+			case "Family":
+				p.Family = value
+			case "Version":
+				p.Version = value
+			}
+		case 16:
+			switch key {
+			case "Maximum Capacity":
+				s.MaxMemoryCapacity += dmiSizeKiB(value)
+			case "Number Of Devices":
+				n, _ := strconv.Atoi(value)
+				s.MemorySlots += n
+			}
+		case 17:
+			d := &s.MemoryDevices[len(s.MemoryDevices)-1]
+			switch key {
+			case "Size":
+				d.SizeMB = int(dmiSizeKiB(value) >> 10)
+			case "Form Factor":
+				d.FormFactor = value
+			}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("Failed to read dmidecode output: %v", err)
+	}
+	if !found {
+		return nil, fmt.Errorf("No DMI system or baseboard information found")
+	}
+	return s, nil
+}
+
+// Texts of the enumerations used, as printed by dmidecode
+var (
+	smbiosBoardTypes = []string{1: "Unknown", "Other", "Server Blade", "Connectivity Switch",
+		"System Management Module", "Processor Module", "I/O Module", "Memory Module",
+		"Daughter Board", "Motherboard", "Processor+Memory Module", "Processor+I/O Module",
+		"Interconnect Board"}
+	smbiosChassisTypes = []string{1: "Other", "Unknown", "Desktop", "Low Profile Desktop",
+		"Pizza Box", "Mini Tower", "Tower", "Portable", "Laptop", "Notebook", "Hand Held",
+		"Docking Station", "All In One", "Sub Notebook", "Space-saving", "Lunch Box",
+		"Main Server Chassis", "Expansion Chassis", "Sub Chassis", "Bus Expansion Chassis",
+		"Peripheral Chassis", "RAID Chassis", "Rack Mount Chassis", "Sealed-case PC",
+		"Multi-system", "CompactPCI", "AdvancedTCA", "Blade", "Blade Enclosing", "Tablet",
+		"Convertible", "Detachable", "IoT Gateway", "Embedded PC", "Mini PC", "Stick PC"}
+	smbiosFormFactors = []string{1: "Other", "Unknown", "SIMM", "SIP", "Chip", "DIP", "ZIP",
+		"Proprietary Card", "DIMM", "TSOP", "Row Of Chips", "RIMM", "SODIMM", "SRIMM",
+		"FB-DIMM", "Die"}
+	// Only the common ones, the full list has a few hundred entries
+	smbiosProcessorFamilies = map[uint16]string{
+		0x01: "Other", 0x02: "Unknown", 0x0F: "Celeron", 0x10: "Pentium II Xeon",
+		0x11: "Pentium III", 0x28: "Core Duo", 0x29: "Core Duo Mobile", 0x2A: "Core Solo Mobile",
+		0x2B: "Atom", 0x2C: "Core M", 0x2D: "Core m3", 0x2E: "Core m5", 0x2F: "Core m7",
+		0xB3: "Xeon", 0xBF: "Core 2 Duo", 0xC1: "Core 2 Extreme", 0xC6: "Core i7",
+		0xCD: "Core i5", 0xCE: "Core i3", 0x6B: "Zen", 0x83: "Athlon 64", 0x84: "Opteron",
+		0x100: "ARMv7", 0x101: "ARMv8", 0x200: "RISC-V RV32", 0x201: "RISC-V RV64",
+	}
+)
+
+func smbiosEnum(texts []string, v int) string {
+	if v > 0 && v < len(texts) {
+		return texts[v]
+	}
+	return ""
+}
+
+// Find the start and end of the structure table. Dumps that start with an
+// entry point, like the ones of dmidecode --dump-bin, point to the table.
+func smbiosTableBounds(data []byte) (int, int) {
+	switch {
+	case bytes.HasPrefix(data, []byte("_SM3_")) && len(data) >= 0x18:
+		start := int(binary.LittleEndian.Uint64(data[0x10:]))
+		end := start + int(binary.LittleEndian.Uint32(data[0x0C:]))
+		if start < len(data) {
+			if end > len(data) || end <= start {
+				end = len(data)
+			}
+			return start, end
+		}
+	case bytes.HasPrefix(data, []byte("_SM_")) && len(data) >= 0x1C:
+		start := int(binary.LittleEndian.Uint32(data[0x18:]))
+		end := start + int(binary.LittleEndian.Uint16(data[0x16:]))
+		if start < len(data) {
+			if end > len(data) || end <= start {
+				end = len(data)
+			}
+			return start, end
+		}
+	}
+	return 0, len(data)
+}
+
+// Length of the formatted area of the oldest version of the structures read
+var smbiosMinLength = map[int]int{1: 0x08, 2: 0x08, 3: 0x09, 4: 0x1A, 16: 0x0F, 17: 0x15}
+
+// Types 44 to 125 aren't defined, 126 is inactive, 127 ends the table and
+// the ones from 128 on are OEM specific
+func smbiosValidType(typ int) bool {
+	return typ <= 43 || typ >= 126
+}
+
+// ParseSMBIOSTable reads a raw SMBIOS structure table. It needs to have a
+// system (Type 1) or baseboard (Type 2) structure.
+func ParseSMBIOSTable(data []byte) (*SMBIOS, error) {
+	s := &SMBIOS{}
+	found := false
+
+	pos, end := smbiosTableBounds(data)
+	for pos+4 <= end {
+		typ, length := int(data[pos]), int(data[pos+1])
+		if !smbiosValidType(typ) {
+			return nil, fmt.Errorf("Invalid SMBIOS structure type %d at offset %#x", typ, pos)
+		}
+		if length < 4 || length < smbiosMinLength[typ] {
+			return nil, fmt.Errorf("SMBIOS structure of type %d at offset %#x is too short (%d bytes)", typ, pos, length)
+		}
+		if pos+length > end {
+			return nil, fmt.Errorf("SMBIOS structure of type %d at offset %#x is truncated", typ, pos)
+		}
+		formatted := data[pos : pos+length]
+
+		// The strings follow the formatted area, ended by two NULs
+		strEnd := bytes.Index(data[pos+length:end], []byte{0, 0})
+		if strEnd < 0 {
+			return nil, fmt.Errorf("Strings of the SMBIOS structure of type %d at offset %#x aren't terminated", typ, pos)
+		}
+		strs := bytes.Split(data[pos+length:pos+length+strEnd], []byte{0})
+		str := func(off int) string {
+			if off >= len(formatted) {
+				return ""
+			}
+			i := int(formatted[off])
+			if i == 0 || i > len(strs) {
+				return ""
+			}
+			return smbiosString(string(strs[i-1]))
+		}
+		byteAt := func(off int) int {
+			if off >= len(formatted) {
+				return 0
+			}
+			return int(formatted[off])
+		}
+		word := func(off int) uint64 {
+			if off+2 > len(formatted) {
+				return 0
+			}
+			return uint64(binary.LittleEndian.Uint16(formatted[off:]))
+		}
+		dword := func(off int) uint64 {
+			if off+4 > len(formatted) {
+				return 0
+			}
+			return uint64(binary.LittleEndian.Uint32(formatted[off:]))
+		}
+
+		switch typ {
+		case 1:
+			found = true
+			s.Manufacturer = str(0x04)
+			s.ProductName = str(0x05)
+			s.Version = str(0x06)
+			s.SKU = str(0x19)
+			s.Family = str(0x1A)
+		case 2:
+			found = true
+			s.BoardManufacturer = str(0x04)
+			s.BoardProduct = str(0x05)
+			s.BoardVersion = str(0x06)
+			s.BoardType = smbiosEnum(smbiosBoardTypes, byteAt(0x0D))
+		case 3:
+			s.ChassisType = smbiosEnum(smbiosChassisTypes, byteAt(0x05)&0x7f)
+		case 4:
+			family := uint16(byteAt(0x06))
+			if family == 0xFE {
+				family = uint16(word(0x28))
+			}
+			s.Processors = append(s.Processors, SMBIOSProcessor{
+				Socket:       str(0x04),
+				Manufacturer: str(0x07),
+				Family:       smbiosProcessorFamilies[family],
+				Version:      str(0x10),
+			})
+		case 16:
+			// Only system memory
+			if byteAt(0x05) == 0x03 {
+				capacity := dword(0x07)
+				if capacity == 0x80000000 && length >= 0x17 {
+					capacity = binary.LittleEndian.Uint64(formatted[0x0F:]) >> 10
+				}
+				s.MaxMemoryCapacity += capacity
+				s.MemorySlots += int(word(0x0D))
+			}
+		case 17:
+			d := SMBIOSMemoryDevice{FormFactor: smbiosEnum(smbiosFormFactors, byteAt(0x0E))}
+			switch size := word(0x0C); {
+			case size == 0x7FFF:
+				d.SizeMB = int(dword(0x1C) & 0x7FFFFFFF)
+			case size == 0xFFFF:
+			case size&0x8000 != 0:
+				d.SizeMB = int(size&0x7FFF) >> 10
+			default:
+				d.SizeMB = int(size)
+			}
+			s.MemoryDevices = append(s.MemoryDevices, d)
+		case 127:
+			pos = end
+			continue
+		}
+		pos += length + strEnd + 2
+	}
+
+	if !found {
+		return nil, fmt.Errorf("No SMBIOS system or baseboard information found")
+	}
+	return s, nil
+}
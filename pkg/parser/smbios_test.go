@@ -0,0 +1,120 @@
+// smbios_test.go
+
+package parser
+
+import (
+	"strings"
+	"testing"
+)
+
+// Build a structure of the type with the formatted area and strings
+func smbiosStructure(typ byte, formatted []byte, strs ...string) []byte {
+	data := append([]byte{typ, byte(len(formatted) + 4), 0, 0}, formatted...)
+	for _, s := range strs {
+		data = append(append(data, s...), 0)
+	}
+	if len(strs) == 0 {
+		data = append(data, 0)
+	}
+	return append(data, 0)
+}
+
+var smbiosEnd = smbiosStructure(127, nil)
+
+// Type 1 with manufacturer, product name and version
+var smbiosSystem = smbiosStructure(1, []byte{1, 2, 3, 0}, "Emulation", "Standard PC (Q35 + ICH9, 2009)", "pc-q35-8.2")
+
+func TestParseSMBIOSTable(t *testing.T) {
+	chassis := smbiosStructure(3, []byte{1, 3, 0, 0, 0})
+
+	tests := []struct {
+		name    string
+		data    []byte
+		product string
+		err     string
+	}{
+		{"system", concat(smbiosSystem, chassis, smbiosEnd), "Standard PC (Q35 + ICH9, 2009)", ""},
+		{"baseboard", concat(smbiosStructure(2, []byte{1, 2, 0, 0}, "LENOVO", "20HRCTO1WW"), smbiosEnd), "", ""},
+		{"OEM structure", concat(smbiosStructure(200, []byte{1, 2, 3}), smbiosSystem, smbiosEnd), "Standard PC (Q35 + ICH9, 2009)", ""},
+		{"no system", concat(chassis, smbiosEnd), "", "No SMBIOS system or baseboard"},
+		{"empty", nil, "", "No SMBIOS system or baseboard"},
+		{"garbage", []byte("this is not an SMBIOS table at all"), "", "Invalid SMBIOS structure type"},
+		{"invalid type", concat(smbiosStructure(60, []byte{1, 2}), smbiosSystem), "", "Invalid SMBIOS structure type 60"},
+		{"too short", concat(smbiosStructure(4, []byte{1, 2}), smbiosSystem), "", "too short"},
+		{"truncated", smbiosSystem[:6], "", "truncated"},
+		{"unterminated strings", smbiosSystem[:len(smbiosSystem)-2], "", "aren't terminated"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := ParseSMBIOSTable(tt.data)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("ParseSMBIOSTable() error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseSMBIOSTable(): %v", err)
+			}
+			if s.ProductName != tt.product {
+				t.Errorf("ProductName = %q, want %q", s.ProductName, tt.product)
+			}
+		})
+	}
+}
+
+func TestParseSMBIOSEntryPoint(t *testing.T) {
+	// 64-bit entry point of dmidecode --dump-bin, the table follows it
+	entry := make([]byte, 0x20)
+	copy(entry, "_SM3_")
+	table := concat(smbiosSystem, smbiosEnd)
+	entry[0x0C] = byte(len(table))
+	entry[0x10] = 0x20
+
+	s, err := ParseSMBIOS(concat(entry, table))
+	if err != nil {
+		t.Fatalf("ParseSMBIOS(): %v", err)
+	}
+	if s.Manufacturer != "Emulation" || s.Version != "pc-q35-8.2" {
+		t.Errorf("Manufacturer, Version = %q, %q", s.Manufacturer, s.Version)
+	}
+}
+
+func TestParseDMIDecode(t *testing.T) {
+	out := `# dmidecode 3.5
+Handle 0x0100, DMI type 1, 27 bytes
+System Information
+	Manufacturer: QEMU
+	Product Name: Standard PC (i440FX + PIIX, 1996)
+	Version: pc-i440fx-8.2
+	SKU Number: To Be Filled By O.E.M.
+
+Handle 0x1100, DMI type 17, 40 bytes
+Memory Device
+	Size: 8 GB
+	Form Factor: DIMM
+`
+	s, err := ParseSMBIOS([]byte(out))
+	if err != nil {
+		t.Fatalf("ParseSMBIOS(): %v", err)
+	}
+	if s.Manufacturer != "QEMU" || s.Version != "pc-i440fx-8.2" || s.SKU != "" {
+		t.Errorf("Manufacturer, Version, SKU = %q, %q, %q", s.Manufacturer, s.Version, s.SKU)
+	}
+	if len(s.MemoryDevices) != 1 || s.MemoryDevices[0].SizeMB != 8192 {
+		t.Errorf("MemoryDevices = %+v", s.MemoryDevices)
+	}
+
+	_, err = ParseSMBIOS([]byte("Handle 0x0300, DMI type 3, 22 bytes\nChassis Information\n\tType: Desktop\n"))
+	if err == nil {
+		t.Errorf("ParseSMBIOS() of dmidecode output without system information succeeded")
+	}
+}
+
+func concat(parts ...[]byte) []byte {
+	var data []byte
+	for _, p := range parts {
+		data = append(data, p...)
+	}
+	return data
+}
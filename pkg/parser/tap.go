@@ -0,0 +1,199 @@
+// tap.go
+
+package parser
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	tapPlanRe    = regexp.MustCompile(`^1\.\.(\d+)\s*(?:#\s*(.*))?$`)
+	tapResultRe  = regexp.MustCompile(`^(not ok|ok)\b\s*(\d+)?\s*(?:-\s*)?(.*)$`)
+	tapBailOutRe = regexp.MustCompile(`^Bail out!\s*(.*)$`)
+)
+
+// Split the description into name, directive and its reason. Only the
+// last unescaped # can start a directive.
+func tapDirective(desc string) (string, string, string) {
+	name := desc
+	directive, reason := "", ""
+
+	for i := len(desc) - 1; i >= 0; i-- {
+		if desc[i] != '#' || (i > 0 && desc[i-1] == '\\') {
+			continue
+		}
+		rest := strings.TrimSpace(desc[i+1:])
+		word := rest
+		if n := strings.IndexAny(rest, " \t"); n >= 0 {
+			word = rest[:n]
+		}
+		word = strings.ToUpper(word)
+		if strings.HasPrefix(word, "SKIP") || strings.HasPrefix(word, "TODO") {
+			name = desc[:i]
+			directive = word[:4]
+			reason = strings.TrimSpace(rest[len(word):])
+		}
+		break
+	}
+	return strings.TrimSpace(strings.Replace(name, "\\#", "#", -1)), directive, reason
+}
+
+// Pick the duration out of a YAML diagnostic block, if given
+func tapDuration(block string) float64 {
+	var diag map[string]interface{}
+	if err := yaml.Unmarshal([]byte(block), &diag); err != nil {
+		return 0
+	}
+	for _, d := range []struct {
+		key   string
+		scale float64
+	}{
+		{"duration_ms", 1e-3},
+		{"duration", 1},
+	} {
+		switch v := diag[d.key].(type) {
+		case int:
+			return float64(v) * d.scale
+		case float64:
+			return v * d.scale
+		}
+	}
+	return 0
+}
+
+// ParseTAP reads a Test Anything Protocol stream (version 12 and 13).
+// ok, not ok, # SKIP and # TODO map onto pass, fail and skip. YAML
+// diagnostic blocks are kept as message of the test they follow. A plan of
+// 1..0, which skips all tests, results in a single skipped case.
+func ParseTAP(r io.Reader) ([]Case, error) {
+	var cases []Case
+	var block []string
+	var indent string
+	inBlock := false
+	bailedOut := false
+	planned := -1
+	planComment := ""
+
+	// Attach the finished diagnostic block to the last test
+	endBlock := func() {
+		inBlock = false
+		if len(cases) == 0 {
+			return
+		}
+		yml := strings.Join(block, "\n")
+		c := &cases[len(cases)-1]
+		if c.Message == "" {
+			c.Message = yml
+		} else {
+			c.Message += "\n" + yml
+		}
+		if d := tapDuration(yml); d > 0 {
+			c.Duration = d
+		}
+	}
+
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		line := strings.TrimRight(sc.Text(), "\r")
+
+		if inBlock {
+			trimmed := strings.TrimSpace(line)
+			if trimmed == "..." {
+				endBlock()
+			} else {
+				block = append(block, strings.TrimPrefix(line, indent))
+			}
+			continue
+		}
+
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "---" && len(cases) > 0 {
+			inBlock = true
+			block = nil
+			indent = line[:strings.Index(line, "-")]
+			continue
+		}
+		// Subtests and comments are ignored
+		if line != trimmed || strings.HasPrefix(line, "#") || line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "TAP version") {
+			continue
+		}
+		if m := tapPlanRe.FindStringSubmatch(line); m != nil {
+			planned, _ = strconv.Atoi(m[1])
+			planComment = m[2]
+			continue
+		}
+		if m := tapBailOutRe.FindStringSubmatch(line); m != nil {
+			cases = append(cases, Case{
+				Name:    "Bail out!",
+				Result:  ResultError,
+				Message: m[1],
+			})
+			bailedOut = true
+			break
+		}
+
+		m := tapResultRe.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		name, directive, reason := tapDirective(m[3])
+		if name == "" {
+			if m[2] != "" {
+				name = "test " + m[2]
+			} else {
+				name = fmt.Sprintf("test %d", len(cases)+1)
+			}
+		}
+
+		c := Case{Name: name, Result: ResultPass}
+		switch {
+		case directive == "SKIP":
+			c.Result = ResultSkip
+			c.Message = reason
+		case directive == "TODO" && m[1] == "not ok":
+			// Known failure, doesn't count as failed
+			c.Result = ResultSkip
+			c.Message = strings.TrimSpace("TODO " + reason)
+		case m[1] == "not ok":
+			c.Result = ResultFail
+		}
+		cases = append(cases, c)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("Failed to read TAP stream: %v", err)
+	}
+	if inBlock {
+		endBlock()
+	}
+
+	if len(cases) == 0 && planned == 0 {
+		// e.g. "1..0 # SKIP no hardware"
+		reason := strings.TrimSpace(planComment)
+		if len(reason) >= 4 && strings.EqualFold(reason[:4], "SKIP") {
+			reason = strings.TrimLeft(reason[4:], ":- \t")
+		}
+		return []Case{{Name: "TAP plan", Result: ResultSkip, Message: reason}}, nil
+	}
+	if len(cases) == 0 {
+		return nil, fmt.Errorf("No TAP test results found")
+	}
+	if !bailedOut && planned >= 0 && len(cases) < planned {
+		cases = append(cases, Case{
+			Name:    "TAP plan",
+			Result:  ResultError,
+			Message: fmt.Sprintf("%d tests planned, only %d ran", planned, len(cases)),
+		})
+	}
+	return cases, nil
+}
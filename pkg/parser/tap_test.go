@@ -0,0 +1,116 @@
+// tap_test.go
+
+package parser
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseTAP(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []Case
+		err   bool
+	}{
+		{
+			name: "results",
+			input: `TAP version 13
+1..4
+ok 1 - boot
+not ok 2 - suspend
+ok 3 - usb # SKIP no device
+not ok 4 - s3 # TODO known issue
+`,
+			want: []Case{
+				{Name: "boot", Result: ResultPass},
+				{Name: "suspend", Result: ResultFail},
+				{Name: "usb", Result: ResultSkip, Message: "no device"},
+				{Name: "s3", Result: ResultSkip, Message: "TODO known issue"},
+			},
+		},
+		{
+			name:  "unnamed",
+			input: "ok 1\nok\n",
+			want:  []Case{{Name: "test 1", Result: ResultPass}, {Name: "test 2", Result: ResultPass}},
+		},
+		{
+			name: "diagnostics",
+			input: `ok 1 - boot
+  ---
+  duration_ms: 1500
+  ...
+`,
+			want: []Case{{Name: "boot", Result: ResultPass, Message: "duration_ms: 1500", Duration: 1.5}},
+		},
+		{
+			name:  "escaped hash",
+			input: "ok 1 - issue \\#12\n",
+			want:  []Case{{Name: "issue #12", Result: ResultPass}},
+		},
+		{
+			name:  "bail out",
+			input: "1..3\nok 1 - boot\nBail out! no network\nok 2 - never\n",
+			want:  []Case{{Name: "boot", Result: ResultPass}, {Name: "Bail out!", Result: ResultError, Message: "no network"}},
+		},
+		{
+			name:  "missing tests",
+			input: "1..3\nok 1 - boot\n",
+			want:  []Case{{Name: "boot", Result: ResultPass}, {Name: "TAP plan", Result: ResultError, Message: "3 tests planned, only 1 ran"}},
+		},
+		{
+			name:  "skip all",
+			input: "TAP version 13\n1..0 # SKIP no hardware\n",
+			want:  []Case{{Name: "TAP plan", Result: ResultSkip, Message: "no hardware"}},
+		},
+		{
+			name:  "skip all lower case",
+			input: "1..0 # skip: not supported\n",
+			want:  []Case{{Name: "TAP plan", Result: ResultSkip, Message: "not supported"}},
+		},
+		{
+			name:  "empty plan",
+			input: "1..0\n",
+			want:  []Case{{Name: "TAP plan", Result: ResultSkip}},
+		},
+		{
+			name:  "no results",
+			input: "TAP version 13\n# nothing\n",
+			err:   true,
+		},
+		{
+			name:  "not TAP",
+			input: "<testsuite/>\n",
+			err:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseTAP(strings.NewReader(tt.input))
+			if tt.err {
+				if err == nil {
+					t.Fatalf("ParseTAP() = %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseTAP(): %v", err)
+			}
+			checkCases(t, got, tt.want)
+		})
+	}
+}
+
+// Compare the cases field by field
+func checkCases(t *testing.T, got, want []Case) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("Got %d cases %+v, want %d %+v", len(got), got, len(want), want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Case %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
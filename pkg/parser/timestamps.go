@@ -0,0 +1,82 @@
+// timestamps.go
+
+package parser
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Timestamp is an entry of coreboot's timestamp table
+type Timestamp struct {
+	ID   int
+	Name string
+	// Microseconds since the first timestamp
+	Time int64
+	// Microseconds since the previous entry
+	Duration int64
+}
+
+var (
+	// e.g. "  11:start of bootblock      146,587 (261)"
+	timestampRe = regexp.MustCompile(`^\s*(\d+):(.*?)\s+([\d,]+)(?:\s+\(([\d,]+)\))?\s*$`)
+	totalTimeRe = regexp.MustCompile(`^\s*Total Time:\s*([\d,]+)`)
+)
+
+func parseMicroseconds(s string) (int64, error) {
+	return strconv.ParseInt(strings.Replace(s, ",", "", -1), 10, 64)
+}
+
+// ParseTimestamps reads the output of 'cbmem -t'. Returns the entries and
+// the total boot time in microseconds.
+func ParseTimestamps(r io.Reader) ([]Timestamp, int64, error) {
+	var stamps []Timestamp
+	var total int64
+	var first int64 = -1
+
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimRight(sc.Text(), "\r")
+
+		if m := totalTimeRe.FindStringSubmatch(line); m != nil {
+			total, _ = parseMicroseconds(m[1])
+			continue
+		}
+		m := timestampRe.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+
+		ts := Timestamp{Name: strings.TrimSpace(m[2])}
+		ts.ID, _ = strconv.Atoi(m[1])
+		abs, err := parseMicroseconds(m[3])
+		if err != nil {
+			continue
+		}
+		if first < 0 {
+			first = abs
+		}
+		ts.Time = abs - first
+		if m[4] != "" {
+			ts.Duration, _ = parseMicroseconds(m[4])
+		} else if len(stamps) > 0 {
+			ts.Duration = ts.Time - stamps[len(stamps)-1].Time
+		}
+		stamps = append(stamps, ts)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, 0, fmt.Errorf("Failed to read timestamps: %v", err)
+	}
+
+	if len(stamps) == 0 {
+		return nil, 0, fmt.Errorf("No timestamps found")
+	}
+	if total == 0 {
+		total = stamps[len(stamps)-1].Time
+	}
+	return stamps, total, nil
+}
@@ -0,0 +1,90 @@
+// timestamps_test.go
+
+package parser
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseTimestamps(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []Timestamp
+		total int64
+		err   bool
+	}{
+		{
+			name: "cbmem -t",
+			input: `3 entries total:
+
+   0:1st timestamp                                     146,587
+  11:start of bootblock                                146,810 (223)
+   1:start of romstage                                 180,000 (33,190)
+
+Total Time: 1,000,000
+`,
+			want: []Timestamp{
+				{ID: 0, Name: "1st timestamp"},
+				{ID: 11, Name: "start of bootblock", Time: 223, Duration: 223},
+				{ID: 1, Name: "start of romstage", Time: 33413, Duration: 33190},
+			},
+			total: 1000000,
+		},
+		{
+			name:  "without durations and total",
+			input: "  0:1st timestamp 1,000\r\n  1:start of romstage 3,500\r\n",
+			want: []Timestamp{
+				{ID: 0, Name: "1st timestamp"},
+				{ID: 1, Name: "start of romstage", Time: 2500, Duration: 2500},
+			},
+			total: 2500,
+		},
+		{
+			name: "garbage lines",
+			input: `cbmem: unable to find coreboot table
+   0:1st timestamp 100
+  12:overflow 99999999999999999999
+start of ramstage 200
+   2:end of romstage 400 (300)
+`,
+			want: []Timestamp{
+				{ID: 0, Name: "1st timestamp"},
+				{ID: 2, Name: "end of romstage", Time: 300, Duration: 300},
+			},
+			total: 300,
+		},
+		{
+			name:  "empty",
+			input: "",
+			err:   true,
+		},
+		{
+			name:  "no timestamps",
+			input: "Total Time: 1,000\ncbmem: unable to find coreboot table\n",
+			err:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, total, err := ParseTimestamps(strings.NewReader(tt.input))
+			if tt.err {
+				if err == nil {
+					t.Fatalf("ParseTimestamps() = %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseTimestamps(): %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseTimestamps() = %+v, want %+v", got, tt.want)
+			}
+			if total != tt.total {
+				t.Errorf("total = %d, want %d", total, tt.total)
+			}
+		})
+	}
+}
@@ -8,18 +8,26 @@ import (
 	"github.com/gin-gonic/contrib/sessions"
 	"github.com/gin-gonic/gin"
 	"github.com/golang/glog"
+	"github.com/siro20/boardstatus/pkg/git"
+	"github.com/siro20/boardstatus/pkg/lava"
 	"github.com/siro20/boardstatus/pkg/model"
 	oauth "github.com/siro20/boardstatus/pkg/oauth"
 )
 
-func OAuthLoginCallback(c *gin.Context, u oauth.OAuthUser) error {
+func OAuthLoginCallback(store *model.Store) oauth.OAuthCallback {
+	return func(c *gin.Context, u oauth.OAuthUser) error {
+		return oauthLogin(store, c, u)
+	}
+}
+
+func oauthLogin(store *model.Store, c *gin.Context, u oauth.OAuthUser) error {
 	var user *model.User
 	var err error
 
 	if u.Email == "" {
-		user, err = model.GetUserByOAuthLogin(u.Login, u.Provider)
+		user, err = store.GetUserByOAuthLogin(u.Login, u.Provider)
 	} else {
-		user, err = model.GetUserByEmail(u.Email)
+		user, err = store.GetUserByEmail(u.Email)
 	}
 
 	if user == nil || err != nil {
@@ -30,7 +38,7 @@ func OAuthLoginCallback(c *gin.Context, u oauth.OAuthUser) error {
 			ProfilePictureURL: u.AvatarURL,
 			OAuthProvider:     u.Provider,
 		}
-		err := newUser.InsertIntoDB()
+		err := newUser.InsertIntoDB(store.ForRequest(c))
 		if err != nil {
 			return err
 		}
@@ -47,23 +55,27 @@ func OAuthLoginCallback(c *gin.Context, u oauth.OAuthUser) error {
 	return nil
 }
 
-func initializeRoutes() {
+func initializeRoutes(store *model.Store, lavaClient *lava.Client, repo *git.Repo) {
 
 	// Use secure cookie store.
-	store := sessions.NewCookieStore([]byte("secret"))
-	router.Use(sessions.Sessions("mystore", store))
+	cookieStore := sessions.NewCookieStore([]byte("secret"))
+	router.Use(sessions.Sessions("mystore", cookieStore))
 
 	// Use the setUserStatus middleware for every route to set a flag
 	// indicating whether the request was from an authenticated user or not
-	router.Use(setUserStatus())
+	router.Use(setUserStatus(store))
 
-	// Allow BasicAuth for REST API
-	//router.Use(BasicAuth())
+	// Record changes made through the web pages as made by the user
+	router.Use(setAuditActor(model.SourceWeb))
 
 	// Handle the index route
-	router.GET("/", showIndexPage)
+	router.GET("/", showIndexPage(store))
+
+	// Handle GET requests at /matrix
+	// e.g. /matrix?manufacturer=Emulation&columns=tags&format=csv
+	router.GET("/matrix", showMatrixPage(store))
 
-	oauth.InstallOAuth2Routers(router, OAuthLoginCallback)
+	oauth.InstallOAuth2Routers(router, OAuthLoginCallback(store))
 
 	router.GET("/login", ensureNotLoggedIn(), oauth.ShowOAuth2LoginPage)
 	router.GET("/logout", ensureLoggedIn(), oauth.ShowOAuth2LogoutPage)
@@ -78,7 +90,7 @@ func initializeRoutes() {
 
 		// Handle POST requests at /u/login
 		// Ensure that the user is not logged in by using the middleware
-		userRoutes2.POST("/login", ensureNotLoggedIn(), performLogin)
+		userRoutes2.POST("/login", ensureNotLoggedIn(), performLogin(store))
 
 		// Handle GET requests at /u/logout
 		// Ensure that the user is logged in by using the middleware
@@ -99,21 +111,42 @@ func initializeRoutes() {
 	{
 		var b model.Board
 		// Handle GET requests at /board/view/id
-		boardRoutes.GET("/view/:id", b.RenderShow)
+		boardRoutes.GET("/view/:id", b.RenderShow(store))
 
 		// Handle the GET requests at /board/create
 		// Show the article creation page
 		// Ensure that the user is logged in by using the middleware
-		boardRoutes.GET("/create", ensureLoggedIn(), showArticleCreationPage)
+		boardRoutes.GET("/create", ensurePermission(store, model.PermCreateBoard, ""), showArticleCreationPage)
 
 		// Handle POST requests at /board/create
-		// Ensure that the user is logged in by using the middleware
-		boardRoutes.POST("/create", ensureLoggedIn(), createArticle)
+		// Ensure that the user may add boards by using the middleware
+		boardRoutes.POST("/create", ensurePermission(store, model.PermCreateBoard, ""), createArticle(store))
+
+		// Handle POST requests at /board/create/smbios
+		// Fills in the creation page from dmidecode output
+		boardRoutes.POST("/create/smbios", ensurePermission(store, model.PermCreateBoard, ""), showBoardFromSMBIOS(store))
 
 		// Handle GET requests at /board/list
-		boardRoutes.GET("/list/", b.RenderAll)
+		boardRoutes.GET("/list/", b.RenderAll(store))
+
+		// Handle GET and POST requests at /board/edit/id
+		// Admins and maintainers of the board only
+		boardRoutes.GET("/edit/:id", ensurePermission(store, model.PermEditBoard, "id"), b.RenderEdit(store))
+		boardRoutes.POST("/edit/:id", ensurePermission(store, model.PermEditBoard, "id"), b.Update(store))
 
-		boardRoutes.GET("/edit/:id", b.RenderEdit)
+		// Handle POST requests at /board/maintainers/id, admins only
+		boardRoutes.POST("/maintainers/:id", ensureAdmin(), setMaintainersForm(store))
+
+		// Handle POST requests at /board/delete/id
+		// Moves the board and its tests to the trash, admins only
+		boardRoutes.POST("/delete/:id", ensureAdmin(), trashForm(store, model.DeleteActions, model.TrashBoards, "/board/list/"))
+
+		// Handle GET requests at /board/bisect/id
+		boardRoutes.GET("/bisect/:id", showBisectPage(store, repo))
+
+		// Handle GET requests at /board/boottime/id
+		// An SVG chart, e.g. /board/boottime/1?stage=start%20of%20romstage
+		boardRoutes.GET("/boottime/:id", showBootTimeChart(store))
 
 	}
 
@@ -121,12 +154,18 @@ func initializeRoutes() {
 	{
 		var u model.User
 		// Handle GET requests at /user/view/id
-		userRoutes.GET("/view/:id", u.RenderShow)
+		userRoutes.GET("/view/:id", u.RenderShow(store))
 
 		// Handle GET requests at /user/list
-		userRoutes.GET("/list/", u.RenderAll)
+		userRoutes.GET("/list/", u.RenderAll(store))
+
+		// Handle GET and POST requests at /user/edit/id
+		// Admins and the user itself only, roles are changed by admins
+		userRoutes.GET("/edit/:id", ensurePermission(store, model.PermEditUser, "id"), u.RenderEdit(store))
+		userRoutes.POST("/edit/:id", ensurePermission(store, model.PermEditUser, "id"), u.Update(store))
 
-		userRoutes.GET("/edit/:id", u.RenderEdit)
+		// Handle POST requests at /user/delete/id
+		userRoutes.POST("/delete/:id", ensureAdmin(), trashForm(store, model.DeleteActions, model.TrashUsers, "/user/list/"))
 
 	}
 
@@ -134,12 +173,181 @@ func initializeRoutes() {
 	{
 		var t model.Test
 		// Handle GET requests at /test/view/id
-		testsRoutes.GET("/view/:id", t.RenderShow)
+		testsRoutes.GET("/view/:id", t.RenderShow(store))
 
 		// Handle GET requests at /test/list
-		testsRoutes.GET("/list/", t.RenderAll)
+		testsRoutes.GET("/list/", t.RenderAll(store))
 
-		// Handle GET requests at /test/list
-		testsRoutes.GET("/edit/:id", t.RenderEdit)
+		// Handle GET and POST requests at /test/edit/id
+		// Admins and maintainers of the test's board only
+		testsRoutes.GET("/edit/:id", ensurePermission(store, model.PermEditTest, "id"), t.RenderEdit(store))
+		testsRoutes.POST("/edit/:id", ensurePermission(store, model.PermEditTest, "id"), t.Update(store))
+
+		// Handle POST requests at /test/delete/id
+		testsRoutes.POST("/delete/:id", ensureAdmin(), trashForm(store, model.DeleteActions, model.TrashTests, "/test/list/"))
+
+		// Handle GET requests at /test/diff/id
+		// Kernel log diff, e.g. /test/diff/5?against=3
+		testsRoutes.GET("/diff/:id", showKernelLogDiff(store))
+	}
+
+	// Group the trash routes together, all of them are for admins only
+	trashRoutes := router.Group("/trash", ensureAdmin())
+	{
+		// Handle GET requests at /trash/
+		trashRoutes.GET("/", showTrashPage(store))
+
+		// Handle POST requests at /trash/kind/id/restore and /trash/kind/id/purge
+		// e.g. /trash/boards/1/restore
+		trashRoutes.POST("/:kind/:id/restore", trashForm(store, model.RestoreActions, "", "/trash/"))
+		trashRoutes.POST("/:kind/:id/purge", trashForm(store, model.PurgeActions, "", "/trash/"))
+	}
+
+	// Group the routes of the user's API tokens together
+	tokenRoutes := router.Group("/tokens", ensureLoggedIn())
+	{
+		// Handle GET and POST requests at /tokens/
+		// Lists the tokens and creates new ones
+		tokenRoutes.GET("/", showTokensPage(store))
+		tokenRoutes.POST("/", createTokenForm(store))
+
+		// Handle POST requests at /tokens/id/revoke
+		tokenRoutes.POST("/:id/revoke", revokeTokenForm(store))
+	}
+
+	// Group the audit log routes together, admins only
+	auditRoutes := router.Group("/audit", ensureAdmin())
+	{
+		// Handle GET requests at /audit/
+		// e.g. /audit/?kind=boards&actor=root&since=2020-01-01
+		auditRoutes.GET("/", showAuditPage(store))
+	}
+
+	// Group REST API routes together, all of them need BasicAuth or an API token
+	apiRoutes := router.Group("/api/v1", BasicAuth(store), setAuditActor(model.SourceAPI))
+	{
+		// Handle POST requests at /api/v1/tests
+		// The board is given by board_id in the body, the store checks that
+		// the user may upload to it
+		apiRoutes.POST("/tests", apiCreateTest(store))
+
+		// Handle POST requests at /api/v1/boards/id/tests
+		apiRoutes.POST("/boards/:id/tests", ensurePermission(store, model.PermUpload, "id"), apiCreateBoardTest(store))
+
+		// Handle POST requests at /api/v1/boards/id/bundles
+		// Import a coreboot board_status.sh tarball
+		apiRoutes.POST("/boards/:id/bundles", ensurePermission(store, model.PermUpload, "id"), apiImportBundle(store))
+
+		// Handle POST requests at /api/v1/bundles
+		// The board is matched by the bundle's vendor/board directory, the
+		// store checks that the user may upload to it
+		apiRoutes.POST("/bundles", apiImportBundle(store))
+
+		// Handle GET requests at /api/v1/tests/id
+		apiRoutes.GET("/tests/:id", apiShowTest(store))
+
+		// Handle PUT and PATCH requests at /api/v1/tests/id
+		// PUT replaces all editable fields, PATCH only the given ones. Both
+		// need the record's updated_at in the body or its ETag in If-Match.
+		apiRoutes.PUT("/tests/:id", ensurePermission(store, model.PermEditTest, "id"), apiUpdateTest(store))
+		apiRoutes.PATCH("/tests/:id", ensurePermission(store, model.PermEditTest, "id"), apiUpdateTest(store))
+
+		// Handle DELETE requests at /api/v1/tests/id
+		// Moves the test to the trash, admins only
+		apiRoutes.DELETE("/tests/:id", ensureAdmin(), apiDelete(store, model.TrashTests))
+
+		// Handle GET requests at /api/v1/tests/id/kernel-log/diff
+		// e.g. /api/v1/tests/5/kernel-log/diff?against=3&format=text
+		apiRoutes.GET("/tests/:id/kernel-log/diff", apiKernelLogDiff(store))
+
+		// Handle GET requests at /api/v1/tests/id/config/diff
+		// e.g. /api/v1/tests/5/config/diff?against=3
+		apiRoutes.GET("/tests/:id/config/diff", apiConfigDiff(store))
+
+		// Handle GET requests at /api/v1/tests/id/cmos
+		apiRoutes.GET("/tests/:id/cmos", apiShowCMOS(store))
+
+		// Handle GET requests at /api/v1/tests/id/cmos/diff
+		// e.g. /api/v1/tests/5/cmos/diff?against=3
+		apiRoutes.GET("/tests/:id/cmos/diff", apiCMOSDiff(store))
+
+		// Handle GET requests at /api/v1/config
+		// e.g. /api/v1/config?option=CONFIG_USE_BLOBS&value=y
+		apiRoutes.GET("/config", apiFindBoardsByConfig(store))
+
+		// Handle GET requests at /api/v1/testcases
+		// e.g. /api/v1/testcases?name=s3-resume&result=fail
+		apiRoutes.GET("/testcases", apiFindTestCases(store))
+
+		// Handle GET requests at /api/v1/regressions
+		// e.g. /api/v1/regressions?board_id=1&kind=new_failure
+		apiRoutes.GET("/regressions", apiFindRegressions(store))
+
+		// Handle GET requests at /api/v1/flaky
+		apiRoutes.GET("/flaky", apiFlakyCases(store))
+
+		// Handle POST requests at /api/v1/boards/id/lava
+		// Imports the LAVA job named by the test's exeternal_ref
+		apiRoutes.POST("/boards/:id/lava", ensurePermission(store, model.PermUpload, "id"), apiImportLAVA(store, lavaClient))
+
+		// Handle GET and POST requests at /api/v1/boards/lookup
+		// e.g. /api/v1/boards/lookup?manufacturer=QEMU&product_name=Standard%20PC
+		// or POST the output of dmidecode
+		apiRoutes.GET("/boards/lookup", apiLookupBoard(store))
+		apiRoutes.POST("/boards/lookup", apiLookupBoard(store))
+
+		// Handle GET, PUT, PATCH and DELETE requests at /api/v1/boards/id
+		apiRoutes.GET("/boards/:id", apiShowBoard(store))
+		apiRoutes.PUT("/boards/:id", ensurePermission(store, model.PermEditBoard, "id"), apiUpdateBoard(store))
+		apiRoutes.PATCH("/boards/:id", ensurePermission(store, model.PermEditBoard, "id"), apiUpdateBoard(store))
+		apiRoutes.DELETE("/boards/:id", ensureAdmin(), apiDelete(store, model.TrashBoards))
+
+		// Handle GET, PUT, PATCH and DELETE requests at /api/v1/users/id
+		apiRoutes.GET("/users/:id", apiShowUser(store))
+		apiRoutes.PUT("/users/:id", ensurePermission(store, model.PermEditUser, "id"), apiUpdateUser(store))
+		apiRoutes.PATCH("/users/:id", ensurePermission(store, model.PermEditUser, "id"), apiUpdateUser(store))
+		apiRoutes.DELETE("/users/:id", ensureAdmin(), apiDelete(store, model.TrashUsers))
+
+		// Handle GET and PUT requests at /api/v1/boards/id/maintainers
+		// Setting the maintainers is for admins only
+		apiRoutes.GET("/boards/:id/maintainers", apiShowMaintainers(store))
+		apiRoutes.PUT("/boards/:id/maintainers", ensureAdmin(), apiSetMaintainers(store))
+
+		// Handle GET requests at /api/v1/trash/kind, kind is one of boards,
+		// tests and users. Admins only, like restoring and purging.
+		apiRoutes.GET("/trash/:kind", ensureAdmin(), apiShowTrash(store))
+
+		// Handle POST requests at /api/v1/trash/kind/id/restore
+		apiRoutes.POST("/trash/:kind/:id/restore", ensureAdmin(), apiRestore(store))
+
+		// Handle DELETE requests at /api/v1/trash/kind/id
+		// Purges the record for good
+		apiRoutes.DELETE("/trash/:kind/:id", ensureAdmin(), apiPurge(store))
+
+		// Handle GET and POST requests at /api/v1/tokens
+		// Lists the user's API tokens and creates new ones
+		apiRoutes.GET("/tokens", apiListTokens(store))
+		apiRoutes.POST("/tokens", apiCreateToken(store))
+
+		// Handle DELETE requests at /api/v1/tokens/id
+		// Revokes the user's API token
+		apiRoutes.DELETE("/tokens/:id", apiRevokeToken(store))
+
+		// Handle GET requests at /api/v1/audit, admins only
+		// e.g. /api/v1/audit?kind=tests&record_id=5&action=update
+		apiRoutes.GET("/audit", ensureAdmin(), apiShowAudit(store))
+
+		// Handle GET requests at /api/v1/boards/id/history
+		apiRoutes.GET("/boards/:id/history", apiBoardHistory(store))
+
+		// Handle GET requests at /api/v1/boards/id/bisect
+		// e.g. /api/v1/boards/1/bisect?good=4.12&bad=abcdef0
+		apiRoutes.GET("/boards/:id/bisect", apiBoardBisect(store, repo))
+
+		// Handle GET requests at /api/v1/boards/id/boottime
+		apiRoutes.GET("/boards/:id/boottime", apiBoardBootTime(store))
+
+		// Handle GET requests at /api/v1/commits/hash
+		apiRoutes.GET("/commits/:hash", apiShowCommit(store))
 	}
 }